@@ -3,6 +3,10 @@ module openorganizer
 go 1.24.2
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/joho/godotenv v1.5.1
+	github.com/klauspost/compress v1.18.0
 	github.com/lib/pq v1.10.9
+	google.golang.org/protobuf v1.36.9
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-10-11
- * Updated: 2025-10-30
+ * Updated: 2026-10-19
  *
  * This file provides authentication functionality that interfaces with the database.
  * This includes CRUD operations on user accounts and tokens.
@@ -14,15 +14,32 @@
 package db
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"errors"
 	"math/rand"
 	"reflect"
 
+	"github.com/lib/pq"
+
 	"openorganizer/src/models"
 	"openorganizer/src/utils"
 )
 
+// returned instead of database errors so that handlers can tell the client what went wrong
+var ErrInvalidLogin = errors.New("invalid username+password combination")
+var ErrUsernameTaken = errors.New("username already exists")
+
+// the username is the primary key of users, so a unique violation means it is taken
+func usernameError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
 func ValidateUsername(username []byte) bool {
 	for i := range username {
 		if username[i] == '\x00' {
@@ -44,32 +61,38 @@ func hashPassword(passwordHash []byte, salt int32) []byte {
 // users
 
 // register a new account
-func RegisterUser(userLogin models.UserLogin, userData models.UserData) (response []byte, err error) {
+// the token is bound to fingerprint, unless it is empty, and likewise for Login and ModifyUser
+func RegisterUser(ctx context.Context, userLogin models.UserLogin, userData models.UserData, fingerprint []byte) (response []byte, err error) {
 	salt := rand.Int31()
 	passwordHashHash := hashPassword(userLogin.PasswordHash, salt)
 	now := utils.Now()
-	row, err := db.Query(userCreate, userLogin.Username, now, now, passwordHashHash, salt, userData.EncrPrivateKey, userData.EncrPrivateKey2)
+	row, err := db.QueryContext(ctx, userCreate, userLogin.Username, now, now, passwordHashHash, salt, userData.EncrPrivateKey, userData.EncrPrivateKey2)
 	if err != nil {
-		return nil, err
+		return nil, usernameError(err)
 	}
 	defer row.Close()
 	var userID int64
 	row.Next()
-	err = row.Scan(&userID)
+	if err = row.Scan(&userID); err != nil {
+		return nil, usernameError(err)
+	}
 
-	token, err := addToken(userID)
+	token, err := addToken(ctx, userID, fingerprint)
 	userAuth := models.UserAuth{
 		UserID:    userID,
 		AuthToken: token,
 	}
-	response = utils.PackAuth(userAuth)
-	_, _ = db.Exec(lastupCreate, userID, now)
-	return response, err
+	_, lastupErr := db.ExecContext(ctx, lastupCreate, userID, now)
+	utils.LogError(ctx, lastupErr, "create lastUpdated", "userID", userID)
+	if err != nil {
+		return nil, err
+	}
+	return utils.PackUserAuth(userAuth)
 }
 
 // try to verify username + password combo
-func Login(userLogin models.UserLogin) (response []byte, err error) {
-	row, err := db.Query(userRead, userLogin.Username)
+func Login(ctx context.Context, userLogin models.UserLogin, fingerprint []byte) (response []byte, err error) {
+	row, err := db.QueryContext(ctx, userRead, userLogin.Username)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +100,7 @@ func Login(userLogin models.UserLogin) (response []byte, err error) {
 
 	var rowUser models.RowUsers
 	if !row.Next() {
-		return nil, errors.New("no entry found")
+		return nil, ErrInvalidLogin
 	}
 	err = row.Scan(&rowUser.Username, &rowUser.UserID, &rowUser.LastUpdated, &rowUser.LastLogin,
 		&rowUser.PasswordHashHash, &rowUser.Salt, &rowUser.EncrPrivateKey, &rowUser.EncrPrivateKey2)
@@ -87,29 +110,29 @@ func Login(userLogin models.UserLogin) (response []byte, err error) {
 
 	passwordHashHash := hashPassword(userLogin.PasswordHash, rowUser.Salt)
 	if !reflect.DeepEqual(passwordHashHash, rowUser.PasswordHashHash) {
-		return nil, errors.New("incorrect password")
+		return nil, ErrInvalidLogin
 	}
-	_, _ = db.Exec(userUpdateLastLogin, userLogin.Username, utils.Now())
+	_, err = db.ExecContext(ctx, userUpdateLastLogin, userLogin.Username, utils.Now())
+	utils.LogError(ctx, err, "update lastLogin", "userID", rowUser.UserID)
 
-	token, err := addToken(rowUser.UserID)
-	userAuth := models.UserAuth{
-		UserID:    rowUser.UserID,
-		AuthToken: token,
+	token, err := addToken(ctx, rowUser.UserID, fingerprint)
+	if err != nil {
+		return nil, err
 	}
-	response = utils.PackAuth(userAuth)
-	response = append(response, rowUser.EncrPrivateKey...)
-	response = append(response, rowUser.EncrPrivateKey2...)
-	return response, nil
+	return utils.PackLoginResponse(models.LoginResponse{
+		Auth: models.UserAuth{UserID: rowUser.UserID, AuthToken: token},
+		Data: models.UserData{EncrPrivateKey: rowUser.EncrPrivateKey, EncrPrivateKey2: rowUser.EncrPrivateKey2},
+	})
 }
 
 // change user information
-func ModifyUser(userLogin models.UserLogin, userLoginNew models.UserLogin, userData models.UserData) (response []byte, err error) {
+func ModifyUser(ctx context.Context, userLogin models.UserLogin, userLoginNew models.UserLogin, userData models.UserData, fingerprint []byte) (response []byte, err error) {
 	salt := rand.Int31()
 	passwordHashHash := hashPassword(userLoginNew.PasswordHash, salt)
 	now := utils.Now()
-	row, err := db.Query(userUpdate, userLogin.Username, userLoginNew.Username, now, now, passwordHashHash, salt, userData.EncrPrivateKey, userData.EncrPrivateKey2)
+	row, err := db.QueryContext(ctx, userUpdate, userLogin.Username, userLoginNew.Username, now, now, passwordHashHash, salt, userData.EncrPrivateKey, userData.EncrPrivateKey2)
 	if err != nil {
-		return nil, err
+		return nil, usernameError(err)
 	}
 	defer row.Close()
 	if !row.Next() {
@@ -121,58 +144,103 @@ func ModifyUser(userLogin models.UserLogin, userLoginNew models.UserLogin, userD
 	if err != nil {
 		return nil, err
 	}
-	ClearTokensFromUser(userAuth.UserID)
-	userAuth.AuthToken, err = addToken(userAuth.UserID)
-	return utils.PackAuth(userAuth), err
+	ClearTokensFromUser(ctx, userAuth.UserID)
+	userAuth.AuthToken, err = addToken(ctx, userAuth.UserID, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return utils.PackUserAuth(userAuth)
 }
 
 // tokens
 
-// create auth token and store
-func addToken(userID int64) (token []byte, err error) {
+// create auth token and store, bound to the fingerprint of a client certificate if one is given
+func addToken(ctx context.Context, userID int64, fingerprint []byte) (token []byte, err error) {
 	token = utils.RandArray(32)
 	now := utils.Now()
 	expirationTime := now + (int64(tokenExpireTime) * 1000)
-	_, err = db.Exec(tokensCreate, userID, now, expirationTime, token)
+	_, err = db.ExecContext(ctx, tokensCreate, userID, now, expirationTime, token, fingerprint)
 	return token, err
 }
 
 // check if token is valid, and update the expiration time if setting is active
-func CheckTokenAuth(userAuth models.UserAuth) bool {
-	row, err := db.Query(tokenReadTimes, userAuth.UserID, userAuth.AuthToken)
+// a token bound to a client certificate is only valid with the same certificate, whose fingerprint is given, and never without one
+// err is only set when the database fails, so that it is not mistaken for an invalid token
+func CheckTokenAuth(ctx context.Context, userAuth models.UserAuth, fingerprint []byte) (valid bool, err error) {
+	creationTime, expirationTime, bound, found, err := readToken(ctx, userAuth)
 	if err != nil {
-		return false
+		tokenValidations.Inc("error")
+		return false, err
+	}
+	if !found {
+		tokenValidations.Inc("invalid")
+		return false, nil
+	}
+	if expirationTime < utils.Now() {
+		tokenValidations.Inc("expired")
+		return false, nil
+	}
+	// bound tokens fail closed, so they cannot be used while binding is off or over the socket or a proxy, where there is no certificate to check
+	if len(bound) > 0 && len(fingerprint) == 0 {
+		tokenValidations.Inc("uncertified")
+		utils.Logger(ctx).Warn("token bound to a client certificate used without one, which happens when TLS_CLIENT_BIND is off or the request did not arrive over HTTPS", "userID", userAuth.UserID)
+		return false, nil
+	}
+	if len(bound) > 0 && !bytes.Equal(bound, fingerprint) {
+		tokenValidations.Inc("mismatch")
+		utils.Logger(ctx).Warn("token used with a client certificate other than the one it is bound to", "userID", userAuth.UserID)
+		return false, nil
+	}
+	tokenValidations.Inc("valid")
+	if tokenExpireRefresh {
+		refreshTokenExpiration(ctx, userAuth.UserID, creationTime)
+	}
+	return true, nil
+}
+
+// check if token is valid without refreshing the expiration time, for repeated checks that are not user activity
+func CheckTokenValid(ctx context.Context, userAuth models.UserAuth, fingerprint []byte) (valid bool, err error) {
+	_, expirationTime, bound, found, err := readToken(ctx, userAuth)
+	return found && expirationTime >= utils.Now() && (len(bound) == 0 || bytes.Equal(bound, fingerprint)), err
+}
+
+// a missing token is not an error
+// bound is the fingerprint of the client certificate the token is bound to, and empty if it is not bound
+func readToken(ctx context.Context, userAuth models.UserAuth) (creationTime int64, expirationTime int64, bound []byte, found bool, err error) {
+	row, err := db.QueryContext(ctx, tokenRead, userAuth.UserID, userAuth.AuthToken)
+	if err != nil {
+		return 0, 0, nil, false, err
 	}
 	defer row.Close()
 	if !row.Next() {
-		return false
+		return 0, 0, nil, false, row.Err()
 	}
-	var creationTime, expirationTime int64
-	_ = row.Scan(&creationTime, &expirationTime)
-	expired := expirationTime < utils.Now()
-	if tokenExpireRefresh && !expired {
-		refreshTokenExpiration(userAuth.UserID, creationTime)
-		return true
+	err = row.Scan(&creationTime, &expirationTime, &bound)
+	if err != nil {
+		return 0, 0, nil, false, err
 	}
-	return expired
+	return creationTime, expirationTime, bound, true, nil
 }
 
-func refreshTokenExpiration(userID int64, creationTime int64) {
+func refreshTokenExpiration(ctx context.Context, userID int64, creationTime int64) {
 	newExpirationTime := utils.Now() + (int64(tokenExpireTime) * 1000)
-	_, _ = db.Exec(tokenUpdateExpiration, userID, creationTime, newExpirationTime)
+	_, err := db.ExecContext(ctx, tokenUpdateExpiration, userID, creationTime, newExpirationTime)
+	utils.LogError(ctx, err, "refresh token", "userID", userID)
 }
 
-func ClearTokensFromUser(userID int64) {
-	_, _ = db.Exec(tokensDeleteAllFromUser, userID)
+func ClearTokensFromUser(ctx context.Context, userID int64) {
+	_, err := db.ExecContext(ctx, tokensDeleteAllFromUser, userID)
+	utils.LogError(ctx, err, "clear user tokens", "userID", userID)
 }
 
-func ClearExpiredTokens() {
-	_, _ = db.Exec(tokensDeleteExpiredByTime, utils.Now())
+func ClearExpiredTokens(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, tokensDeleteExpiredByTime, utils.Now())
+	return err
 }
 
-func DeleteUser(username string) {
-	row, err := db.Query(userDelete, username)
-	if err != nil {
+func DeleteUser(ctx context.Context, username string) {
+	row, err := db.QueryContext(ctx, userDelete, username)
+	if utils.LogError(ctx, err, "delete user") {
 		return
 	}
 	defer row.Close()
@@ -180,8 +248,13 @@ func DeleteUser(username string) {
 		return
 	}
 	var userID int64
-	_ = row.Scan(&userID)
-	_, _ = db.Exec(tokensDeleteAllFromUser, userID)
-	_, _ = db.Exec(lastupDelete, userID)
-	_, _ = db.Exec(userDeleteAllDataTables, userID)
+	if utils.LogError(ctx, row.Scan(&userID), "delete user") {
+		return
+	}
+	_, err = db.ExecContext(ctx, tokensDeleteAllFromUser, userID)
+	utils.LogError(ctx, err, "clear user tokens", "userID", userID)
+	_, err = db.ExecContext(ctx, lastupDelete, userID)
+	utils.LogError(ctx, err, "delete lastUpdated", "userID", userID)
+	_, err = db.ExecContext(ctx, userDeleteAllDataTables, userID)
+	utils.LogError(ctx, err, "delete user data", "userID", userID)
 }
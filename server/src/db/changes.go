@@ -0,0 +1,83 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file provides change fan-out between server instances through PostgreSQL LISTEN/NOTIFY.
+ * Every instance publishes a user's table changes to one channel, and listens on it to forward changes to its own clients.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const changesChannel = "openorganizer_changes"
+const listenerMinReconnect = 1 * time.Second
+const listenerMaxReconnect = 1 * time.Minute
+const listenerPingInterval = 90 * time.Second
+
+// publishes a change to every listening server instance, including this one
+// the change is already stored, so it is published even if the request that made it is cancelled
+func NotifyChange(ctx context.Context, userID int64, table string, lastUpdated int64) error {
+	ctx = context.WithoutCancel(ctx)
+	_, err := db.ExecContext(ctx, notifyChange, changesChannel, fmt.Sprintf("%v %s %v", userID, table, lastUpdated))
+	return err
+}
+
+// listens on its own connection for changes published by any instance, until ctx is done
+// onReconnect is called after the connection is restored, since notifications sent while it was down are lost
+func ListenForChanges(ctx context.Context, onChange func(userID int64, table string, lastUpdated int64), onReconnect func()) error {
+	listener := pq.NewListener(pgConnStr, listenerMinReconnect, listenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			slog.Warn("change listener disconnected", "error", err)
+		case pq.ListenerEventReconnected:
+			slog.Info("change listener reconnected")
+		case pq.ListenerEventConnectionAttemptFailed:
+			slog.Warn("change listener failed to reconnect", "error", err)
+		}
+	})
+	err := listener.Listen(changesChannel)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		defer listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification := <-listener.Notify:
+				// a nil notification is sent after reconnecting
+				if notification == nil {
+					onReconnect()
+					continue
+				}
+				var userID, lastUpdated int64
+				var table string
+				_, err := fmt.Sscanf(notification.Extra, "%d %s %d", &userID, &table, &lastUpdated)
+				if err != nil {
+					slog.Warn("change listener received a malformed payload", "payload", notification.Extra)
+					continue
+				}
+				onChange(userID, table, lastUpdated)
+			case <-time.After(listenerPingInterval):
+				go listener.Ping()
+			}
+		}
+	}()
+	return nil
+}
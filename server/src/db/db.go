@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-09-20
- * Updated: 2025-10-26
+ * Updated: 2026-10-19
  *
  * This file declares the database variable and includes databse interaction functions.
  * Included are for connecting to and closing the connection to the database, as well as functions for inserting into or selecting from.
@@ -14,215 +14,706 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 
 	"openorganizer/src/models"
 	"openorganizer/src/utils"
 )
 
 var db *sql.DB
+var pgConnStr string
+
+// returned when an authenticated user has no lastUpdated row, which registration creates alongside the user
+var ErrNoLastUpdated = errors.New("no lastUpdated entry found for the user")
+
+const connectMinRetry = 500 * time.Millisecond
+const connectMaxRetry = 10 * time.Second
+
 var tokenExpireTime uint32
 var tokenExpireRefresh bool
+var idempotencyWindow uint32
+
+// a pending idempotency key older than this belongs to a request that never finished, such as one cut off by a crash
+const idempotencyPendingTimeout = time.Minute
 
 // connects to the postgresql server using provided env variables
-func ConnectToDB(env models.ENVVars) error {
-	pgConnStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", env.DB_HOST, env.DB_PORT, env.DB_USER, env.DB_PWD, "postgres")
-	conn, err := sql.Open("postgres", pgConnStr)
+// while the database is unreachable, it is retried with backoff for up to DB_CONNECT_TIMEOUT seconds, or until ctx is done
+func ConnectToDB(ctx context.Context, env models.ENVVars) error {
+	var err error
+	pgConnStr, err = ConnString(env)
+	if err != nil {
+		return err
+	}
+	connector, err := pq.NewConnector(pgConnStr)
 	if err != nil {
 		return err
 	}
-	db = conn
-	err = db.Ping()
+	db = sql.OpenDB(connector)
+	db.SetMaxOpenConns(int(env.DB_MAX_OPEN_CONNS))
+	db.SetMaxIdleConns(int(env.DB_MAX_IDLE_CONNS))
+	db.SetConnMaxLifetime(time.Duration(env.DB_CONN_MAX_LIFETIME) * time.Second)
 
 	tokenExpireTime = env.TOKEN_EXPIRE_TIME
 	tokenExpireRefresh = env.TOKEN_EXPIRE_REFRESH
+	idempotencyWindow = env.IDEMPOTENCY_WINDOW
 
-	return err
+	deadline := time.Now().Add(time.Duration(env.DB_CONNECT_TIMEOUT) * time.Second)
+	wait := connectMinRetry
+	for {
+		err = db.PingContext(ctx)
+		remaining := time.Until(deadline)
+		if err == nil || !retryConnect(err) || remaining <= 0 {
+			return err
+		}
+		// the last attempt is made at the deadline
+		wait = min(wait, remaining)
+		slog.Warn("database is not reachable, retrying", "error", err, "retry_in", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, connectMaxRetry)
+	}
+}
+
+// errors from the database itself, such as a wrong password, will not go away by retrying, unless it is still starting up
+func retryConnect(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "57P03"
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// builds the key=value connection string, where the settings that are set override those of DB_DSN
+// the test suite also uses it to change the schema directly
+func ConnString(env models.ENVVars) (string, error) {
+	var pairs []string
+	if env.DB_DSN != "" {
+		dsn := env.DB_DSN
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			var err error
+			dsn, err = pq.ParseURL(dsn)
+			if err != nil {
+				return "", errors.New("DB_DSN is not a valid postgres:// URL")
+			}
+		}
+		pairs = append(pairs, dsn)
+	}
+	// later pairs override earlier ones
+	for _, pair := range [][2]string{
+		{"host", env.DB_HOST},
+		{"port", env.DB_PORT},
+		{"user", env.DB_USER},
+		{"password", env.DB_PWD},
+		{"dbname", env.DB_NAME},
+		{"sslmode", env.DB_SSL_MODE},
+		{"sslrootcert", env.DB_SSL_ROOT_CERT},
+		{"sslcert", env.DB_SSL_CERT},
+		{"sslkey", env.DB_SSL_KEY},
+	} {
+		if pair[1] != "" {
+			pairs = append(pairs, pair[0]+"="+quoteConnValue(pair[1]))
+		}
+	}
+	// postgres cancels any statement that runs past the timeout, while the context of a call cancels it when the client goes away
+	pairs = append(pairs, fmt.Sprintf("statement_timeout=%d", env.DB_STATEMENT_TIMEOUT*1000))
+	return strings.Join(pairs, " "), nil
+}
+
+// quotes a value so that spaces, quotes, and backslashes in it are kept
+func quoteConnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
 
 // creates all required db tables that do not already exist
-func EnsureDBTables(env models.ENVVars) (errs []error) {
+func EnsureDBTables(ctx context.Context, env models.ENVVars) (errs []error) {
 	if env.CLEAR_DB_AUTH {
-		_, err := db.Exec(dropAllAuth)
-		utils.PrintErrorLine(err)
-		utils.AddError(err, errs)
+		_, err := db.ExecContext(ctx, dropAllAuth)
+		errs = utils.AddError(err, errs)
 	}
 
 	if env.CLEAR_DB_DATA {
-		_, err := db.Exec(dropAllData)
-		utils.PrintErrorLine(err)
-		utils.AddError(err, errs)
-	}
-
-	_, err := db.Exec(createTableUsers)
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableTokens)
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableLastUpdated)
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableItems("notes"))
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableItems("reminders"))
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableItems("daily_reminders"))
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableItems("weekly_reminders"))
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableItems("monthly_reminders"))
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableItems("yearly_reminders"))
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableExtensions)
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableOverrides)
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableFolders)
-	utils.AddError(err, errs)
-	_, err = db.Exec(createTableDeleted)
-	utils.AddError(err, errs)
+		_, err := db.ExecContext(ctx, dropAllData)
+		errs = utils.AddError(err, errs)
+	}
+
+	_, err := db.ExecContext(ctx, createTableUsers)
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableTokens)
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableLastUpdated)
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableItems("notes"))
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableItems("reminders"))
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableItems("daily_reminders"))
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableItems("weekly_reminders"))
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableItems("monthly_reminders"))
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableItems("yearly_reminders"))
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableExtensions)
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableOverrides)
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableFolders)
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableDeleted)
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableIdempotencyKeys)
+	errs = utils.AddError(err, errs)
+	_, err = db.ExecContext(ctx, createTableSchemaVersion)
+	errs = utils.AddError(err, errs)
+
+	err = migrate(ctx)
+	errs = utils.AddError(err, errs)
 
 	return errs
 }
 
+// every migration upgrades the schema from the version equal to its index to the next version
+var migrations = []string{
+	migrateLastModifiedToClock,
+	migrateTokenFingerprint,
+}
+
+// the schema version this server expects once all migrations are applied
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// checks that the database can be reached and has every migration applied, for the readiness of the server
+func CheckReady(ctx context.Context) error {
+	if db == nil {
+		return errNotConnected
+	}
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, schemaVersionRead).Scan(&version); err != nil {
+		return err
+	}
+	if version != SchemaVersion() {
+		return fmt.Errorf("schema version is %v, expected %v", version, SchemaVersion())
+	}
+	return nil
+}
+
+// applies all migrations past the stored schema version, each in its own transaction
+func migrate(ctx context.Context) error {
+	row, err := db.QueryContext(ctx, schemaVersionRead)
+	if err != nil {
+		return err
+	}
+	var version int
+	exists := row.Next()
+	if exists {
+		err = row.Scan(&version)
+	}
+	row.Close()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = db.ExecContext(ctx, schemaVersionCreate, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		// a migration rewrites whole tables, so it is not held to the statement timeout of requests
+		_, err = tx.ExecContext(ctx, migrationNoTimeout)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, migrations[version])
+		}
+		if err == nil {
+			_, err = tx.ExecContext(ctx, schemaVersionUpdate, version+1)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration to schema version %v failed: %w", version+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// starts the server clock from the latest lastModified stored by any instance, so that it never issues values behind ones already stored
+func SeedClock(ctx context.Context) error {
+	var latest sql.NullInt64
+	if err := db.QueryRowContext(ctx, latestClock).Scan(&latest); err != nil {
+		return err
+	}
+	utils.ClockSeed(latest.Int64)
+	return nil
+}
+
 // defer this function in main to close the database connection after program termination
 func CloseDatabase() {
 	db.Close()
 }
 
-func GetLastUpdated(userID int64) (row models.RowLastUpdated, err error) {
-	rows, err := db.Query(lastupRead, userID)
+func GetLastUpdated(ctx context.Context, userID int64) (row models.RowLastUpdated, err error) {
+	rows, err := db.QueryContext(ctx, lastupRead, userID)
 	if err != nil {
 		return models.RowLastUpdated{}, err
 	}
 	defer rows.Close()
 	if !rows.Next() {
-		return models.RowLastUpdated{}, errors.New("")
+		return models.RowLastUpdated{}, ErrNoLastUpdated
 	}
-	_ = rows.Scan(&row.UserID, &row.LastUpNotes, &row.LastUpReminders,
+	err = rows.Scan(&row.UserID, &row.LastUpNotes, &row.LastUpReminders,
 		&row.LastUpDaily, &row.LastUpWeekly, &row.LastUpMonthly, &row.LastUpYearly,
 		&row.LastUpExtensions, &row.LastUpOverrides, &row.LastUpFolders, &row.LastUpDeleted)
+	if err != nil {
+		return models.RowLastUpdated{}, err
+	}
 	return row, nil
 }
 
-func UpdateLastup(fieldName string, userID int64, time int64) {
-	_, _ = db.Exec(lastupUpdate(fieldName), userID, time)
+// the batch is already committed by the time lastUpdated is advanced, so it is not cancelled along with the request
+func UpdateLastup(ctx context.Context, fieldName string, userID int64, time int64) {
+	ctx = context.WithoutCancel(ctx)
+	_, err := db.ExecContext(ctx, lastupUpdate(fieldName), userID, time)
+	utils.LogError(ctx, err, "update lastUpdated", "userID", userID, "field", fieldName)
 }
 
 // syncup
+// each batch is written in one transaction, so that a request cancelled partway through stores none of it
+// otherwise the stored rows would have a new lastUpdated that the user's lastUpdated never reaches, and other devices would never fetch them
 
-func InsertItems(tableName string, rows []models.RowItems) (fails []bool, err error) {
+// runs the writes of a batch and commits them, before the handler advances lastUpdated
+func inTransaction(ctx context.Context, writes func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = writes(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// inserts a single row, which fails if the stored row is newer
+func insertRow(ctx context.Context, tx *sql.Tx, query string, args ...any) (fail bool, err error) {
+	found, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer found.Close()
+	return !found.Next(), found.Err()
+}
+
+// received holds the lastModified each record was sent with, which is compared against the stored row
+// with detailed, the stored rows that won over the failed records are read in the same transaction, so that the batch is never committed without them
+func InsertItems(ctx context.Context, tableName string, rows []models.RowItems, received []int64, detailed bool) (fails []bool, conflicts []models.RowItems, err error) {
 	fails = make([]bool, len(rows))
-	for i, row := range rows {
-		found, err := db.Query(insertItem(tableName), row.UserID, row.ItemID, row.LastModified, row.LastUpdated, row.EncryptedData)
+	err = inTransaction(ctx, func(tx *sql.Tx) (err error) {
+		for i, row := range rows {
+			fails[i], err = insertRow(ctx, tx, insertItem(tableName), row.UserID, row.ItemID, row.LastModified, row.LastUpdated, row.EncryptedData, received[i])
+			if err != nil {
+				return err
+			}
+		}
+		if detailed {
+			conflicts, err = itemConflicts(ctx, tx, tableName, rows, fails)
+		}
+		return err
+	})
+	fails, err = countInserts(tableName, fails, err)
+	return fails, conflicts, err
+}
+
+func InsertExtensions(ctx context.Context, rows []models.RowExtensions, received []int64, detailed bool) (fails []bool, conflicts []models.RowExtensions, err error) {
+	fails = make([]bool, len(rows))
+	err = inTransaction(ctx, func(tx *sql.Tx) (err error) {
+		for i, row := range rows {
+			fails[i], err = insertRow(ctx, tx, insertExtension, row.UserID, row.ItemID, row.LastModified, row.LastUpdated, row.SequenceNum, row.EncryptedData, received[i])
+			if err != nil {
+				return err
+			}
+		}
+		if detailed {
+			conflicts, err = extensionConflicts(ctx, tx, rows, fails)
+		}
+		return err
+	})
+	fails, err = countInserts("extensions", fails, err)
+	return fails, conflicts, err
+}
+
+func InsertOverrides(ctx context.Context, rows []models.RowOverrides, received []int64, detailed bool) (fails []bool, conflicts []models.RowOverrides, err error) {
+	fails = make([]bool, len(rows))
+	err = inTransaction(ctx, func(tx *sql.Tx) (err error) {
+		for i, row := range rows {
+			fails[i], err = insertRow(ctx, tx, insertOverride, row.UserID, row.ItemID, row.LastModified, row.LastUpdated, row.LinkedItemID, row.EncryptedData, received[i])
+			if err != nil {
+				return err
+			}
+		}
+		if detailed {
+			conflicts, err = overrideConflicts(ctx, tx, rows, fails)
+		}
+		return err
+	})
+	fails, err = countInserts("overrides", fails, err)
+	return fails, conflicts, err
+}
+
+func InsertFolders(ctx context.Context, rows []models.RowFolders, received []int64, detailed bool) (fails []bool, conflicts []models.RowFolders, err error) {
+	fails = make([]bool, len(rows))
+	err = inTransaction(ctx, func(tx *sql.Tx) (err error) {
+		for i, row := range rows {
+			fails[i], err = insertRow(ctx, tx, insertFolder, row.UserID, row.FolderID, row.LastModified, row.LastUpdated, row.EncryptedData, received[i])
+			if err != nil {
+				return err
+			}
+		}
+		if detailed {
+			conflicts, err = folderConflicts(ctx, tx, rows, fails)
+		}
+		return err
+	})
+	fails, err = countInserts("folders", fails, err)
+	return fails, conflicts, err
+}
+
+// policies declared by the client for how the rest of a deleted batch is handled alongside folder deletions
+// the server cannot see which items are inside of a folder, so the client sends the folder's contents in the same batch
+const (
+	// every record in the batch is applied independently
+	FolderPolicyKeep = "KEEP"
+	// each folder deletion is followed in the batch by the deletions of its contents, up to the next folder, which are only applied if the folder deletion succeeds
+	// deletions before the first folder do not belong to one, and are applied independently
+	FolderPolicyCascade = "CASCADE"
+)
+
+const notesTable int16 = 11
+const remindersTable int16 = 12
+const dailyTable int16 = 21
+const weeklyTable int16 = 22
+const monthlyTable int16 = 23
+const yearlyTable int16 = 24
+const overridesTable int16 = 31
+const foldersTable int16 = 32
+
+// inserts received deleted rows and removes the row from its home table, along with anything depending on it
+// folder deletions are applied first so that their result can decide what happens to the rest of the batch
+func InsertDeleted(ctx context.Context, rows []models.RowDeleted, received []int64, folderPolicy string, detailed bool) (fails []bool, conflicts []models.RowDeleted, err error) {
+	fails = make([]bool, len(rows))
+	err = inTransaction(ctx, func(tx *sql.Tx) (err error) {
+		for i, row := range rows {
+			if row.ItemTable != foldersTable {
+				continue
+			}
+			fails[i], err = insertDeletedRow(ctx, tx, row, received[i])
+			if err != nil {
+				return err
+			}
+		}
+		// whether the folder that the following contents belong to failed
+		folderFailed := false
+		for i, row := range rows {
+			if row.ItemTable == foldersTable {
+				folderFailed = fails[i]
+				continue
+			}
+			if folderPolicy == FolderPolicyCascade && folderFailed {
+				fails[i] = true
+				continue
+			}
+			fails[i], err = insertDeletedRow(ctx, tx, row, received[i])
+			if err != nil {
+				return err
+			}
+		}
+		if detailed {
+			conflicts, err = deletedConflicts(ctx, tx, rows, fails)
+		}
+		return err
+	})
+	fails, err = countInserts("deleted", fails, err)
+	return fails, conflicts, err
+}
+
+// inserts a single deleted row and only removes the home row if the deletion is not stale
+func insertDeletedRow(ctx context.Context, tx *sql.Tx, row models.RowDeleted, received int64) (fail bool, err error) {
+	fail, err = insertRow(ctx, tx, insertDeleted, row.UserID, row.ItemID, row.LastModified, row.LastUpdated, row.ItemTable, received)
+	if err != nil || fail {
+		return fail, err
+	}
+	return false, deleteRow(ctx, tx, row)
+}
+
+// home tables of deleted rows by their itemTable
+var itemTables = map[int16]string{
+	notesTable:     "notes",
+	remindersTable: "reminders",
+	dailyTable:     "daily_reminders",
+	weeklyTable:    "weekly_reminders",
+	monthlyTable:   "monthly_reminders",
+	yearlyTable:    "yearly_reminders",
+	overridesTable: "overrides",
+	foldersTable:   "folders",
+}
+
+func deleteRow(ctx context.Context, tx *sql.Tx, row models.RowDeleted) error {
+	switch row.ItemTable {
+	case notesTable, remindersTable, dailyTable, weeklyTable, monthlyTable, yearlyTable, overridesTable:
+		if _, err := tx.ExecContext(ctx, deleteItem(itemTables[row.ItemTable]), row.UserID, row.ItemID); err != nil {
+			return err
+		}
+	case foldersTable:
+		_, err := tx.ExecContext(ctx, deleteFolder, row.UserID, row.ItemID)
+		return err
+	}
+	// extensions share the itemID of their item, so the item's deleted row already covers them for other devices
+	if _, err := tx.ExecContext(ctx, deleteItem("extensions"), row.UserID, row.ItemID); err != nil {
+		return err
+	}
+	if row.ItemTable != overridesTable {
+		return deleteLinkedOverrides(ctx, tx, row)
+	}
+	return nil
+}
+
+// removes all overrides linked to a deleted item and adds a deleted row for each of them
+func deleteLinkedOverrides(ctx context.Context, tx *sql.Tx, row models.RowDeleted) error {
+	found, err := tx.QueryContext(ctx, deleteOverridesByLinkedItem, row.UserID, row.ItemID)
+	if err != nil {
+		return err
+	}
+	var overrideIDs []int64
+	for found.Next() {
+		var overrideID int64
+		if err = found.Scan(&overrideID); err != nil {
+			found.Close()
+			return err
+		}
+		overrideIDs = append(overrideIDs, overrideID)
+	}
+	found.Close()
+
+	for _, overrideID := range overrideIDs {
+		// the override was deleted along with its item, so the item's stored clock value decides against an older deletion of it
+		_, err = tx.ExecContext(ctx, insertDeleted, row.UserID, overrideID, row.LastModified, row.LastUpdated, overridesTable, row.LastModified)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if !found.Next() {
-			fails[i] = true
+		_, err = tx.ExecContext(ctx, deleteItem("extensions"), row.UserID, overrideID)
+		if err != nil {
+			return err
 		}
-		found.Close()
 	}
-	return fails, nil
+	return nil
 }
 
-func InsertExtensions(rows []models.RowExtensions) (fails []bool, err error) {
-	fails = make([]bool, len(rows))
+// idempotency keys
+
+// reserves the key for a request that is about to be executed, and reports false if another request already holds it
+func ReserveIdempotencyKey(ctx context.Context, userID int64, idempotencyKey string, requestHash []byte) (reserved bool, err error) {
+	now := utils.Now()
+	cutoff := now - (int64(idempotencyWindow) * 1000)
+	pendingCutoff := now - idempotencyPendingTimeout.Milliseconds()
+	row, err := db.QueryContext(ctx, idempotencyKeyReserve, userID, idempotencyKey, now, requestHash, cutoff, pendingCutoff)
+	if err != nil {
+		return false, err
+	}
+	defer row.Close()
+	return row.Next(), row.Err()
+}
+
+// retrieves the stored request hash and response for a user's idempotency key if it is still within the window
+// response is nil while the request holding the key is still being executed
+func GetIdempotentResponse(ctx context.Context, userID int64, idempotencyKey string) (requestHash []byte, response []byte, found bool, err error) {
+	cutoff := utils.Now() - (int64(idempotencyWindow) * 1000)
+	row, err := db.QueryContext(ctx, idempotencyKeyRead, userID, idempotencyKey, cutoff)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer row.Close()
+	if !row.Next() {
+		return nil, nil, false, nil
+	}
+	err = row.Scan(&requestHash, &response)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return requestHash, response, true, nil
+}
+
+// the request is already executed, so its response is stored even if the client is gone, which is when a retry needs it most
+func StoreIdempotentResponse(ctx context.Context, userID int64, idempotencyKey string, requestHash []byte, response []byte) error {
+	ctx = context.WithoutCancel(ctx)
+	_, err := db.ExecContext(ctx, idempotencyKeyStore, userID, idempotencyKey, requestHash, response)
+	return err
+}
+
+// frees a key whose request stopped before storing a response, so that a retry is executed instead of waiting on it
+func ReleaseIdempotencyKey(ctx context.Context, userID int64, idempotencyKey string, requestHash []byte) error {
+	ctx = context.WithoutCancel(ctx)
+	_, err := db.ExecContext(ctx, idempotencyKeyRelease, userID, idempotencyKey, requestHash)
+	return err
+}
+
+func ClearExpiredIdempotencyKeys(ctx context.Context) error {
+	cutoff := utils.Now() - (int64(idempotencyWindow) * 1000)
+	_, err := db.ExecContext(ctx, idempotencyKeysDeleteExpired, cutoff)
+	return err
+}
+
+// conflicts
+// each function returns the currently stored rows for every record that failed to insert, read in the transaction of the insert
+// a failed record with no stored row has no entry, so the conflicts are matched to the records by ID rather than by position
+
+func itemConflicts(ctx context.Context, tx *sql.Tx, tableName string, rows []models.RowItems, fails []bool) (conflicts []models.RowItems, err error) {
 	for i, row := range rows {
-		found, err := db.Query(insertExtension, row.UserID, row.ItemID, row.LastModified, row.LastUpdated, row.SequenceNum, row.EncryptedData)
+		if !fails[i] {
+			continue
+		}
+		sqlRows, err := tx.QueryContext(ctx, getItemRow(tableName), row.UserID, row.ItemID)
 		if err != nil {
 			return nil, err
 		}
-		if !found.Next() {
-			fails[i] = true
+		var conflict models.RowItems
+		if sqlRows.Next() {
+			err = sqlRows.Scan(&conflict.UserID, &conflict.ItemID, &conflict.LastModified, &conflict.LastUpdated, &conflict.EncryptedData)
+			if err == nil {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		sqlRows.Close()
+		if err != nil {
+			return nil, err
 		}
-		found.Close()
 	}
-	return fails, nil
+	return conflicts, nil
 }
 
-func InsertOverrides(rows []models.RowOverrides) (fails []bool, err error) {
-	fails = make([]bool, len(rows))
+func extensionConflicts(ctx context.Context, tx *sql.Tx, rows []models.RowExtensions, fails []bool) (conflicts []models.RowExtensions, err error) {
 	for i, row := range rows {
-		found, err := db.Query(insertOverride, row.UserID, row.ItemID, row.LastModified, row.LastUpdated, row.LinkedItemID, row.EncryptedData)
+		if !fails[i] {
+			continue
+		}
+		sqlRows, err := tx.QueryContext(ctx, getExtensionRow, row.UserID, row.ItemID, row.SequenceNum)
 		if err != nil {
 			return nil, err
 		}
-		if !found.Next() {
-			fails[i] = true
+		var conflict models.RowExtensions
+		if sqlRows.Next() {
+			err = sqlRows.Scan(&conflict.UserID, &conflict.ItemID, &conflict.LastModified, &conflict.LastUpdated, &conflict.SequenceNum, &conflict.EncryptedData)
+			if err == nil {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		sqlRows.Close()
+		if err != nil {
+			return nil, err
 		}
-		found.Close()
 	}
-	return fails, nil
+	return conflicts, nil
 }
 
-func InsertFolders(rows []models.RowFolders) (fails []bool, err error) {
-	fails = make([]bool, len(rows))
+func overrideConflicts(ctx context.Context, tx *sql.Tx, rows []models.RowOverrides, fails []bool) (conflicts []models.RowOverrides, err error) {
 	for i, row := range rows {
-		found, err := db.Query(insertFolder, row.UserID, row.FolderID, row.LastModified, row.LastUpdated, row.EncryptedData)
+		if !fails[i] {
+			continue
+		}
+		sqlRows, err := tx.QueryContext(ctx, getItemRow("overrides"), row.UserID, row.ItemID)
 		if err != nil {
 			return nil, err
 		}
-		if !found.Next() {
-			fails[i] = true
+		var conflict models.RowOverrides
+		if sqlRows.Next() {
+			err = sqlRows.Scan(&conflict.UserID, &conflict.ItemID, &conflict.LastModified, &conflict.LastUpdated, &conflict.LinkedItemID, &conflict.EncryptedData)
+			if err == nil {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		sqlRows.Close()
+		if err != nil {
+			return nil, err
 		}
-		found.Close()
 	}
-	return fails, nil
+	return conflicts, nil
 }
 
-// inserts received deleted rows and removes the row from its home table
-func InsertDeleted(rows []models.RowDeleted) (fails []bool, err error) {
-	fails = make([]bool, len(rows))
+func folderConflicts(ctx context.Context, tx *sql.Tx, rows []models.RowFolders, fails []bool) (conflicts []models.RowFolders, err error) {
 	for i, row := range rows {
-		found, err := db.Query(insertDeleted, row.UserID, row.ItemID, row.LastModified, row.LastUpdated, row.ItemTable)
+		if !fails[i] {
+			continue
+		}
+		sqlRows, err := tx.QueryContext(ctx, getFolderRow, row.UserID, row.FolderID)
 		if err != nil {
 			return nil, err
 		}
-		if !found.Next() {
-			fails[i] = true
+		var conflict models.RowFolders
+		if sqlRows.Next() {
+			err = sqlRows.Scan(&conflict.UserID, &conflict.FolderID, &conflict.LastModified, &conflict.LastUpdated, &conflict.EncryptedData)
+			if err == nil {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		sqlRows.Close()
+		if err != nil {
+			return nil, err
 		}
-		found.Close()
-		deleteRow(row)
 	}
-	return fails, nil
+	return conflicts, nil
 }
 
-func deleteRow(row models.RowDeleted) {
-	const notesTable int16 = 11
-	const remindersTable int16 = 12
-	const dailyTable int16 = 21
-	const weeklyTable int16 = 22
-	const monthlyTable int16 = 23
-	const yearlyTable int16 = 24
-	const overridesTable int16 = 31
-	const foldersTable int16 = 32
-	switch row.ItemTable {
-	case notesTable:
-		_, _ = db.Exec(deleteItem("notes"), row.UserID, row.ItemID)
-	case remindersTable:
-		_, _ = db.Exec(deleteItem("reminders"), row.UserID, row.ItemID)
-	case dailyTable:
-		_, _ = db.Exec(deleteItem("daily_reminders"), row.UserID, row.ItemID)
-	case weeklyTable:
-		_, _ = db.Exec(deleteItem("weekly_reminders"), row.UserID, row.ItemID)
-	case monthlyTable:
-		_, _ = db.Exec(deleteItem("monthly_reminders"), row.UserID, row.ItemID)
-	case yearlyTable:
-		_, _ = db.Exec(deleteItem("yearly_reminders"), row.UserID, row.ItemID)
-	case overridesTable:
-		_, _ = db.Exec(deleteItem("overrides"), row.UserID, row.ItemID)
-	case foldersTable:
-		_, _ = db.Exec(deleteFolder, row.UserID, row.ItemID)
+// deleted records rejected by a folder policy may have no stored row, and are left out
+func deletedConflicts(ctx context.Context, tx *sql.Tx, rows []models.RowDeleted, fails []bool) (conflicts []models.RowDeleted, err error) {
+	for i, row := range rows {
+		if !fails[i] {
+			continue
+		}
+		sqlRows, err := tx.QueryContext(ctx, getItemRow("deleted"), row.UserID, row.ItemID)
+		if err != nil {
+			return nil, err
+		}
+		var conflict models.RowDeleted
+		if sqlRows.Next() {
+			err = sqlRows.Scan(&conflict.UserID, &conflict.ItemID, &conflict.LastModified, &conflict.LastUpdated, &conflict.ItemTable)
+			if err == nil {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		sqlRows.Close()
+		if err != nil {
+			return nil, err
+		}
 	}
-	_, _ = db.Exec(deleteItem("extentions"), row.UserID, row.ItemID)
+	return conflicts, nil
 }
 
 // syncdown
 
-func GetItemRows(tableName string, userID int64, startTime int64, endTime int64) (rows []models.RowItems, err error) {
-	sqlRows, err := db.Query(getRows(tableName), userID, startTime, endTime)
+func GetItemRows(ctx context.Context, tableName string, userID int64, startTime int64, endTime int64) (rows []models.RowItems, err error) {
+	sqlRows, err := db.QueryContext(ctx, getRows(tableName), userID, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
@@ -239,11 +730,12 @@ func GetItemRows(tableName string, userID int64, startTime int64, endTime int64)
 	if err != nil {
 		return rows, err
 	}
+	syncdownRows.Observe(float64(len(rows)), tableName)
 	return rows, nil
 }
 
-func GetExtensionRows(userID int64, startTime int64, endTime int64) (rows []models.RowExtensions, err error) {
-	sqlRows, err := db.Query(getRows("extensions"), userID, startTime, endTime)
+func GetExtensionRows(ctx context.Context, userID int64, startTime int64, endTime int64) (rows []models.RowExtensions, err error) {
+	sqlRows, err := db.QueryContext(ctx, getRows("extensions"), userID, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
@@ -260,11 +752,12 @@ func GetExtensionRows(userID int64, startTime int64, endTime int64) (rows []mode
 	if err != nil {
 		return rows, err
 	}
+	syncdownRows.Observe(float64(len(rows)), "extensions")
 	return rows, nil
 }
 
-func GetOverrideRows(userID int64, startTime int64, endTime int64) (rows []models.RowOverrides, err error) {
-	sqlRows, err := db.Query(getRows("overrides"), userID, startTime, endTime)
+func GetOverrideRows(ctx context.Context, userID int64, startTime int64, endTime int64) (rows []models.RowOverrides, err error) {
+	sqlRows, err := db.QueryContext(ctx, getRows("overrides"), userID, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
@@ -281,11 +774,12 @@ func GetOverrideRows(userID int64, startTime int64, endTime int64) (rows []model
 	if err != nil {
 		return rows, err
 	}
+	syncdownRows.Observe(float64(len(rows)), "overrides")
 	return rows, nil
 }
 
-func GetFolderRows(userID int64, startTime int64, endTime int64) (rows []models.RowFolders, err error) {
-	sqlRows, err := db.Query(getRows("folders"), userID, startTime, endTime)
+func GetFolderRows(ctx context.Context, userID int64, startTime int64, endTime int64) (rows []models.RowFolders, err error) {
+	sqlRows, err := db.QueryContext(ctx, getRows("folders"), userID, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
@@ -302,11 +796,12 @@ func GetFolderRows(userID int64, startTime int64, endTime int64) (rows []models.
 	if err != nil {
 		return rows, err
 	}
+	syncdownRows.Observe(float64(len(rows)), "folders")
 	return rows, nil
 }
 
-func GetDeletedRows(userID int64, startTime int64, endTime int64) (rows []models.RowDeleted, err error) {
-	sqlRows, err := db.Query(getRows("deleted"), userID, startTime, endTime)
+func GetDeletedRows(ctx context.Context, userID int64, startTime int64, endTime int64) (rows []models.RowDeleted, err error) {
+	sqlRows, err := db.QueryContext(ctx, getRows("deleted"), userID, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
@@ -323,5 +818,6 @@ func GetDeletedRows(userID int64, startTime int64, endTime int64) (rows []models
 	if err != nil {
 		return rows, err
 	}
+	syncdownRows.Observe(float64(len(rows)), "deleted")
 	return rows, nil
 }
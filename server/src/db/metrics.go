@@ -0,0 +1,92 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file declares the metrics of the database, covering syncup and syncdown records, token checks, and the connection pool.
+ * They are served with the rest of the metrics by the services package.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"openorganizer/src/utils"
+)
+
+var syncupRecords = utils.NewCounter("openorganizer_syncup_records_total",
+	"Records received by syncup, by table and result, which is inserted, conflict, or error.", "table", "result")
+var syncdownRows = utils.NewHistogram("openorganizer_syncdown_rows",
+	"Rows returned by each syncdown, by table.", []float64{0, 1, 10, 100, 1000, 10000}, "table")
+var tokenValidations = utils.NewCounter("openorganizer_token_validations_total",
+	"Token checks of authenticated requests, by result, which is valid, expired, invalid, mismatch for a token bound to another client certificate, uncertified for a bound token used without one, or error when the database fails.", "result")
+
+// counts every record of a batch once it is committed or rolled back, which either failed with an error, was rejected as a conflict, or was inserted
+// a rolled back batch stores none of its records, so all of them count as errors
+func countInserts(table string, fails []bool, err error) ([]bool, error) {
+	for _, fail := range fails {
+		switch {
+		case err != nil:
+			syncupRecords.Inc(table, "error")
+		case fail:
+			syncupRecords.Inc(table, "conflict")
+		default:
+			syncupRecords.Inc(table, "inserted")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fails, nil
+}
+
+var errNotConnected = errors.New("database is not connected")
+
+// reads one value of the pool's statistics
+func poolStat(stat func(stats sql.DBStats) float64) func(ctx context.Context) (float64, error) {
+	return func(ctx context.Context) (float64, error) {
+		if db == nil {
+			return 0, errNotConnected
+		}
+		return stat(db.Stats()), nil
+	}
+}
+
+func init() {
+	utils.NewGaugeFunc("openorganizer_active_tokens", "Tokens that have not expired yet.", countActiveTokens)
+
+	utils.NewGaugeFunc("openorganizer_db_max_open_connections", "Limit of open connections to the database, 0 for no limit.",
+		poolStat(func(stats sql.DBStats) float64 { return float64(stats.MaxOpenConnections) }))
+	utils.NewGaugeFunc("openorganizer_db_open_connections", "Connections to the database, in use or idle.",
+		poolStat(func(stats sql.DBStats) float64 { return float64(stats.OpenConnections) }))
+	utils.NewGaugeFunc("openorganizer_db_in_use_connections", "Connections to the database in use.",
+		poolStat(func(stats sql.DBStats) float64 { return float64(stats.InUse) }))
+	utils.NewGaugeFunc("openorganizer_db_idle_connections", "Idle connections to the database.",
+		poolStat(func(stats sql.DBStats) float64 { return float64(stats.Idle) }))
+	utils.NewCounterFunc("openorganizer_db_wait_count_total", "Times a query waited for a free connection.",
+		poolStat(func(stats sql.DBStats) float64 { return float64(stats.WaitCount) }))
+	utils.NewCounterFunc("openorganizer_db_wait_duration_seconds_total", "Time queries spent waiting for a free connection.",
+		poolStat(func(stats sql.DBStats) float64 { return stats.WaitDuration.Seconds() }))
+	utils.NewCounterFunc("openorganizer_db_max_idle_closed_total", "Connections closed because too many were idle.",
+		poolStat(func(stats sql.DBStats) float64 { return float64(stats.MaxIdleClosed) }))
+	utils.NewCounterFunc("openorganizer_db_max_idle_time_closed_total", "Connections closed because they were idle for too long.",
+		poolStat(func(stats sql.DBStats) float64 { return float64(stats.MaxIdleTimeClosed) }))
+	utils.NewCounterFunc("openorganizer_db_max_lifetime_closed_total", "Connections closed because they reached their max lifetime.",
+		poolStat(func(stats sql.DBStats) float64 { return float64(stats.MaxLifetimeClosed) }))
+}
+
+func countActiveTokens(ctx context.Context) (float64, error) {
+	if db == nil {
+		return 0, errNotConnected
+	}
+	var count int64
+	err := db.QueryRowContext(ctx, tokensCountActive, utils.Now()).Scan(&count)
+	return float64(count), err
+}
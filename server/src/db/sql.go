@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-09-20
- * Updated: 2025-10-19
+ * Updated: 2026-10-19
  *
  * This file declares const values and defines functions for SQL statements to store and retrieve from the database.
  *
@@ -31,6 +31,7 @@ CREATE TABLE IF NOT EXISTS tokens (
 	creationTime BIGINT,
 	expirationTime BIGINT,
 	authToken BYTEA,
+	certFingerprint BYTEA,
 	PRIMARY KEY(userID, creationTime)
 );`
 
@@ -105,6 +106,21 @@ CREATE TABLE IF NOT EXISTS deleted (
 	PRIMARY KEY(userID, itemID)
 );`
 
+const createTableIdempotencyKeys = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	userID BIGINT,
+	idempotencyKey TEXT,
+	creationTime BIGINT,
+	requestHash BYTEA,
+	response BYTEA,
+	PRIMARY KEY(userID, idempotencyKey)
+);`
+
+const createTableSchemaVersion = `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version INT
+);`
+
 const dropAllAuth = `
 DROP TABLE IF EXISTS users;
 DROP TABLE IF EXISTS tokens;
@@ -122,6 +138,46 @@ DROP TABLE IF EXISTS extensions;
 DROP TABLE IF EXISTS overrides;
 DROP TABLE IF EXISTS folders;
 DROP TABLE IF EXISTS deleted;
+DROP TABLE IF EXISTS idempotency_keys;
+`
+
+// migrations
+
+const schemaVersionRead = `
+SELECT version FROM schema_version;
+`
+
+const schemaVersionCreate = `
+INSERT INTO schema_version VALUES ($1);
+`
+
+const schemaVersionUpdate = `
+UPDATE schema_version SET version = $1;
+`
+
+const migrationNoTimeout = `
+SET LOCAL statement_timeout = 0;
+`
+
+// version 0 -> 1, lastModified goes from milliseconds to hybrid logical clock values
+// every data table is rewritten in the one transaction, and there is no migration back, since a value shifted back would lose its logical counter
+// servers older than this version read the shifted values as milliseconds far in the future, so every instance has to be upgraded together and the database backed up first
+const migrateLastModifiedToClock = `
+UPDATE notes SET lastModified = lastModified << 16;
+UPDATE reminders SET lastModified = lastModified << 16;
+UPDATE daily_reminders SET lastModified = lastModified << 16;
+UPDATE weekly_reminders SET lastModified = lastModified << 16;
+UPDATE monthly_reminders SET lastModified = lastModified << 16;
+UPDATE yearly_reminders SET lastModified = lastModified << 16;
+UPDATE extensions SET lastModified = lastModified << 16;
+UPDATE overrides SET lastModified = lastModified << 16;
+UPDATE folders SET lastModified = lastModified << 16;
+UPDATE deleted SET lastModified = lastModified << 16;
+`
+
+// version 1 -> 2, tokens may be bound to the fingerprint of a client certificate
+const migrateTokenFingerprint = `
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS certFingerprint BYTEA;
 `
 
 // users
@@ -166,16 +222,17 @@ DELETE FROM extensions WHERE userID = $1;
 DELETE FROM overrides WHERE userID = $1;
 DELETE FROM folders WHERE userID = $1;
 DELETE FROM deleted WHERE userID = $1;
+DELETE FROM idempotency_keys WHERE userID = $1;
 `
 
 // tokens
 
 const tokensCreate = `
-INSERT INTO tokens VALUES ($1, $2, $3, $4);
+INSERT INTO tokens (userID, creationTime, expirationTime, authToken, certFingerprint) VALUES ($1, $2, $3, $4, $5);
 `
 
-const tokenReadTimes = `
-SELECT creationTime, expirationTime FROM tokens WHERE userID = $1 AND authToken = $2;
+const tokenRead = `
+SELECT creationTime, expirationTime, certFingerprint FROM tokens WHERE userID = $1 AND authToken = $2;
 `
 
 const tokenUpdateExpiration = `
@@ -190,6 +247,10 @@ const tokensDeleteExpiredByTime = `
 DELETE FROM tokens WHERE expirationTime < $1;
 `
 
+const tokensCountActive = `
+SELECT COUNT(*) FROM tokens WHERE expirationTime >= $1;
+`
+
 // last updated
 
 const lastupCreate = `
@@ -208,7 +269,7 @@ const lastupDelete = `
 DELETE FROM last_updated WHERE userID = $1;
 `
 
-// syncup
+// syncup, where a record replaces the stored row if the lastModified the client sent is after the server clock value the row was stored with
 
 func insertItem(tableName string) string {
 	return `
@@ -216,7 +277,7 @@ INSERT INTO ` + tableName + ` (userID, itemID, lastModified, lastUpdated, encryp
 VALUES ($1, $2, $3, $4, $5)
 ON CONFLICT (userID, itemID) DO UPDATE
 SET lastModified = $3, lastUpdated = $4, encryptedData = $5
-WHERE ` + tableName + `.lastModified < $3
+WHERE ` + tableName + `.lastModified < $6
 RETURNING *;
 `
 }
@@ -226,7 +287,7 @@ INSERT INTO extensions (userID, itemID, lastModified, lastUpdated, sequenceNum,
 VALUES ($1, $2, $3, $4, $5, $6)
 ON CONFLICT (userID, itemID, sequenceNum) DO UPDATE
 SET lastModified = $3, lastUpdated = $4, encryptedData = $6
-WHERE extensions.lastModified < $3
+WHERE extensions.lastModified < $7
 RETURNING *;
 `
 
@@ -235,7 +296,7 @@ INSERT INTO overrides (userID, itemID, lastModified, lastUpdated, linkedItemID,
 VALUES ($1, $2, $3, $4, $5, $6)
 ON CONFLICT (userID, itemID) DO UPDATE
 SET lastModified = $3, lastUpdated = $4, linkedItemID = $5, encryptedData = $6
-WHERE overrides.lastModified < $3
+WHERE overrides.lastModified < $7
 RETURNING *;
 `
 
@@ -244,7 +305,7 @@ INSERT INTO folders (userID, folderID, lastModified, lastUpdated, encryptedData)
 VALUES ($1, $2, $3, $4, $5)
 ON CONFLICT (userID, folderID) DO UPDATE
 SET lastModified = $3, lastUpdated = $4, encryptedData = $5
-WHERE folders.lastModified < $3
+WHERE folders.lastModified < $6
 RETURNING *;
 `
 
@@ -253,7 +314,7 @@ INSERT INTO deleted (userID, itemID, lastModified, lastUpdated, itemTable)
 VALUES ($1, $2, $3, $4, $5)
 ON CONFLICT (userID, itemID) DO UPDATE
 SET lastModified = $3, lastUpdated = $4, itemTable = $5
-WHERE deleted.lastModified < $3
+WHERE deleted.lastModified < $6
 RETURNING *;
 `
 
@@ -263,10 +324,80 @@ DELETE FROM ` + tableName + ` WHERE userID = $1 AND itemID = $2;
 `
 }
 
+const deleteOverridesByLinkedItem = `
+DELETE FROM overrides WHERE userID = $1 AND linkedItemID = $2 RETURNING itemID;
+`
+
 const deleteFolder = `
 DELETE FROM folders WHERE userID = $1 AND folderID = $2;
 `
 
+// the latest clock value stored in any data table, which the server clock starts from
+const latestClock = `
+SELECT GREATEST(
+	(SELECT MAX(lastModified) FROM notes),
+	(SELECT MAX(lastModified) FROM reminders),
+	(SELECT MAX(lastModified) FROM daily_reminders),
+	(SELECT MAX(lastModified) FROM weekly_reminders),
+	(SELECT MAX(lastModified) FROM monthly_reminders),
+	(SELECT MAX(lastModified) FROM yearly_reminders),
+	(SELECT MAX(lastModified) FROM extensions),
+	(SELECT MAX(lastModified) FROM overrides),
+	(SELECT MAX(lastModified) FROM folders),
+	(SELECT MAX(lastModified) FROM deleted)
+);
+`
+
+// idempotency keys
+
+// a pending key has no response yet, and is taken over once it expired or its request never finished
+const idempotencyKeyReserve = `
+INSERT INTO idempotency_keys VALUES ($1, $2, $3, $4, NULL)
+ON CONFLICT (userID, idempotencyKey) DO UPDATE
+SET creationTime = $3, requestHash = $4, response = NULL
+WHERE idempotency_keys.creationTime < $5 OR (idempotency_keys.response IS NULL AND idempotency_keys.creationTime < $6)
+RETURNING userID;
+`
+
+const idempotencyKeyStore = `
+UPDATE idempotency_keys SET response = $4
+WHERE userID = $1 AND idempotencyKey = $2 AND requestHash = $3 AND response IS NULL;
+`
+
+const idempotencyKeyRelease = `
+DELETE FROM idempotency_keys WHERE userID = $1 AND idempotencyKey = $2 AND requestHash = $3 AND response IS NULL;
+`
+
+const idempotencyKeyRead = `
+SELECT requestHash, response FROM idempotency_keys WHERE userID = $1 AND idempotencyKey = $2 AND creationTime >= $3;
+`
+
+const idempotencyKeysDeleteExpired = `
+DELETE FROM idempotency_keys WHERE creationTime < $1;
+`
+
+// changes
+
+const notifyChange = `
+SELECT pg_notify($1, $2);
+`
+
+// conflicts, retrieving the stored row that won against a rejected record
+
+func getItemRow(tableName string) string {
+	return `
+SELECT * FROM ` + tableName + ` WHERE userID = $1 AND itemID = $2;
+`
+}
+
+const getExtensionRow = `
+SELECT * FROM extensions WHERE userID = $1 AND itemID = $2 AND sequenceNum = $3;
+`
+
+const getFolderRow = `
+SELECT * FROM folders WHERE userID = $1 AND folderID = $2;
+`
+
 // syncdown of any table for a given user and within a time frame
 func getRows(tableName string) string {
 	return `
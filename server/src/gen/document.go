@@ -0,0 +1,108 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file writes the protocol document, which lists the body of every endpoint and the byte offsets of every layout in the schema.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+func anchor(name string) string {
+	return "[" + name + "](#" + strings.ToLower(name) + ")"
+}
+
+func (g *generator) document(schemaPath string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<!-- Code generated by src/gen from schema/%s. DO NOT EDIT. -->\n\n", filepath.Base(schemaPath))
+	fmt.Fprintf(&b, "# OpenOrganizer Binary Protocol\n\n%s\n\n", g.schema.Doc)
+	fmt.Fprintf(&b, "Every endpoint also accepts and returns the same structures as JSON or Protobuf, see `server/src/models/messages.proto`.\n\n")
+
+	fmt.Fprintf(&b, "## Types\n\n| Type | Encoding |\n| --- | --- |\n")
+	for _, t := range typeDocs {
+		fmt.Fprintf(&b, "| %s | %s |\n", t.name, t.doc)
+	}
+	fmt.Fprintf(&b, "| layout | Another layout, inline. |\n")
+	for _, f := range g.schema.Formats {
+		fmt.Fprintf(&b, "| %s | %s |\n", f.Name, f.Doc)
+	}
+
+	fmt.Fprintf(&b, "\n## Endpoints\n\nOther methods are answered with MethodNotAllowed and an Allow header, and OPTIONS with the Allow header alone.\n\n")
+	fmt.Fprintf(&b, "| Methods | Route | Request | Response | Notes |\n| --- | --- | --- | --- | --- |\n")
+	for _, e := range g.schema.Endpoints {
+		fmt.Fprintf(&b, "| %s | `%s` | %s | %s | %s |\n", strings.Join(e.Methods, ", "), e.Route, g.bodyLink(e.Request), g.bodyLink(e.Response), e.Doc)
+	}
+
+	fmt.Fprintf(&b, "\n## Errors\n\nEvery error response is an [ErrorResponse](#errorresponse) in the negotiated codec, sent with the status of its code.\n\n")
+	fmt.Fprintf(&b, "| Code | Name | Status | Meaning |\n| --- | --- | --- | --- |\n")
+	for _, e := range g.schema.Errors {
+		fmt.Fprintf(&b, "| %v | %s | %v | %s |\n", e.Code, e.Name, e.Status, e.Doc)
+	}
+
+	fmt.Fprintf(&b, "\n## Layouts\n")
+	for i := range g.schema.Layouts {
+		l := &g.schema.Layouts[i]
+		fmt.Fprintf(&b, "\n### %s\n\n", l.Name)
+		if l.Doc != "" {
+			fmt.Fprintf(&b, "%s\n\n", l.Doc)
+		}
+		if size, fixed := g.size(l); fixed {
+			fmt.Fprintf(&b, "%v bytes.\n\n", size)
+		} else {
+			fmt.Fprintf(&b, "Variable size.\n\n")
+		}
+
+		// offsets are only known up to the first variable size field
+		fmt.Fprintf(&b, "| Offset | Size | Field | Type | Notes |\n| --- | --- | --- | --- | --- |\n")
+		offset, fixedOffset := 0, true
+		for _, f := range l.Fields {
+			size, fixed := g.fieldSize(f)
+			offsetText, sizeText := "", ""
+			if fixedOffset {
+				offsetText = fmt.Sprint(offset)
+			}
+			if fixed {
+				sizeText = fmt.Sprint(size)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", offsetText, sizeText, f.Name, g.typeText(f), f.Doc)
+			offset += size
+			fixedOffset = fixedOffset && fixed
+		}
+	}
+	return b.Bytes()
+}
+
+func (g *generator) bodyLink(body string) string {
+	if body == "" {
+		return "none"
+	}
+	// formats are described in the types table rather than under their own heading
+	if g.layouts[body] == nil {
+		return body
+	}
+	return anchor(body)
+}
+
+func (g *generator) typeText(f field) string {
+	switch f.Type {
+	case "layout":
+		return anchor(f.Layout)
+	case "list8", "list32":
+		if f.Of == "string8" {
+			return f.Type + " of string8"
+		}
+		return f.Type + " of " + anchor(f.Of)
+	}
+	return f.Type
+}
@@ -0,0 +1,37 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file writes the error code catalogue, with the HTTP status every code is sent with.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+)
+
+func (g *generator) goErrors(schemaPath string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by src/gen from schema/%s. DO NOT EDIT.\n\n", filepath.Base(schemaPath))
+	fmt.Fprintf(&b, "package models\n\n")
+	fmt.Fprintf(&b, "// sent in every error response, so that clients do not depend on the message\ntype ErrorCode uint16\n\n")
+	fmt.Fprintf(&b, "const (\n")
+	for _, e := range g.schema.Errors {
+		fmt.Fprintf(&b, "// %s\nError%s ErrorCode = %v\n", e.Doc, e.Name, e.Code)
+	}
+	fmt.Fprintf(&b, ")\n\n")
+	fmt.Fprintf(&b, "// the HTTP status sent with each error code\nvar ErrorStatus = map[ErrorCode]int{\n")
+	for _, e := range g.schema.Errors {
+		fmt.Fprintf(&b, "Error%s: %v,\n", e.Name, e.Status)
+	}
+	fmt.Fprintf(&b, "}\n")
+	return b.Bytes()
+}
@@ -0,0 +1,205 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file writes the pack and unpack functions and size constants of every layout in the schema.
+ * Fixed size fields are unpacked at their offsets, and everything after a variable size field is unpacked from the rest of the buffer.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+func (g *generator) goSource(schemaPath string) []byte {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "// sizes in bytes of the fixed size layouts\n\nconst (\n")
+	for i := range g.schema.Layouts {
+		l := &g.schema.Layouts[i]
+		if size, fixed := g.size(l); fixed {
+			fmt.Fprintf(&body, "%sSize = %v\n", l.Name, size)
+		}
+	}
+	fmt.Fprintf(&body, ")\n")
+	for i := range g.schema.Layouts {
+		l := &g.schema.Layouts[i]
+		fmt.Fprintf(&body, "\n// %s\n\n", l.Name)
+		g.writePack(&body, l)
+		g.writeUnpack(&body, l)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by src/gen from schema/%s. DO NOT EDIT.\n\n", filepath.Base(schemaPath))
+	fmt.Fprintf(&b, "package utils\n\nimport (\n\"encoding/binary\"\n")
+	// only layouts with strings, lists, or pointers need these
+	for _, pkg := range []string{"errors", "math"} {
+		if bytes.Contains(body.Bytes(), []byte(pkg+".")) {
+			fmt.Fprintf(&b, "%q\n", pkg)
+		}
+	}
+	fmt.Fprintf(&b, "\n\"openorganizer/src/models\"\n)\n\n")
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+func (g *generator) writePack(b *bytes.Buffer, l *layout) {
+	model := goModel(l.Model)
+	canFail := g.canFail(l)
+	if canFail {
+		fmt.Fprintf(b, "func Pack%s(value %s) ([]byte, error) {\nreturn pack%s(nil, value)\n}\n\n", l.Name, model, l.Name)
+		fmt.Fprintf(b, "func pack%s(buffer []byte, value %s) (_ []byte, err error) {\n", l.Name, model)
+	} else {
+		fmt.Fprintf(b, "func Pack%s(value %s) []byte {\nreturn pack%s(nil, value)\n}\n\n", l.Name, model, l.Name)
+		fmt.Fprintf(b, "func pack%s(buffer []byte, value %s) []byte {\n", l.Name, model)
+	}
+	for _, f := range l.Fields {
+		g.writePackField(b, f, "value."+f.Go)
+	}
+	if canFail {
+		fmt.Fprintf(b, "return buffer, err\n}\n\n")
+	} else {
+		fmt.Fprintf(b, "return buffer\n}\n\n")
+	}
+}
+
+func (g *generator) writePackField(b *bytes.Buffer, f field, value string) {
+	switch f.Type {
+	case "int16":
+		fmt.Fprintf(b, "buffer = binary.LittleEndian.AppendUint16(buffer, uint16(%s))\n", value)
+	case "int32":
+		fmt.Fprintf(b, "buffer = binary.LittleEndian.AppendUint32(buffer, uint32(%s))\n", value)
+	case "int64":
+		fmt.Fprintf(b, "buffer = binary.LittleEndian.AppendUint64(buffer, uint64(%s))\n", value)
+	case "uint16":
+		fmt.Fprintf(b, "buffer = binary.LittleEndian.AppendUint16(buffer, uint16(%s))\n", value)
+	case "uint32":
+		fmt.Fprintf(b, "buffer = binary.LittleEndian.AppendUint32(buffer, uint32(%s))\n", value)
+	case "bytes":
+		fmt.Fprintf(b, "if err = checkSize(%s, %v, %q); err != nil {\nreturn nil, err\n}\n", value, f.Size, f.Name)
+		fmt.Fprintf(b, "buffer = append(buffer, %s...)\n", value)
+	case "string8":
+		fmt.Fprintf(b, "if len(%s) > math.MaxUint8 {\nreturn nil, errors.New(%q)\n}\n", value, f.Name+" is longer than 255 bytes")
+		fmt.Fprintf(b, "buffer = append(buffer, byte(len(%s)))\nbuffer = append(buffer, %s...)\n", value, value)
+	case "string16":
+		fmt.Fprintf(b, "if len(%s) > math.MaxUint16 {\nreturn nil, errors.New(%q)\n}\n", value, f.Name+" is longer than 65535 bytes")
+		fmt.Fprintf(b, "buffer = binary.LittleEndian.AppendUint16(buffer, uint16(len(%s)))\nbuffer = append(buffer, %s...)\n", value, value)
+	case "layout":
+		nested := g.layouts[f.Layout]
+		if f.Pointer {
+			fmt.Fprintf(b, "if %s == nil {\nreturn nil, errors.New(%q)\n}\n", value, f.Name+" is required")
+			value = "*" + value
+		}
+		if g.canFail(nested) {
+			fmt.Fprintf(b, "if buffer, err = pack%s(buffer, %s); err != nil {\nreturn nil, err\n}\n", nested.Name, value)
+		} else {
+			fmt.Fprintf(b, "buffer = pack%s(buffer, %s)\n", nested.Name, value)
+		}
+	case "list8", "list32":
+		if f.Type == "list8" {
+			fmt.Fprintf(b, "if len(%s) > math.MaxUint8 {\nreturn nil, errors.New(%q)\n}\n", value, f.Name+" has more than 255 elements")
+			fmt.Fprintf(b, "buffer = append(buffer, byte(len(%s)))\n", value)
+		} else {
+			fmt.Fprintf(b, "buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(%s)))\n", value)
+		}
+		fmt.Fprintf(b, "for _, element := range %s {\n", value)
+		if f.Of == "string8" {
+			g.writePackField(b, field{Name: f.Name, Type: "string8"}, "element")
+		} else {
+			g.writePackField(b, field{Name: f.Name, Type: "layout", Layout: f.Of}, "element")
+		}
+		fmt.Fprintf(b, "}\n")
+	}
+}
+
+// unpacking assumes the buffer was already checked to be the right size
+func (g *generator) writeUnpack(b *bytes.Buffer, l *layout) {
+	model := goModel(l.Model)
+	fmt.Fprintf(b, "func Unpack%s(buffer []byte) (value %s) {\nvalue, _ = unpack%s(buffer)\nreturn value\n}\n\n", l.Name, model, l.Name)
+	fmt.Fprintf(b, "func unpack%s(buffer []byte) (value %s, rest []byte) {\n", l.Name, model)
+	offset := 0
+	for _, f := range l.Fields {
+		size, fixed := g.fieldSize(f)
+		if !fixed {
+			if offset > 0 {
+				fmt.Fprintf(b, "buffer = buffer[%v:]\n", offset)
+				offset = 0
+			}
+			g.writeUnpackVariable(b, f, "value."+f.Go)
+			continue
+		}
+		span := fmt.Sprintf("buffer[%v:%v]", offset, offset+size)
+		g.writeUnpackFixed(b, f, "value."+f.Go, span)
+		offset += size
+	}
+	if offset > 0 {
+		fmt.Fprintf(b, "return value, buffer[%v:]\n}\n", offset)
+	} else {
+		fmt.Fprintf(b, "return value, buffer\n}\n")
+	}
+}
+
+func (g *generator) writeUnpackFixed(b *bytes.Buffer, f field, value string, span string) {
+	if f.GoType != "" {
+		fmt.Fprintf(b, "%s = models.%s(binary.LittleEndian.Uint%s(%s))\n", value, f.GoType, strings.TrimLeft(f.Type, "uint"), span)
+		return
+	}
+	switch f.Type {
+	case "int16":
+		fmt.Fprintf(b, "%s = int16(binary.LittleEndian.Uint16(%s))\n", value, span)
+	case "int32":
+		fmt.Fprintf(b, "%s = int32(binary.LittleEndian.Uint32(%s))\n", value, span)
+	case "int64":
+		fmt.Fprintf(b, "%s = int64(binary.LittleEndian.Uint64(%s))\n", value, span)
+	case "uint16":
+		fmt.Fprintf(b, "%s = binary.LittleEndian.Uint16(%s)\n", value, span)
+	case "uint32":
+		fmt.Fprintf(b, "%s = binary.LittleEndian.Uint32(%s)\n", value, span)
+	case "bytes":
+		fmt.Fprintf(b, "%s = %s\n", value, span)
+	case "layout":
+		nested := g.layouts[f.Layout]
+		if f.Pointer {
+			fmt.Fprintf(b, "%s = new(%s)\n", value, goModel(nested.Model))
+			value = "*" + value
+		}
+		fmt.Fprintf(b, "%s, _ = unpack%s(%s)\n", value, nested.Name, span)
+	}
+}
+
+func (g *generator) writeUnpackVariable(b *bytes.Buffer, f field, value string) {
+	switch f.Type {
+	case "string8":
+		fmt.Fprintf(b, "%s = string(buffer[1 : 1+int(buffer[0])])\nbuffer = buffer[1+int(buffer[0]):]\n", value)
+	case "string16":
+		fmt.Fprintf(b, "%s = string(buffer[2 : 2+int(binary.LittleEndian.Uint16(buffer))])\nbuffer = buffer[2+int(binary.LittleEndian.Uint16(buffer)):]\n", value)
+	case "layout":
+		nested := g.layouts[f.Layout]
+		if f.Pointer {
+			fmt.Fprintf(b, "%s = new(%s)\n", value, goModel(nested.Model))
+			value = "*" + value
+		}
+		fmt.Fprintf(b, "%s, buffer = unpack%s(buffer)\n", value, nested.Name)
+	case "list8", "list32":
+		if f.Type == "list8" {
+			fmt.Fprintf(b, "%s = make([]%s, buffer[0])\nbuffer = buffer[1:]\n", value, g.goElement(f.Of))
+		} else {
+			fmt.Fprintf(b, "%s = make([]%s, binary.LittleEndian.Uint32(buffer[0:4]))\nbuffer = buffer[4:]\n", value, g.goElement(f.Of))
+		}
+		fmt.Fprintf(b, "for i := range %s {\n", value)
+		if f.Of == "string8" {
+			g.writeUnpackVariable(b, field{Type: "string8"}, value+"[i]")
+		} else {
+			fmt.Fprintf(b, "%s[i], buffer = unpack%s(buffer)\n", value, f.Of)
+		}
+		fmt.Fprintf(b, "}\n")
+	}
+}
@@ -0,0 +1,270 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file is the generator for the binary protocol, run with go generate from the utils package.
+ * It reads the layouts in schema/protocol.json and writes their pack and unpack functions and size constants, the error code catalogue, and the protocol document describing them.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+)
+
+type schema struct {
+	Doc       string       `json:"doc"`
+	Layouts   []layout     `json:"layouts"`
+	Endpoints []endpoint   `json:"endpoints"`
+	Formats   []bodyFormat `json:"formats"`
+	Errors    []errorCode  `json:"errors"`
+}
+
+type layout struct {
+	Name   string  `json:"name"`
+	Model  string  `json:"model"`
+	Doc    string  `json:"doc"`
+	Fields []field `json:"fields"`
+}
+
+type field struct {
+	Name    string `json:"name"`
+	Go      string `json:"go"`
+	Type    string `json:"type"`
+	Size    int    `json:"size"`    // bytes only
+	Layout  string `json:"layout"`  // layout only
+	Pointer bool   `json:"pointer"` // layout only
+	Of      string `json:"of"`      // lists only, a layout or string8
+	GoType  string `json:"goType"`  // integers only, for named types in models
+	Doc     string `json:"doc"`
+}
+
+type endpoint struct {
+	Route    string   `json:"route"`
+	Methods  []string `json:"methods"`
+	Request  string   `json:"request"`
+	Response string   `json:"response"`
+	Doc      string   `json:"doc"`
+}
+
+// bodies that are not a layout, documented by hand
+type bodyFormat struct {
+	Name string `json:"name"`
+	Doc  string `json:"doc"`
+}
+
+// error codes are stable once released, so codes are only ever added
+type errorCode struct {
+	Code   uint16 `json:"code"`
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	Doc    string `json:"doc"`
+}
+
+// sizes of the fixed size field types
+var typeSizes = map[string]int{
+	"int16":  2,
+	"int32":  4,
+	"int64":  8,
+	"uint16": 2,
+	"uint32": 4,
+}
+
+var typeDocs = []struct{ name, doc string }{
+	{"int16, int32, int64", "Signed integer of 2, 4, or 8 bytes."},
+	{"uint16, uint32", "Unsigned integer of 2 or 4 bytes."},
+	{"bytes", "Exactly the given number of bytes."},
+	{"string8", "1 byte length followed by that many bytes of text."},
+	{"string16", "uint16 length followed by that many bytes of text."},
+	{"list8", "1 byte count followed by that many elements."},
+	{"list32", "uint32 count followed by that many elements."},
+}
+
+func main() {
+	schemaPath := flag.String("schema", "", "path of the schema to read")
+	goPath := flag.String("go", "", "path of the Go file to write")
+	errorsPath := flag.String("errors", "", "path of the Go file to write the error codes to")
+	docPath := flag.String("doc", "", "path of the Markdown document to write")
+	flag.Parse()
+
+	data, err := os.ReadFile(*schemaPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var s schema
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&s); err != nil {
+		log.Fatalf("%s: %v", *schemaPath, err)
+	}
+	g := generator{schema: s, layouts: map[string]*layout{}}
+	if err = g.validate(); err != nil {
+		log.Fatalf("%s: %v", *schemaPath, err)
+	}
+
+	code, err := format.Source(g.goSource(*schemaPath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = os.WriteFile(*goPath, code, 0644); err != nil {
+		log.Fatal(err)
+	}
+	code, err = format.Source(g.goErrors(*schemaPath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = os.WriteFile(*errorsPath, code, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err = os.WriteFile(*docPath, g.document(*schemaPath), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type generator struct {
+	schema  schema
+	layouts map[string]*layout
+}
+
+// layouts may only refer to layouts declared before them, so there are no cycles
+func (g *generator) validate() error {
+	for i := range g.schema.Layouts {
+		l := &g.schema.Layouts[i]
+		if l.Name == "" || l.Model == "" || len(l.Fields) == 0 {
+			return fmt.Errorf("layout %v needs a name, model, and fields", i)
+		}
+		if g.layouts[l.Name] != nil {
+			return fmt.Errorf("layout %s is declared twice", l.Name)
+		}
+		for _, f := range l.Fields {
+			if err := g.validateField(f); err != nil {
+				return fmt.Errorf("layout %s field %s: %w", l.Name, f.Name, err)
+			}
+		}
+		g.layouts[l.Name] = l
+	}
+
+	codes, names := map[uint16]bool{}, map[string]bool{}
+	for _, e := range g.schema.Errors {
+		if e.Name == "" || codes[e.Code] || names[e.Name] {
+			return fmt.Errorf("error %v %s needs a unique code and name", e.Code, e.Name)
+		}
+		if e.Status < 400 || e.Status > 599 {
+			return fmt.Errorf("error %s needs a 4xx or 5xx status", e.Name)
+		}
+		codes[e.Code], names[e.Name] = true, true
+	}
+
+	formats := map[string]bool{}
+	for _, f := range g.schema.Formats {
+		formats[f.Name] = true
+	}
+	for _, e := range g.schema.Endpoints {
+		if len(e.Methods) == 0 {
+			return fmt.Errorf("endpoint %s needs at least one method", e.Route)
+		}
+		for _, body := range []string{e.Request, e.Response} {
+			if body != "" && g.layouts[body] == nil && !formats[body] {
+				return fmt.Errorf("endpoint %s refers to unknown body %s", e.Route, body)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *generator) validateField(f field) error {
+	if f.Name == "" || f.Go == "" {
+		return errors.New("needs a name and a Go field")
+	}
+	switch f.Type {
+	case "int16", "int32", "int64", "uint16", "uint32", "string8", "string16":
+	case "bytes":
+		if f.Size <= 0 {
+			return errors.New("bytes need a size")
+		}
+	case "layout":
+		if g.layouts[f.Layout] == nil {
+			return fmt.Errorf("unknown layout %s", f.Layout)
+		}
+	case "list8", "list32":
+		if f.Of != "string8" && g.layouts[f.Of] == nil {
+			return fmt.Errorf("unknown list element %s", f.Of)
+		}
+	default:
+		return fmt.Errorf("unknown type %s", f.Type)
+	}
+	if f.Pointer && f.Type != "layout" {
+		return errors.New("only layouts can be pointers")
+	}
+	if f.GoType != "" && typeSizes[f.Type] == 0 {
+		return errors.New("only integers can have a Go type")
+	}
+	return nil
+}
+
+// size of a layout, or false if it has variable size
+func (g *generator) size(l *layout) (size int, fixed bool) {
+	for _, f := range l.Fields {
+		fieldSize, fieldFixed := g.fieldSize(f)
+		if !fieldFixed {
+			return 0, false
+		}
+		size += fieldSize
+	}
+	return size, true
+}
+
+func (g *generator) fieldSize(f field) (size int, fixed bool) {
+	switch f.Type {
+	case "bytes":
+		return f.Size, true
+	case "layout":
+		return g.size(g.layouts[f.Layout])
+	case "string8", "string16", "list8", "list32":
+		return 0, false
+	}
+	return typeSizes[f.Type], true
+}
+
+// whether packing a layout can fail, for fields with sizes or lengths the struct does not enforce
+func (g *generator) canFail(l *layout) bool {
+	for _, f := range l.Fields {
+		switch f.Type {
+		case "bytes", "string8", "string16", "list8":
+			return true
+		case "layout":
+			if f.Pointer || g.canFail(g.layouts[f.Layout]) {
+				return true
+			}
+		case "list32":
+			if f.Of == "string8" || g.canFail(g.layouts[f.Of]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func goModel(model string) string {
+	return "models." + strings.ReplaceAll(model, "[", "[models.")
+}
+
+func (g *generator) goElement(of string) string {
+	if of == "string8" {
+		return "string"
+	}
+	return goModel(g.layouts[of].Model)
+}
@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-04-13
- * Updated: 2025-10-30
+ * Updated: 2026-10-19
  *
  * This file is the entry point to the server.
  * It handles the large scope of the order of operations for initialization and serving requests.
@@ -14,41 +14,87 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
 	_ "github.com/lib/pq"
 
 	"openorganizer/src/db"
 	"openorganizer/src/services"
 	"openorganizer/src/test"
+	"openorganizer/src/utils"
 )
 
 func main() {
-	env, err := services.RetrieveENVVars()
+	config, err := services.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatalf("%s", err)
+		fatal("failed to load the configuration", err)
+	}
+	if config.PrintOnly {
+		config.Print(os.Stdout)
+		return
 	}
+	env := config.Env
+	utils.SetupLogger(env.LOG_FORMAT, env.LOG_LEVEL)
 
-	fmt.Printf("Database Location: %s:%s@%s\n", env.DB_HOST, env.DB_PORT, env.DB_USER)
+	// cancels startup as well, and once serving, shuts the server down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	// a second signal kills the server instead of waiting for the shutdown
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	err = db.ConnectToDB(env)
+	slog.Info("connecting to database", "host", env.DB_HOST, "port", env.DB_PORT, "user", env.DB_USER, "name", env.DB_NAME, "sslmode", env.DB_SSL_MODE)
+	err = db.ConnectToDB(ctx, env)
 	if err != nil {
-		log.Fatalf("Error ensuring database connection: %s", err)
+		fatal("failed to ensure the database connection", err)
 	}
-	fmt.Println("Connected to SQL database")
-	defer db.CloseDatabase()
+	slog.Info("connected to database")
 
-	_ = db.EnsureDBTables(env)
+	for _, err := range db.EnsureDBTables(ctx, env) {
+		slog.Error("failed to ensure database tables", "error", err)
+	}
+	err = db.SeedClock(ctx)
+	if err != nil {
+		slog.Error("failed to seed the clock from the database", "error", err)
+	}
 
-	services.AssignHandlers()
-	services.LaunchPeriodics(env)
+	router := services.NewRouter(env)
+	err = services.LaunchChangeListener(ctx, env)
+	if err != nil {
+		fatal("failed to listen for changes from other instances", err)
+	}
+	stopPeriodics := services.LaunchPeriodics(env)
 
-	errs := services.Run(env)
 	if env.TEST_SUITE {
 		go func() {
 			test.TestSuite(env)
 		}()
 	}
-	log.Fatal(<-errs)
+	err = services.Run(ctx, env, router)
+
+	// the servers no longer use the database, so it is closed once the jobs stop as well
+	stopPeriodics()
+	db.CloseDatabase()
+	if ctx.Err() == nil {
+		fatal("server stopped", err)
+	}
+	if err != nil {
+		slog.Warn("requests were cut off by the shutdown timeout", "error", err)
+	}
+	slog.Info("server stopped")
+}
+
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,29 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file declares the structs describing what the server supports, sent to clients during protocol negotiation.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package models
+
+type Capabilities struct {
+	ProtocolVersionMin uint16        `json:"protocolVersionMin" proto:"1"`
+	ProtocolVersionMax uint16        `json:"protocolVersionMax" proto:"2"`
+	MaxRecordCount     uint32        `json:"maxRecordCount" proto:"3"`
+	ClockMaxDrift      uint32        `json:"clockMaxDrift" proto:"4"`     // seconds
+	IdempotencyWindow  uint32        `json:"idempotencyWindow" proto:"5"` // seconds
+	Tables             []TableLayout `json:"tables" proto:"6"`
+	Features           []string      `json:"features" proto:"7"`
+}
+
+// layout of a table's records, identical for syncup and syncdown
+type TableLayout struct {
+	Name       string `json:"name" proto:"1"` // route after syncup/ or syncdown/
+	RecordSize uint32 `json:"recordSize" proto:"2"`
+}
@@ -1,9 +1,10 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-09-20
- * Updated: 2025-10-30
+ * Updated: 2026-10-19
  *
- * This file declares the struct for storing all .env variables that are fetched at server initialization.
+ * This file declares the struct for storing all configuration settings that are loaded at server initialization.
+ * Each field has the name of its setting in the environment, config file, and flags.
  *
  * This file is a part of OpenOrganizer.
  * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
@@ -12,6 +13,8 @@
 
 package models
 
+import "log/slog"
+
 type ENVVars struct {
 
 	// server information fields
@@ -22,21 +25,111 @@ type ENVVars struct {
 	// if HTTPS will be launched alongside HTTP and redirected to
 	// no default, fails upon error
 	HTTPS bool
-	// required port for HTTP
+	// port for HTTP, required unless SERVER_SOCKET is given
 	SERVER_PORT_HTTP string
+	// path of a Unix socket to serve HTTP on as well, for a reverse proxy on the same machine
+	// defaults to none
+	SERVER_SOCKET string
+	// octal permissions of SERVER_SOCKET, where connecting needs write permission
+	// defaults to 0660
+	SERVER_SOCKET_MODE string
+	// addresses and CIDR ranges of the reverse proxies whose X-Forwarded-For and X-Forwarded-Proto are trusted, comma separated
+	// unix trusts every connection to SERVER_SOCKET, defaults to none
+	TRUSTED_PROXIES []string
 	// required port for HTTPS if HTTPS is being used
 	SERVER_PORT_HTTPS string
 	// certificate file name, required if using HTTPS
 	SERVER_CRT string
 	// private key file name, required if using HTTPS
+	// the certificate and key are reloaded when either file changes, or on SIGHUP
 	SERVER_KEY string
+	// if a self-signed certificate for localhost is generated at SERVER_CRT and SERVER_KEY when neither file exists, for development
+	// SERVER_CRT and SERVER_KEY default to localhost.crt and localhost.key with it, defaults to false
+	TLS_SELF_SIGNED bool
+	// if clients must authenticate with certificates on HTTPS, NONE, VERIFY_IF_GIVEN, or REQUIRE
+	// defaults to NONE
+	TLS_CLIENT_AUTH string
+	// file of the certificate authorities that issue client certificates, required if TLS_CLIENT_AUTH is not NONE
+	TLS_CLIENT_CA string
+	// if tokens are bound to the client certificate they were created with, so that they are rejected from any other machine
+	// defaults to false
+	TLS_CLIENT_BIND bool
+	// port for the Prometheus metrics at /metrics, kept apart from the API so that it does not have to be exposed with it
+	// defaults to none, which does not serve metrics
+	METRICS_PORT string
+
+	// origins allowed to call the server from a browser, comma separated, or * for any origin
+	// electron pages loaded from files send the origin null, which must be listed to be allowed
+	// defaults to * if LOCAL_ONLY, and otherwise to none
+	CORS_ORIGINS []string
+	// request headers cross-origin requests may send, comma separated
+	// defaults to the headers of the protocol
+	CORS_HEADERS []string
+	// time in seconds browsers may cache a preflight response
+	// defaults to 600 seconds
+	CORS_MAX_AGE uint32
+	// if cross-origin requests may send cookies or HTTP authentication, which cannot be used with *
+	// defaults to false
+	CORS_CREDENTIALS bool
+
+	// format of the logs written to stderr, TEXT or JSON
+	// defaults to TEXT
+	LOG_FORMAT string
+	// lowest level that is logged, DEBUG, INFO, WARN, or ERROR, where DEBUG also logs every request
+	// defaults to INFO
+	LOG_LEVEL slog.Level
+
+	// if multiple server instances share the database, so change notifications are sent through it to reach every instance
+	// defaults to false
+	MULTI_INSTANCE bool
+
+	// time in seconds to read a request, and to write its response, unless a route overrides them
+	// write must be longer than read, defaults to 2 and 3 seconds
+	READ_TIMEOUT  uint32
+	WRITE_TIMEOUT uint32
+	// max time in seconds a long polling /lastupdated request is held waiting for a change
+	// defaults to 60 seconds
+	LONG_POLL_MAX_WAIT uint32
+	// time in seconds that /readyz fails after SIGTERM or SIGINT while requests are still served, so that probes route traffic elsewhere first
+	// defaults to 5 seconds
+	SHUTDOWN_DRAIN uint32
+	// max time in seconds to finish the requests in flight after SIGTERM or SIGINT, before the rest are cut off
+	// defaults to 20 seconds
+	SHUTDOWN_TIMEOUT uint32
 
-	// required database login fields, fails upon any errors
+	// database login fields, required unless DB_DSN has them
 
 	DB_HOST string
 	DB_PORT string
 	DB_USER string
 	DB_PWD  string
+	// full connection string, as key=value pairs or a postgres:// URL, which the other database fields that are set override
+	// defaults to none
+	DB_DSN string
+	// database to connect to
+	// defaults to postgres without DB_DSN
+	DB_NAME string
+	// disable, require, verify-ca, or verify-full
+	// defaults to disable without DB_DSN
+	DB_SSL_MODE string
+	// certificate authority file to verify the database with, and certificate and key files to authenticate to it with
+	// defaults to none, and the certificate and key must be given together
+	DB_SSL_ROOT_CERT string
+	DB_SSL_CERT      string
+	DB_SSL_KEY       string
+	// max connections open at once, and max idle connections kept for reuse, where 0 open is no limit
+	// defaults to 0 and 2 connections
+	DB_MAX_OPEN_CONNS uint32
+	DB_MAX_IDLE_CONNS uint32
+	// max time in seconds a connection is reused before it is closed, 0 for no limit
+	// defaults to 0
+	DB_CONN_MAX_LIFETIME uint32
+	// max time in seconds to keep retrying the first connection while the database is unreachable, 0 to try once
+	// defaults to 60 seconds
+	DB_CONNECT_TIMEOUT uint32
+	// max time in seconds a single statement may run before the database cancels it, 0 for no limit
+	// defaults to 10 seconds
+	DB_STATEMENT_TIMEOUT uint32
 
 	// misc behavior configs
 
@@ -52,6 +145,12 @@ type ENVVars struct {
 	// max transmitted records in either direction during syncing
 	// defaults to 1000 records
 	MAX_RECORD_COUNT uint32
+	// max time in seconds a received lastModified may be ahead of the server clock
+	// defaults to 60 seconds
+	CLOCK_MAX_DRIFT uint32
+	// time in seconds that syncup responses are kept for requests retried with the same idempotency key
+	// defaults to 86400 seconds / 24 hours
+	IDEMPOTENCY_WINDOW uint32
 
 	// testing configs
 
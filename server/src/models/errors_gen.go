@@ -0,0 +1,88 @@
+// Code generated by src/gen from schema/protocol.json. DO NOT EDIT.
+
+package models
+
+// sent in every error response, so that clients do not depend on the message
+type ErrorCode uint16
+
+const (
+	// The body could not be read, or its size does not match Content-Length and the layout of the route.
+	ErrorMalformedBody ErrorCode = 1000
+	// recordCount is higher than MAX_RECORD_COUNT.
+	ErrorTooManyRecords ErrorCode = 1001
+	// The JSON or Protobuf body does not decode into the request of the route.
+	ErrorInvalidMessage ErrorCode = 1002
+	// The username contains a character db.ValidateUsername rejects.
+	ErrorInvalidUsername ErrorCode = 1003
+	// A lastModified is too far ahead of the Server-Clock sent with the response.
+	ErrorClockDrift ErrorCode = 1004
+	// Protocol-Version is outside the range in /capabilities.
+	ErrorInvalidProtocolVersion ErrorCode = 1010
+	// Clock is not MS or HLC.
+	ErrorInvalidClock ErrorCode = 1011
+	// Conflict-Response is not FAILS or DETAILED.
+	ErrorInvalidConflictResponse ErrorCode = 1012
+	// Folder-Delete-Policy is not KEEP or CASCADE.
+	ErrorInvalidFolderDeletePolicy ErrorCode = 1013
+	// Idempotency-Key is longer than 64 characters.
+	ErrorInvalidIdempotencyKey ErrorCode = 1014
+	// Content-Type is not a supported codec.
+	ErrorUnsupportedContentType ErrorCode = 1020
+	// Content-Encoding is not gzip or zstd.
+	ErrorUnsupportedEncoding ErrorCode = 1021
+	// Accept does not include a supported codec.
+	ErrorNotAcceptable ErrorCode = 1022
+	// No endpoint has the path.
+	ErrorNotFound ErrorCode = 1030
+	// The endpoint does not accept the method, and the Allow header lists those it does.
+	ErrorMethodNotAllowed ErrorCode = 1031
+	// The userID and authToken do not match an unexpired session.
+	ErrorInvalidToken ErrorCode = 2000
+	// The username and passwordHash do not match an account.
+	ErrorInvalidLogin ErrorCode = 2001
+	// Another account already has the username.
+	ErrorUsernameTaken ErrorCode = 3000
+	// Idempotency-Key was already used with a different path, body, or Clock, Conflict-Response, or Folder-Delete-Policy header.
+	ErrorIdempotencyKeyReused ErrorCode = 3001
+	// Another request with the Idempotency-Key is still being handled, so the request should be retried after Retry-After seconds.
+	ErrorIdempotencyKeyInProgress ErrorCode = 3002
+	// The database or server failed, and the request can be retried.
+	ErrorInternal ErrorCode = 5000
+	// A stored record does not fit the layout of its table.
+	ErrorStoredRecordSize ErrorCode = 5001
+	// The connection cannot be held open for /events.
+	ErrorStreamingUnsupported ErrorCode = 5002
+	// The server is shutting down, cannot reach the database, or is missing a migration or periodic job, so requests should go to another instance.
+	ErrorNotReady ErrorCode = 5003
+	// The user has no lastUpdated entry, which registration creates, so retrying will not help.
+	ErrorNoLastUpdated ErrorCode = 5004
+)
+
+// the HTTP status sent with each error code
+var ErrorStatus = map[ErrorCode]int{
+	ErrorMalformedBody:             400,
+	ErrorTooManyRecords:            400,
+	ErrorInvalidMessage:            400,
+	ErrorInvalidUsername:           400,
+	ErrorClockDrift:                400,
+	ErrorInvalidProtocolVersion:    400,
+	ErrorInvalidClock:              400,
+	ErrorInvalidConflictResponse:   400,
+	ErrorInvalidFolderDeletePolicy: 400,
+	ErrorInvalidIdempotencyKey:     400,
+	ErrorUnsupportedContentType:    415,
+	ErrorUnsupportedEncoding:       415,
+	ErrorNotAcceptable:             406,
+	ErrorNotFound:                  404,
+	ErrorMethodNotAllowed:          405,
+	ErrorInvalidToken:              401,
+	ErrorInvalidLogin:              401,
+	ErrorUsernameTaken:             409,
+	ErrorIdempotencyKeyReused:      422,
+	ErrorIdempotencyKeyInProgress:  409,
+	ErrorInternal:                  500,
+	ErrorStoredRecordSize:          500,
+	ErrorStreamingUnsupported:      500,
+	ErrorNotReady:                  503,
+	ErrorNoLastUpdated:             500,
+}
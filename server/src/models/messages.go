@@ -0,0 +1,81 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file declares the structs for request and response bodies that are not a single user or table struct.
+ * The generated binary pack functions and the JSON and Protobuf codecs share them.
+ * The Protobuf layout of every struct is described in messages.proto.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package models
+
+// requests
+
+type RegisterRequest struct {
+	Login UserLogin `json:"login" proto:"1"`
+	Data  UserData  `json:"data" proto:"2"`
+}
+
+type ChangeLoginRequest struct {
+	Login    UserLogin `json:"login" proto:"1"`
+	LoginNew UserLogin `json:"loginNew" proto:"2"`
+	Data     UserData  `json:"data" proto:"3"`
+}
+
+// without known, the current lastUpdated values are returned immediately instead of long polling
+type LastUpdatedRequest struct {
+	Auth    UserAuth        `json:"auth" proto:"1"`
+	Known   *RowLastUpdated `json:"known,omitempty" proto:"2"`
+	MaxWait uint32          `json:"maxWait,omitempty" proto:"3"` // milliseconds
+}
+
+// records is any of the Row structs sent to syncup
+type SyncupRequest[Row any] struct {
+	Auth    UserAuth `json:"auth" proto:"1"`
+	Records []Row    `json:"records" proto:"2"`
+}
+
+type SyncdownRequest struct {
+	Auth      UserAuth `json:"auth" proto:"1"`
+	StartTime int64    `json:"startTime,string" proto:"2"`
+	EndTime   int64    `json:"endTime,string" proto:"3"`
+}
+
+// responses
+
+type RootResponse struct {
+	MaxRecordCount uint32 `json:"maxRecordCount" proto:"1"`
+}
+
+// the body of every error, the codes are listed in errors_gen.go
+type ErrorResponse struct {
+	Code      ErrorCode `json:"code" proto:"1"`
+	RequestID string    `json:"requestID" proto:"2"`
+	Message   string    `json:"message" proto:"3"`
+}
+
+type LoginResponse struct {
+	Auth UserAuth `json:"auth" proto:"1"`
+	Data UserData `json:"data" proto:"2"`
+}
+
+// conflicts are only sent with Conflict-Response: DETAILED, and are matched to the fails by itemID since rejected records without a stored row have none
+type SyncupResponse[Row any] struct {
+	Fails     []bool `json:"fails" proto:"1"`
+	Conflicts []Row  `json:"conflicts,omitempty" proto:"2"`
+}
+
+type SyncdownResponse[Row any] struct {
+	Records []Row `json:"records" proto:"1"`
+}
+
+// the start of every binary syncup request, before the records
+type SyncupHeader struct {
+	Auth        UserAuth
+	RecordCount uint32
+}
@@ -0,0 +1,183 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file checks messages.proto against the proto tags of the structs in this package, which are what the server actually encodes and decodes.
+ * messages.proto is written by hand for clients, so a struct that gains, loses, or renumbers a field fails here until the file is updated to match.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// the struct encoded for each message, where Protobuf has one message per record type in place of generics
+var protoMessages = map[string]reflect.Type{
+	"UserLogin":                  reflect.TypeFor[UserLogin](),
+	"UserData":                   reflect.TypeFor[UserData](),
+	"UserAuth":                   reflect.TypeFor[UserAuth](),
+	"LastUpdated":                reflect.TypeFor[RowLastUpdated](),
+	"Item":                       reflect.TypeFor[RowItems](),
+	"Extension":                  reflect.TypeFor[RowExtensions](),
+	"Override":                   reflect.TypeFor[RowOverrides](),
+	"Folder":                     reflect.TypeFor[RowFolders](),
+	"Deleted":                    reflect.TypeFor[RowDeleted](),
+	"RegisterRequest":            reflect.TypeFor[RegisterRequest](),
+	"ChangeLoginRequest":         reflect.TypeFor[ChangeLoginRequest](),
+	"LastUpdatedRequest":         reflect.TypeFor[LastUpdatedRequest](),
+	"SyncupItemsRequest":         reflect.TypeFor[SyncupRequest[RowItems]](),
+	"SyncupExtensionsRequest":    reflect.TypeFor[SyncupRequest[RowExtensions]](),
+	"SyncupOverridesRequest":     reflect.TypeFor[SyncupRequest[RowOverrides]](),
+	"SyncupFoldersRequest":       reflect.TypeFor[SyncupRequest[RowFolders]](),
+	"SyncupDeletedRequest":       reflect.TypeFor[SyncupRequest[RowDeleted]](),
+	"SyncdownRequest":            reflect.TypeFor[SyncdownRequest](),
+	"RootResponse":               reflect.TypeFor[RootResponse](),
+	"LoginResponse":              reflect.TypeFor[LoginResponse](),
+	"TableLayout":                reflect.TypeFor[TableLayout](),
+	"Capabilities":               reflect.TypeFor[Capabilities](),
+	"SyncupItemsResponse":        reflect.TypeFor[SyncupResponse[RowItems]](),
+	"SyncupExtensionsResponse":   reflect.TypeFor[SyncupResponse[RowExtensions]](),
+	"SyncupOverridesResponse":    reflect.TypeFor[SyncupResponse[RowOverrides]](),
+	"SyncupFoldersResponse":      reflect.TypeFor[SyncupResponse[RowFolders]](),
+	"SyncupDeletedResponse":      reflect.TypeFor[SyncupResponse[RowDeleted]](),
+	"SyncdownItemsResponse":      reflect.TypeFor[SyncdownResponse[RowItems]](),
+	"SyncdownExtensionsResponse": reflect.TypeFor[SyncdownResponse[RowExtensions]](),
+	"SyncdownOverridesResponse":  reflect.TypeFor[SyncdownResponse[RowOverrides]](),
+	"SyncdownFoldersResponse":    reflect.TypeFor[SyncdownResponse[RowFolders]](),
+	"SyncdownDeletedResponse":    reflect.TypeFor[SyncdownResponse[RowDeleted]](),
+	"ErrorResponse":              reflect.TypeFor[ErrorResponse](),
+}
+
+type protoField struct {
+	name      string
+	fieldType string
+}
+
+var protoMessageLine = regexp.MustCompile(`^message (\w+) \{$`)
+var protoFieldLine = regexp.MustCompile(`^((?:repeated )?\w+) (\w+) = (\d+);$`)
+
+// the fields of every message in a .proto file by their number
+func parseProto(data []byte) (messages map[string]map[int]protoField, err error) {
+	messages = map[string]map[int]protoField{}
+	var fields map[int]protoField
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if match := protoMessageLine.FindStringSubmatch(line); match != nil {
+			fields = map[int]protoField{}
+			messages[match[1]] = fields
+		} else if match := protoFieldLine.FindStringSubmatch(line); match != nil && fields != nil {
+			number, _ := strconv.Atoi(match[3])
+			fields[number] = protoField{name: match[2], fieldType: match[1]}
+		} else if line == "}" {
+			fields = nil
+		}
+	}
+	return messages, scanner.Err()
+}
+
+// the Protobuf name of a Go field, such as item_id for ItemID
+func protoName(goName string) string {
+	var name strings.Builder
+	runes := []rune(goName)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+			name.WriteByte('_')
+		}
+		name.WriteRune(unicode.ToLower(r))
+	}
+	return name.String()
+}
+
+// the Protobuf type that utils/protobuf.go encodes a Go type as
+func protoType(goType reflect.Type, messageNames map[reflect.Type]string) string {
+	switch goType.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return "int32"
+	case reflect.Int64:
+		return "int64"
+	case reflect.Uint16, reflect.Uint32:
+		return "uint32"
+	case reflect.Uint64:
+		return "uint64"
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Pointer:
+		return protoType(goType.Elem(), messageNames)
+	case reflect.Slice:
+		if goType.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+		return "repeated " + protoType(goType.Elem(), messageNames)
+	case reflect.Struct:
+		return messageNames[goType]
+	}
+	return goType.String()
+}
+
+func TestMessagesProto(t *testing.T) {
+	data, err := os.ReadFile("messages.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := parseProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageNames := map[reflect.Type]string{}
+	for name, structType := range protoMessages {
+		messageNames[structType] = name
+	}
+
+	for name := range messages {
+		if protoMessages[name] == nil {
+			t.Errorf("message %s has no struct to check it against", name)
+		}
+	}
+	for name, structType := range protoMessages {
+		fields, found := messages[name]
+		if !found {
+			t.Errorf("message %s for %s is missing", name, structType)
+			continue
+		}
+		tagged := map[int]bool{}
+		for i := range structType.NumField() {
+			goField := structType.Field(i)
+			tag := goField.Tag.Get("proto")
+			if tag == "" {
+				continue
+			}
+			number, err := strconv.Atoi(tag)
+			if err != nil {
+				t.Errorf("%s.%s has an invalid proto tag", structType, goField.Name)
+				continue
+			}
+			tagged[number] = true
+			expected := protoField{name: protoName(goField.Name), fieldType: protoType(goField.Type, messageNames)}
+			if fields[number] != expected {
+				t.Errorf("message %s field %v is %q, but %s.%s is encoded as %q", name, number, fields[number], structType, goField.Name, expected)
+			}
+		}
+		for number, field := range fields {
+			if !tagged[number] {
+				t.Errorf("message %s field %v %s has no proto tag in %s", name, number, field.name, structType)
+			}
+		}
+	}
+}
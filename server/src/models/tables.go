@@ -1,9 +1,10 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-10-11
- * Updated: 2025-10-12
+ * Updated: 2026-10-19
  *
  * This file declares structs for all database tables.
+ * Fields sent to clients are tagged with their JSON names and Protobuf field numbers, and the rest are never sent.
  *
  * This file is a part of OpenOrganizer.
  * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
@@ -31,58 +32,58 @@ type RowTokens struct {
 }
 
 type RowLastUpdated struct {
-	UserID           int64
-	LastUpNotes      int64
-	LastUpReminders  int64
-	LastUpDaily      int64
-	LastUpWeekly     int64
-	LastUpMonthly    int64
-	LastUpYearly     int64
-	LastUpExtensions int64
-	LastUpOverrides  int64
-	LastUpFolders    int64
-	LastUpDeleted    int64
+	UserID           int64 `json:"-"`
+	LastUpNotes      int64 `json:"lastUpNotes,string" proto:"1"`
+	LastUpReminders  int64 `json:"lastUpReminders,string" proto:"2"`
+	LastUpDaily      int64 `json:"lastUpDaily,string" proto:"3"`
+	LastUpWeekly     int64 `json:"lastUpWeekly,string" proto:"4"`
+	LastUpMonthly    int64 `json:"lastUpMonthly,string" proto:"5"`
+	LastUpYearly     int64 `json:"lastUpYearly,string" proto:"6"`
+	LastUpExtensions int64 `json:"lastUpExtensions,string" proto:"7"`
+	LastUpOverrides  int64 `json:"lastUpOverrides,string" proto:"8"`
+	LastUpFolders    int64 `json:"lastUpFolders,string" proto:"9"`
+	LastUpDeleted    int64 `json:"lastUpDeleted,string" proto:"10"`
 }
 
 // any item, so notes and all reminder types
 type RowItems struct {
-	UserID        int64
-	ItemID        int64
-	LastModified  int64
-	LastUpdated   int64
-	EncryptedData []byte // size depends on table
+	UserID        int64  `json:"-"`
+	ItemID        int64  `json:"itemID,string" proto:"1"`
+	LastModified  int64  `json:"lastModified,string" proto:"2"`
+	LastUpdated   int64  `json:"-"`
+	EncryptedData []byte `json:"encryptedData" proto:"3"` // size depends on table
 }
 
 type RowExtensions struct {
-	UserID        int64
-	ItemID        int64
-	LastModified  int64
-	LastUpdated   int64
-	SequenceNum   int32
-	EncryptedData []byte // size 64
+	UserID        int64  `json:"-"`
+	ItemID        int64  `json:"itemID,string" proto:"1"`
+	LastModified  int64  `json:"lastModified,string" proto:"2"`
+	LastUpdated   int64  `json:"-"`
+	SequenceNum   int32  `json:"sequenceNum" proto:"3"`
+	EncryptedData []byte `json:"encryptedData" proto:"4"` // size 64
 }
 
 type RowOverrides struct {
-	UserID        int64
-	ItemID        int64
-	LastModified  int64
-	LastUpdated   int64
-	LinkedItemID  int64
-	EncryptedData []byte // size 64
+	UserID        int64  `json:"-"`
+	ItemID        int64  `json:"itemID,string" proto:"1"`
+	LastModified  int64  `json:"lastModified,string" proto:"2"`
+	LastUpdated   int64  `json:"-"`
+	LinkedItemID  int64  `json:"linkedItemID,string" proto:"3"`
+	EncryptedData []byte `json:"encryptedData" proto:"4"` // size 64
 }
 
 type RowFolders struct {
-	UserID        int64
-	FolderID      int64
-	LastModified  int64
-	LastUpdated   int64
-	EncryptedData []byte // size 64
+	UserID        int64  `json:"-"`
+	FolderID      int64  `json:"folderID,string" proto:"1"`
+	LastModified  int64  `json:"lastModified,string" proto:"2"`
+	LastUpdated   int64  `json:"-"`
+	EncryptedData []byte `json:"encryptedData" proto:"3"` // size 64
 }
 
 type RowDeleted struct {
-	UserID       int64
-	ItemID       int64
-	LastModified int64
-	LastUpdated  int64
-	ItemTable    int16
+	UserID       int64 `json:"-"`
+	ItemID       int64 `json:"itemID,string" proto:"1"`
+	LastModified int64 `json:"lastModified,string" proto:"2"`
+	LastUpdated  int64 `json:"-"`
+	ItemTable    int16 `json:"itemTable" proto:"3"`
 }
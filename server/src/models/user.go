@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-10-11
- * Updated: 2025-10-12
+ * Updated: 2026-10-19
  *
  * This file defines a few helper structs for passing user information as a single function parameter.
  *
@@ -13,16 +13,16 @@
 package models
 
 type UserLogin struct {
-	Username     []byte // size 32
-	PasswordHash []byte // size 32
+	Username     []byte `json:"username" proto:"1"`     // size 32
+	PasswordHash []byte `json:"passwordHash" proto:"2"` // size 32
 }
 
 type UserData struct {
-	EncrPrivateKey  []byte // size 32
-	EncrPrivateKey2 []byte // size 32
+	EncrPrivateKey  []byte `json:"encrPrivateKey" proto:"1"`  // size 32
+	EncrPrivateKey2 []byte `json:"encrPrivateKey2" proto:"2"` // size 32
 }
 
 type UserAuth struct {
-	UserID    int64
-	AuthToken []byte // size 32
+	UserID    int64  `json:"userID,string" proto:"1"`
+	AuthToken []byte `json:"authToken" proto:"2"` // size 32
 }
@@ -0,0 +1,267 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file handles JSON and Protobuf request and response bodies, chosen with the Content-Type and Accept headers.
+ * Bodies in either codec are decoded into the models structs and packed into the binary format before the handler reads them, and binary responses are unpacked and encoded on the way out.
+ * Handlers therefore only ever see the binary format, which stays the default when neither header is sent.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"openorganizer/src/models"
+	"openorganizer/src/utils"
+)
+
+const contentTypeBinary = "application/octet-stream"
+const contentTypeJSON = "application/json"
+const contentTypeProtobuf = "application/x-protobuf"
+
+type codec struct {
+	name        string
+	contentType string
+	marshal     func(message any) ([]byte, error)
+	unmarshal   func(data []byte, message any) error
+}
+
+// byte fields are base64 in JSON, and int64 fields are strings so that JavaScript clients do not lose precision
+var jsonCodec = &codec{"JSON", contentTypeJSON, json.Marshal, json.Unmarshal}
+var protobufCodec = &codec{"Protobuf", contentTypeProtobuf, utils.MarshalProtobuf, utils.UnmarshalProtobuf}
+
+// the binary format is a nil codec, since its bodies are passed through unchanged
+func codecByMediaType(mediaType string) (c *codec, supported bool) {
+	switch strings.ToLower(mediaType) {
+	case "", contentTypeBinary:
+		return nil, true
+	case contentTypeJSON:
+		return jsonCodec, true
+	case contentTypeProtobuf, "application/protobuf":
+		return protobufCodec, true
+	}
+	return nil, false
+}
+
+// reads the codec of the request body from Content-Type
+func readRequestCodec(w http.ResponseWriter, r *http.Request) (*codec, error) {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return nil, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	c, supported := codecByMediaType(mediaType)
+	if err != nil || !supported {
+		writeError(w, r, models.ErrorUnsupportedContentType, "Content-Type must be "+contentTypeBinary+", "+contentTypeJSON+", or "+contentTypeProtobuf+".")
+		return nil, errors.New("")
+	}
+	return c, nil
+}
+
+// picks the response codec from an Accept header, preferring earlier types when weighted equally
+// without Accept or with a wildcard, responses use the same codec as the request
+func acceptedCodec(header string, requestCodec *codec) (best *codec, acceptable bool) {
+	if header == "" {
+		return requestCodec, true
+	}
+	var bestWeight float64
+	for _, option := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(option))
+		if err != nil {
+			continue
+		}
+		weight := 1.0
+		if value, found := params["q"]; found {
+			weight, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+		}
+		c, supported := codecByMediaType(mediaType)
+		if mediaType == "*/*" || mediaType == "application/*" {
+			c, supported = requestCodec, true
+		}
+		if supported && weight > bestWeight {
+			best, bestWeight = c, weight
+		}
+	}
+	return best, bestWeight > 0
+}
+
+func negotiateResponseCodec(w http.ResponseWriter, r *http.Request, requestCodec *codec) (*codec, error) {
+	c, acceptable := acceptedCodec(r.Header.Get("Accept"), requestCodec)
+	if !acceptable {
+		writeError(w, r, models.ErrorNotAcceptable, "Accept must include "+contentTypeBinary+", "+contentTypeJSON+", or "+contentTypeProtobuf+".")
+		return nil, errors.New("")
+	}
+	return c, nil
+}
+
+// a route's request and response as models structs, converted from and to the binary format its handler uses
+// either is nil if that side of the route is never converted
+type routeMessages struct {
+	// decodes a request and packs it into the binary format
+	decode func(c *codec, body []byte) (packed []byte, err error)
+	// unpacks a successful binary response, given the binary request it answers, and encodes it
+	encode func(c *codec, packed []byte, request []byte) (encoded []byte, err error)
+}
+
+func messages[Request, Response any](pack func(Request) ([]byte, error), unpack func(packed []byte, request []byte) Response) (m routeMessages) {
+	if pack != nil {
+		m.decode = func(c *codec, body []byte) ([]byte, error) {
+			var request Request
+			if err := c.unmarshal(body, &request); err != nil {
+				return nil, err
+			}
+			return pack(request)
+		}
+	}
+	if unpack != nil {
+		m.encode = func(c *codec, packed []byte, request []byte) ([]byte, error) {
+			return c.marshal(unpack(packed, request))
+		}
+	}
+	return m
+}
+
+var rootMessages = messages[struct{}](nil, func(packed []byte, _ []byte) models.RootResponse {
+	return utils.UnpackRootResponse(packed)
+})
+var capabilitiesMessages = messages[struct{}](nil, func(packed []byte, _ []byte) models.Capabilities {
+	return utils.UnpackCapabilities(packed)
+})
+var registerMessages = messages(utils.PackRegisterRequest, func(packed []byte, _ []byte) models.UserAuth {
+	return utils.UnpackUserAuth(packed)
+})
+var loginMessages = messages(utils.PackUserLogin, func(packed []byte, _ []byte) models.LoginResponse {
+	return utils.UnpackLoginResponse(packed)
+})
+var changeLoginMessages = messages(utils.PackChangeLoginRequest, func(packed []byte, _ []byte) models.UserAuth {
+	return utils.UnpackUserAuth(packed)
+})
+var lastUpdatedMessages = messages(utils.PackLastUpdatedRequest, func(packed []byte, _ []byte) models.RowLastUpdated {
+	return utils.UnpackLastUpdated(packed)
+})
+
+// the stream itself is always sent as Server-Sent Events
+var eventsMessages = messages[models.UserAuth, struct{}](utils.PackUserAuth, nil)
+
+// the fails are followed by the conflicts when the client asked for them, in the same layout as a syncdown response
+func syncupMessages[Row any](pack func(models.SyncupRequest[Row]) ([]byte, error), unpackConflicts func([]byte) models.SyncdownResponse[Row]) routeMessages {
+	return messages(pack, func(packed []byte, request []byte) models.SyncupResponse[Row] {
+		recordCount := utils.UnpackSyncupHeader(request).RecordCount
+		failsSize := (recordCount + 7) / 8
+		response := models.SyncupResponse[Row]{Fails: utils.UnpackFails(packed, recordCount)}
+		if uint32(len(packed)) > failsSize {
+			response.Conflicts = unpackConflicts(packed[failsSize:]).Records
+		}
+		return response
+	})
+}
+
+func syncdownMessages[Row any](unpack func([]byte) models.SyncdownResponse[Row]) routeMessages {
+	return messages(utils.PackSyncdownRequest, func(packed []byte, _ []byte) models.SyncdownResponse[Row] {
+		return unpack(packed)
+	})
+}
+
+// the daily, weekly, monthly, and yearly reminder routes share the reminders messages
+var upNotesMessages = syncupMessages(utils.PackNotesSyncup, utils.UnpackNotesSyncdown)
+var upRemindersMessages = syncupMessages(utils.PackRemindersSyncup, utils.UnpackRemindersSyncdown)
+var upExtensionsMessages = syncupMessages(utils.PackExtensionsSyncup, utils.UnpackExtensionsSyncdown)
+var upOverridesMessages = syncupMessages(utils.PackOverridesSyncup, utils.UnpackOverridesSyncdown)
+var upFoldersMessages = syncupMessages(utils.PackFoldersSyncup, utils.UnpackFoldersSyncdown)
+var upDeletedMessages = syncupMessages(utils.PackDeletedSyncup, utils.UnpackDeletedSyncdown)
+
+var downNotesMessages = syncdownMessages(utils.UnpackNotesSyncdown)
+var downRemindersMessages = syncdownMessages(utils.UnpackRemindersSyncdown)
+var downExtensionsMessages = syncdownMessages(utils.UnpackExtensionsSyncdown)
+var downOverridesMessages = syncdownMessages(utils.UnpackOverridesSyncdown)
+var downFoldersMessages = syncdownMessages(utils.UnpackFoldersSyncdown)
+var downDeletedMessages = syncdownMessages(utils.UnpackDeletedSyncdown)
+
+// the largest a JSON or Protobuf request may be, allowing for base64 and field names on top of the binary size
+func codecSizeLimit() int64 {
+	return 4 * int64(utils.SyncupHeaderSize+(maxRecordCount*notesRecordSize))
+}
+
+// converts the request and response of a handler between the binary format and the negotiated codecs
+// since the handler reads the packed request, idempotency keys match retries regardless of the codec they are sent in
+func withCodec(m routeMessages) middleware {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept")
+			requestCodec, err := readRequestCodec(w, r)
+			if err != nil {
+				return
+			}
+			responseCodec, err := negotiateResponseCodec(w, r, requestCodec)
+			if err != nil {
+				return
+			}
+			if m.decode == nil {
+				requestCodec = nil
+			}
+			if m.encode == nil {
+				responseCodec = nil
+			}
+			if requestCodec == nil && responseCodec == nil {
+				handler(w, r)
+				return
+			}
+
+			// the whole request is read here, and the handler reads it again in the binary format
+			body, err := readBody(w, r, codecSizeLimit())
+			if err != nil {
+				return
+			}
+			if requestCodec != nil {
+				body, err = m.decode(requestCodec, body)
+				if err != nil {
+					writeError(w, r, models.ErrorInvalidMessage, "Request body is not a valid "+requestCodec.name+" message: "+err.Error())
+					return
+				}
+			}
+			r.Header.Del("Content-Encoding")
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+
+			if responseCodec == nil {
+				handler(w, r)
+				return
+			}
+			bw := &bufferWriter{ResponseWriter: w, status: http.StatusOK}
+			handler(bw, r)
+
+			// errors are sent as they are, and nothing is sent if the client is gone
+			if r.Context().Err() != nil {
+				return
+			}
+			response := bw.body.Bytes()
+			if bw.status == http.StatusOK {
+				response, err = m.encode(responseCodec, response, body)
+				if utils.LogError(r.Context(), err, "encode response", "codec", responseCodec.name) {
+					writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
+					return
+				}
+				w.Header().Set("Content-Type", responseCodec.contentType)
+			}
+			w.Header().Del("Content-Length")
+			w.WriteHeader(bw.status)
+			w.Write(response)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file handles gzip and zstd compression of sync request and response bodies.
+ * Responses are compressed according to Accept-Encoding, and request bodies are decompressed according to Content-Encoding.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+// responses smaller than this are not worth the compression header overhead
+const minCompressSize = 256
+
+// buffers the whole response so that it can be compressed or converted once the handler is done
+type bufferWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (bw *bufferWriter) WriteHeader(status int) {
+	bw.status = status
+}
+
+func (bw *bufferWriter) Write(data []byte) (int, error) {
+	return bw.body.Write(data)
+}
+
+func (bw *bufferWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// picks the encoding from Accept-Encoding, preferring zstd over gzip when weighted equally
+func negotiateEncoding(r *http.Request) string {
+	var encoding string
+	var bestWeight float64
+	for _, option := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(option), ";")
+		weight := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		name = strings.ToLower(name)
+		if name != "zstd" && name != "gzip" {
+			continue
+		}
+		if weight > bestWeight || (weight == bestWeight && name == "zstd") {
+			encoding, bestWeight = name, weight
+		}
+	}
+	return encoding
+}
+
+func compress(encoding string, data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	var encoder io.WriteCloser
+	var err error
+	switch encoding {
+	case "gzip":
+		encoder = gzip.NewWriter(&compressed)
+	case "zstd":
+		encoder, err = zstd.NewWriter(&compressed)
+	default:
+		return nil, errors.New("unsupported encoding " + encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = encoder.Write(data)
+	if err == nil {
+		err = encoder.Close()
+	}
+	return compressed.Bytes(), err
+}
+
+// compresses the response of a handler if the client accepts gzip or zstd
+func withCompression(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r)
+		if encoding == "" {
+			handler(w, r)
+			return
+		}
+
+		// only successful responses large enough to be worth it are compressed
+		bw := &bufferWriter{ResponseWriter: w, status: http.StatusOK}
+		handler(bw, r)
+
+		response := bw.body.Bytes()
+		if bw.status == http.StatusOK && len(response) >= minCompressSize {
+			compressed, err := compress(encoding, response)
+			if err == nil {
+				w.Header().Set("Content-Encoding", encoding)
+				response = compressed
+			}
+		}
+		w.Header().Del("Content-Length")
+		w.WriteHeader(bw.status)
+		w.Write(response)
+	}
+}
+
+// reads the request body, decompressing it if it has a Content-Encoding
+// the MaxBytesReader on the body limits the compressed size, and limit bounds the decompressed size
+// for compressed bodies, r.ContentLength is set to the decompressed size so that it is verified like an uncompressed body
+func readRequestBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	var decoder io.Reader
+	switch strings.ToLower(r.Header.Get("Content-Encoding")) {
+	case "", "identity":
+		return io.ReadAll(r.Body)
+	case "gzip":
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		decoder = gzipReader
+	case "zstd":
+		zstdReader, err := zstd.NewReader(r.Body, zstd.WithDecoderMaxMemory(uint64(limit)), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zstdReader.Close()
+		decoder = zstdReader
+	default:
+		return nil, errUnsupportedEncoding
+	}
+
+	body, err := io.ReadAll(io.LimitReader(decoder, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errors.New("decompressed body is too large")
+	}
+	r.ContentLength = int64(len(body))
+	return body, nil
+}
@@ -0,0 +1,500 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file loads the configuration of the server, where every setting has the name of its field in models.ENVVars.
+ * A setting is taken from the first of these that has it: a command-line flag, the environment or .env file, the config file, and its default.
+ * An empty value counts as unset, except for a flag, so that -name= clears a setting back to its default.
+ * Every setting is validated before the server starts, and all of the errors are returned together.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+
+	"openorganizer/src/models"
+	"openorganizer/src/utils"
+)
+
+var maxRecordCount uint32
+var longPollMaxWaitTime time.Duration
+
+type setting struct {
+	name string
+	// used when no source has the setting, and empty for none
+	fallback string
+	usage    string
+	// required settings have no default and must be given
+	required bool
+	// numbers that must be above 0
+	positive bool
+	// replaced when the configuration is printed
+	secret bool
+	// further validation of the raw value
+	check func(value string) error
+}
+
+// every field of models.ENVVars, in the order they are printed
+var settings = []setting{
+	{name: "LOCAL_ONLY", fallback: "FALSE", usage: "only accept connections from this machine"},
+	{name: "HTTPS", required: true, usage: "serve HTTPS and redirect HTTP to it"},
+	{name: "SERVER_PORT_HTTP", check: checkPort, usage: "port for HTTP, required without SERVER_SOCKET"},
+	{name: "SERVER_SOCKET", usage: "Unix socket to serve HTTP on for a reverse proxy"},
+	{name: "SERVER_SOCKET_MODE", fallback: "0660", check: checkFileMode, usage: "octal permissions of SERVER_SOCKET"},
+	{name: "TRUSTED_PROXIES", check: checkTrustedProxies, usage: "comma separated addresses and CIDR ranges of proxies whose X-Forwarded-For and X-Forwarded-Proto are trusted, with unix for SERVER_SOCKET"},
+	{name: "SERVER_PORT_HTTPS", check: checkPort, usage: "port for HTTPS, required with HTTPS"},
+	{name: "SERVER_CRT", usage: "certificate file, required with HTTPS unless TLS_SELF_SIGNED"},
+	{name: "SERVER_KEY", usage: "private key file, required with HTTPS unless TLS_SELF_SIGNED"},
+	{name: "TLS_SELF_SIGNED", fallback: "FALSE", usage: "generate a self-signed certificate for localhost when its files do not exist, for development"},
+	{name: "TLS_CLIENT_AUTH", fallback: "NONE", check: checkClientAuth, usage: "NONE, VERIFY_IF_GIVEN, or REQUIRE client certificates on HTTPS"},
+	{name: "TLS_CLIENT_CA", usage: "certificate authorities that issue client certificates, required with TLS_CLIENT_AUTH"},
+	{name: "TLS_CLIENT_BIND", fallback: "FALSE", usage: "bind tokens to the client certificate they were created with"},
+	{name: "METRICS_PORT", check: checkPort, usage: "port for the Prometheus metrics, none to not serve them"},
+	{name: "CORS_ORIGINS", check: checkOrigins, usage: "comma separated origins allowed to call the server from a browser, or *, defaults to * with LOCAL_ONLY"},
+	{name: "CORS_HEADERS", usage: "comma separated request headers cross-origin requests may send"},
+	{name: "CORS_MAX_AGE", fallback: "600", usage: "seconds browsers may cache a preflight response"},
+	{name: "CORS_CREDENTIALS", fallback: "FALSE", usage: "allow cross-origin requests to send credentials"},
+	{name: "LOG_FORMAT", fallback: "TEXT", check: checkLogFormat, usage: "TEXT or JSON"},
+	{name: "LOG_LEVEL", fallback: "INFO", usage: "DEBUG, INFO, WARN, or ERROR"},
+	{name: "MULTI_INSTANCE", fallback: "FALSE", usage: "send change notifications through the database to other instances"},
+	{name: "READ_TIMEOUT", fallback: "2", positive: true, usage: "seconds to read a request"},
+	{name: "WRITE_TIMEOUT", fallback: "3", positive: true, usage: "seconds to write a response, more than READ_TIMEOUT"},
+	{name: "LONG_POLL_MAX_WAIT", fallback: "60", usage: "max seconds a long polling /lastupdated is held"},
+	{name: "SHUTDOWN_DRAIN", fallback: "5", usage: "seconds /readyz fails before shutting down, while requests are still served"},
+	{name: "SHUTDOWN_TIMEOUT", fallback: "20", positive: true, usage: "seconds to finish requests in flight when shutting down"},
+	{name: "DB_HOST", usage: "database host, required without DB_DSN"},
+	{name: "DB_PORT", check: checkPort, usage: "database port, required without DB_DSN"},
+	{name: "DB_USER", usage: "database user, required without DB_DSN"},
+	{name: "DB_PWD", secret: true, usage: "database password, required without DB_DSN"},
+	{name: "DB_DSN", secret: true, check: checkDSN, usage: "database connection string or postgres:// URL, overridden by the other database settings that are set"},
+	{name: "DB_NAME", usage: "database name, defaults to postgres without DB_DSN"},
+	{name: "DB_SSL_MODE", check: checkSSLMode, usage: "disable, require, verify-ca, or verify-full, defaults to disable without DB_DSN"},
+	{name: "DB_SSL_ROOT_CERT", usage: "certificate authority file to verify the database with"},
+	{name: "DB_SSL_CERT", usage: "client certificate file for the database, given with DB_SSL_KEY"},
+	{name: "DB_SSL_KEY", usage: "client key file for the database, given with DB_SSL_CERT"},
+	{name: "DB_MAX_OPEN_CONNS", fallback: "0", usage: "max open database connections, 0 for no limit"},
+	{name: "DB_MAX_IDLE_CONNS", fallback: "2", usage: "max idle database connections kept for reuse"},
+	{name: "DB_CONN_MAX_LIFETIME", fallback: "0", usage: "seconds a database connection is reused, 0 for no limit"},
+	{name: "DB_CONNECT_TIMEOUT", fallback: "60", usage: "seconds to keep retrying the first database connection, 0 to try once"},
+	{name: "DB_STATEMENT_TIMEOUT", fallback: "10", usage: "seconds a database statement may run, 0 for no limit"},
+	{name: "TOKEN_EXPIRE_REFRESH", fallback: "FALSE", usage: "reset the expiration of a token when it is used"},
+	{name: "TOKEN_EXPIRE_TIME", fallback: "3600", positive: true, usage: "seconds until a token expires"},
+	{name: "TOKEN_PURGE_INTERVAL", fallback: "3600", positive: true, usage: "seconds between purges of expired tokens"},
+	{name: "MAX_RECORD_COUNT", fallback: "1000", positive: true, usage: "max records sent in either direction during syncing"},
+	{name: "CLOCK_MAX_DRIFT", fallback: "60", usage: "max seconds a lastModified may be ahead of the server clock"},
+	{name: "IDEMPOTENCY_WINDOW", fallback: "86400", positive: true, usage: "seconds that syncup responses are kept for retries"},
+	{name: "CLEAR_DB_AUTH", fallback: "FALSE", usage: "clear the authentication tables on launch"},
+	{name: "CLEAR_DB_DATA", fallback: "FALSE", usage: "clear the user data tables on launch"},
+	{name: "TEST_SUITE", fallback: "FALSE", usage: "run the test suite, which clears the entire database"},
+	{name: "TEST_SUITE_DELAY", fallback: "20", usage: "seconds before the test suite starts"},
+}
+
+// where the value of a setting came from
+const (
+	sourceDefault = "default"
+	sourceFile    = "config file"
+	sourceEnv     = "environment"
+	sourceFlag    = "flag"
+)
+
+type configValue struct {
+	value  string
+	source string
+}
+
+type Config struct {
+	Env models.ENVVars
+	// set by -print-config, to print the configuration instead of serving
+	PrintOnly bool
+	values    map[string]configValue
+}
+
+// loads the configuration from the command-line arguments, the environment and .env file, and the config file
+// the config file is given by -config or CONFIG_FILE, and ends in .yaml, .yml, or .toml
+func LoadConfig(args []string) (config Config, err error) {
+	config.values = map[string]configValue{}
+	flags := flag.NewFlagSet("openorganizer", flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML or TOML config file, overriding CONFIG_FILE")
+	flags.BoolVar(&config.PrintOnly, "print-config", false, "print the effective configuration with secrets redacted, and exit")
+	flagValues := map[string]string{}
+	for _, s := range settings {
+		flags.Func(flagName(s.name), s.usage, func(value string) error {
+			flagValues[s.name] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+
+	// .env is optional, and does not override variables already in the environment
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return config, fmt.Errorf("error loading .env: %w", err)
+	}
+	// an empty -config skips CONFIG_FILE
+	configGiven := false
+	flags.Visit(func(f *flag.Flag) {
+		configGiven = configGiven || f.Name == "config"
+	})
+	if !configGiven {
+		*configFile = os.Getenv("CONFIG_FILE")
+	}
+	fileValues := map[string]string{}
+	if *configFile != "" {
+		fileValues, err = readConfigFile(*configFile)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	for _, s := range settings {
+		// empty values are left unset, but an empty flag still overrides the environment and config file
+		if value, found := flagValues[s.name]; found {
+			if value != "" {
+				config.values[s.name] = configValue{value, sourceFlag}
+			}
+		} else if value := os.Getenv(s.name); value != "" {
+			config.values[s.name] = configValue{value, sourceEnv}
+		} else if value := fileValues[s.name]; value != "" {
+			config.values[s.name] = configValue{value, sourceFile}
+		}
+		if _, found := config.values[s.name]; !found && s.fallback != "" {
+			config.values[s.name] = configValue{s.fallback, sourceDefault}
+		}
+	}
+	// these defaults depend on other settings, so they are only known after the rest
+	if localOnly, _ := strconv.ParseBool(config.values["LOCAL_ONLY"].value); localOnly && config.values["CORS_ORIGINS"].value == "" {
+		config.values["CORS_ORIGINS"] = configValue{"*", sourceDefault}
+	}
+	if selfSigned, _ := strconv.ParseBool(config.values["TLS_SELF_SIGNED"].value); selfSigned {
+		if config.values["SERVER_CRT"].value == "" {
+			config.values["SERVER_CRT"] = configValue{"localhost.crt", sourceDefault}
+		}
+		if config.values["SERVER_KEY"].value == "" {
+			config.values["SERVER_KEY"] = configValue{"localhost.key", sourceDefault}
+		}
+	}
+	// a DSN keeps its own database and SSL mode unless they are given
+	if config.values["DB_DSN"].value == "" {
+		if config.values["DB_NAME"].value == "" {
+			config.values["DB_NAME"] = configValue{"postgres", sourceDefault}
+		}
+		if config.values["DB_SSL_MODE"].value == "" {
+			config.values["DB_SSL_MODE"] = configValue{"disable", sourceDefault}
+		}
+	}
+
+	config.Env, err = parseConfig(config.values)
+	if err != nil {
+		return config, err
+	}
+	applyConfig(config.Env)
+	return config, nil
+}
+
+// LOG_LEVEL is set with -log-level
+func flagName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+}
+
+// reads the settings of a config file, whose keys are the names of settings in any case
+// lists may be given as arrays or comma separated strings
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, errors.New("config file " + path + " must end in .yaml, .yml, or .toml")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	var errs []error
+	for key, value := range raw {
+		name := strings.ToUpper(key)
+		if !slices.ContainsFunc(settings, func(s setting) bool { return s.name == name }) {
+			errs = append(errs, errors.New("unknown setting "+key+" in config file"))
+			continue
+		}
+		text, err := configText(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s in config file: %w", key, err))
+			continue
+		}
+		values[name] = text
+	}
+	return values, errors.Join(errs...)
+}
+
+// the value of a config file setting as it would be written in the environment
+func configText(value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(value)), nil
+	case int, int64, uint64, float64:
+		return fmt.Sprint(value), nil
+	case []any:
+		entries := make([]string, len(value))
+		for i, entry := range value {
+			text, err := configText(entry)
+			if err != nil {
+				return "", err
+			}
+			entries[i] = text
+		}
+		return strings.Join(entries, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+var levelType = reflect.TypeOf(slog.Level(0))
+
+// converts every value into the field of models.ENVVars with the same name, and checks the settings that depend on each other
+func parseConfig(values map[string]configValue) (env models.ENVVars, err error) {
+	var errs []error
+	fields := reflect.ValueOf(&env).Elem()
+	for _, s := range settings {
+		v, found := values[s.name]
+		if !found {
+			if s.required {
+				errs = append(errs, errors.New(s.name+" is required"))
+			}
+			continue
+		}
+		if err := parseSetting(fields.FieldByName(s.name), s, v.value); err != nil {
+			errs = append(errs, fmt.Errorf("%s from the %s: %w", s.name, v.source, err))
+		}
+	}
+	if len(errs) > 0 {
+		return env, errors.Join(errs...)
+	}
+	env.LOG_FORMAT = strings.ToUpper(env.LOG_FORMAT)
+	env.TLS_CLIENT_AUTH = strings.ToUpper(env.TLS_CLIENT_AUTH)
+
+	if env.SERVER_PORT_HTTP == "" && env.SERVER_SOCKET == "" {
+		errs = append(errs, errors.New("SERVER_PORT_HTTP is required without SERVER_SOCKET"))
+	}
+	if env.HTTPS {
+		for _, name := range []string{"SERVER_PORT_HTTPS", "SERVER_CRT", "SERVER_KEY"} {
+			if _, found := values[name]; !found {
+				errs = append(errs, errors.New(name+" is required with HTTPS"))
+			}
+		}
+	}
+	if env.TLS_CLIENT_AUTH != "NONE" {
+		if !env.HTTPS {
+			errs = append(errs, errors.New("TLS_CLIENT_AUTH requires HTTPS"))
+		}
+		if env.TLS_CLIENT_CA == "" {
+			errs = append(errs, errors.New("TLS_CLIENT_CA is required with TLS_CLIENT_AUTH"))
+		}
+	} else if env.TLS_CLIENT_BIND {
+		errs = append(errs, errors.New("TLS_CLIENT_BIND requires TLS_CLIENT_AUTH"))
+	}
+	if env.DB_DSN == "" {
+		for _, name := range []string{"DB_HOST", "DB_PORT", "DB_USER", "DB_PWD"} {
+			if _, found := values[name]; !found {
+				errs = append(errs, errors.New(name+" is required without DB_DSN"))
+			}
+		}
+	}
+	if (env.DB_SSL_CERT == "") != (env.DB_SSL_KEY == "") {
+		errs = append(errs, errors.New("DB_SSL_CERT and DB_SSL_KEY must be given together"))
+	}
+	if env.DB_MAX_OPEN_CONNS != 0 && env.DB_MAX_IDLE_CONNS > env.DB_MAX_OPEN_CONNS {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS cannot be greater than DB_MAX_OPEN_CONNS"))
+	}
+	if env.WRITE_TIMEOUT <= env.READ_TIMEOUT {
+		errs = append(errs, errors.New("WRITE_TIMEOUT must be greater than READ_TIMEOUT"))
+	}
+	if env.CORS_CREDENTIALS && slices.Contains(env.CORS_ORIGINS, "*") {
+		errs = append(errs, errors.New("CORS_CREDENTIALS cannot be TRUE when CORS_ORIGINS is *"))
+	}
+	if env.METRICS_PORT != "" && (env.METRICS_PORT == env.SERVER_PORT_HTTP || (env.HTTPS && env.METRICS_PORT == env.SERVER_PORT_HTTPS)) {
+		errs = append(errs, errors.New("METRICS_PORT must differ from SERVER_PORT_HTTP and SERVER_PORT_HTTPS"))
+	}
+	return env, errors.Join(errs...)
+}
+
+func parseSetting(field reflect.Value, s setting, value string) error {
+	if s.check != nil {
+		if err := s.check(value); err != nil {
+			return err
+		}
+	}
+	if field.Type() == levelType {
+		var level slog.Level
+		if level.UnmarshalText([]byte(value)) != nil {
+			return fmt.Errorf("%q is not DEBUG, INFO, WARN, or ERROR", value)
+		}
+		field.Set(reflect.ValueOf(level))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not TRUE or FALSE", value)
+		}
+		field.SetBool(parsed)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Slice:
+		field.Set(reflect.ValueOf(splitList(value)))
+	case reflect.Uint16, reflect.Uint32:
+		parsed, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number from 0 to %v", value, uint64(math.MaxUint64)>>(64-field.Type().Bits()))
+		}
+		if s.positive && parsed == 0 {
+			return errors.New("must be greater than 0")
+		}
+		field.SetUint(parsed)
+	default:
+		return errors.New("has a field of unsupported type " + field.Type().String())
+	}
+	return nil
+}
+
+func checkPort(value string) error {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > math.MaxUint16 {
+		return fmt.Errorf("%q is not a port from 1 to %v", value, math.MaxUint16)
+	}
+	return nil
+}
+
+func checkLogFormat(value string) error {
+	if !strings.EqualFold(value, "TEXT") && !strings.EqualFold(value, "JSON") {
+		return fmt.Errorf("%q is not TEXT or JSON", value)
+	}
+	return nil
+}
+
+func checkOrigins(value string) error {
+	for _, origin := range splitList(value) {
+		if !validOrigin(origin) {
+			return fmt.Errorf("%q is not *, null, or scheme://host[:port]", origin)
+		}
+	}
+	return nil
+}
+
+func checkFileMode(value string) error {
+	if mode, err := strconv.ParseUint(value, 8, 32); err != nil || mode > 0777 {
+		return fmt.Errorf("%q is not octal permissions such as 0660", value)
+	}
+	return nil
+}
+
+func checkTrustedProxies(value string) error {
+	_, _, err := parseTrustedProxies(splitList(value))
+	return err
+}
+
+func checkClientAuth(value string) error {
+	if _, found := clientAuthTypes[strings.ToUpper(value)]; !found {
+		return fmt.Errorf("%q is not NONE, VERIFY_IF_GIVEN, or REQUIRE", value)
+	}
+	return nil
+}
+
+// lib/pq supports no other modes
+func checkSSLMode(value string) error {
+	if !slices.Contains([]string{"disable", "require", "verify-ca", "verify-full"}, value) {
+		return fmt.Errorf("%q is not disable, require, verify-ca, or verify-full", value)
+	}
+	return nil
+}
+
+// the DSN may hold a password, so the error of the driver is not repeated
+func checkDSN(value string) error {
+	if _, err := pq.NewConnector(value); err != nil {
+		return errors.New("not a valid connection string or postgres:// URL")
+	}
+	return nil
+}
+
+// splits a comma separated setting, ignoring empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// origins are only a scheme, host, and port, with null for pages that have no origin
+func validOrigin(origin string) bool {
+	if origin == "*" || origin == "null" {
+		return true
+	}
+	parsed, err := url.Parse(strings.TrimSuffix(origin, "/"))
+	return err == nil && parsed.Scheme != "" && parsed.Host != "" && parsed.Path == "" && parsed.RawQuery == "" && parsed.User == nil
+}
+
+// sets the package variables that handlers read the configuration from
+func applyConfig(env models.ENVVars) {
+	maxRecordCount = env.MAX_RECORD_COUNT
+	longPollMaxWaitTime = time.Duration(env.LONG_POLL_MAX_WAIT) * time.Second
+	utils.SetClockMaxDrift(env.CLOCK_MAX_DRIFT)
+	clockMaxDrift = env.CLOCK_MAX_DRIFT
+	idempotencyWindow = env.IDEMPOTENCY_WINDOW
+	bindClientCertificates = env.TLS_CLIENT_BIND
+	// already checked by checkTrustedProxies
+	trustedProxies, trustSocket, _ = parseTrustedProxies(env.TRUSTED_PROXIES)
+}
+
+// prints every setting in the YAML format of a config file, with its source as a comment and secrets redacted
+func (config Config) Print(w io.Writer) {
+	for _, s := range settings {
+		v, found := config.values[s.name]
+		if !found {
+			fmt.Fprintf(w, "# %s is not set\n", s.name)
+			continue
+		}
+		value := v.value
+		if s.secret {
+			value = "REDACTED"
+		}
+		fmt.Fprintf(w, "%s: %s # %s\n", s.name, strconv.Quote(value), v.source)
+	}
+}
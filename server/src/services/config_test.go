@@ -0,0 +1,165 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file tests the order in which LoadConfig takes settings from flags, the environment, the config file, and defaults, and the settings it rejects.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the settings a configuration needs to load, given in the environment
+var baseConfig = map[string]string{
+	"HTTPS":            "FALSE",
+	"SERVER_PORT_HTTP": "3001",
+	"DB_HOST":          "localhost",
+	"DB_PORT":          "3002",
+	"DB_USER":          "postgres",
+	"DB_PWD":           "password",
+}
+
+// clears every setting from the environment, then sets env, and writes file as a config file named name when given
+func setupConfig(t *testing.T, env map[string]string, name string, file string) {
+	t.Helper()
+	for _, s := range settings {
+		t.Setenv(s.name, "")
+	}
+	t.Setenv("CONFIG_FILE", "")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	if name != "" {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("CONFIG_FILE", path)
+	}
+}
+
+func withBase(env map[string]string) map[string]string {
+	merged := map[string]string{}
+	for key, value := range baseConfig {
+		merged[key] = value
+	}
+	for key, value := range env {
+		merged[key] = value
+	}
+	return merged
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		setting string
+		// empty when the setting is left unset
+		value  string
+		source string
+	}{
+		{name: "default", setting: "MAX_RECORD_COUNT", value: "1000", source: sourceDefault},
+		{name: "config file over default", file: "max_record_count: 500", setting: "MAX_RECORD_COUNT", value: "500", source: sourceFile},
+		{name: "environment over config file", env: map[string]string{"MAX_RECORD_COUNT": "400"}, file: "max_record_count: 500", setting: "MAX_RECORD_COUNT", value: "400", source: sourceEnv},
+		{name: "flag over environment", args: []string{"-max-record-count", "300"}, env: map[string]string{"MAX_RECORD_COUNT": "400"}, file: "max_record_count: 500", setting: "MAX_RECORD_COUNT", value: "300", source: sourceFlag},
+		{name: "empty environment is unset", env: map[string]string{"MAX_RECORD_COUNT": ""}, file: "max_record_count: 500", setting: "MAX_RECORD_COUNT", value: "500", source: sourceFile},
+		{name: "empty config file is unset", file: "max_record_count: ''", setting: "MAX_RECORD_COUNT", value: "1000", source: sourceDefault},
+		{name: "empty flag restores default", args: []string{"-max-record-count="}, env: map[string]string{"MAX_RECORD_COUNT": "400"}, file: "max_record_count: 500", setting: "MAX_RECORD_COUNT", value: "1000", source: sourceDefault},
+		{name: "empty flag clears setting", args: []string{"-cors-origins="}, env: map[string]string{"CORS_ORIGINS": "http://localhost:9000"}, file: "cors_origins: [\"null\"]", setting: "CORS_ORIGINS"},
+		{name: "empty flag restores conditional default", args: []string{"-cors-origins="}, env: map[string]string{"LOCAL_ONLY": "TRUE", "CORS_ORIGINS": "http://localhost:9000"}, setting: "CORS_ORIGINS", value: "*", source: sourceDefault},
+		{name: "flag overrides required setting", args: []string{"-db-host", "db.example.com"}, setting: "DB_HOST", value: "db.example.com", source: sourceFlag},
+		{name: "empty config flag skips CONFIG_FILE", args: []string{"-config="}, file: "max_record_count: 500", setting: "MAX_RECORD_COUNT", value: "1000", source: sourceDefault},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := ""
+			if test.file != "" {
+				name = "config.yaml"
+			}
+			setupConfig(t, withBase(test.env), name, test.file)
+			config, err := LoadConfig(test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, found := config.values[test.setting]
+			if test.value == "" {
+				if found {
+					t.Errorf("%s is %q from the %s, expected unset", test.setting, v.value, v.source)
+				}
+				return
+			}
+			if v.value != test.value || v.source != test.source {
+				t.Errorf("%s is %q from the %s, expected %q from the %s", test.setting, v.value, v.source, test.value, test.source)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	setupConfig(t, baseConfig, "config.toml", "max_record_count = 500\ncors_origins = [\"http://localhost:9000\", \"null\"]\nmulti_instance = true")
+	config, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Env.MAX_RECORD_COUNT != 500 || !config.Env.MULTI_INSTANCE || strings.Join(config.Env.CORS_ORIGINS, ",") != "http://localhost:9000,null" {
+		t.Errorf("config file was not applied: %+v", config.Env)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		// a config file is written when fileName is given
+		fileName string
+		file     string
+		// expected in the error
+		message string
+	}{
+		{name: "missing required", env: map[string]string{"HTTPS": ""}, message: "HTTPS is required"},
+		{name: "missing database", env: map[string]string{"DB_HOST": ""}, message: "DB_HOST is required without DB_DSN"},
+		{name: "missing port", env: map[string]string{"SERVER_PORT_HTTP": ""}, message: "SERVER_PORT_HTTP is required without SERVER_SOCKET"},
+		{name: "empty flag clears required", args: []string{"-https="}, message: "HTTPS is required"},
+		{name: "not a bool", env: map[string]string{"HTTPS": "yes"}, message: `HTTPS from the environment: "yes" is not TRUE or FALSE`},
+		{name: "not a port", args: []string{"-server-port-http", "70000"}, message: `SERVER_PORT_HTTP from the flag: "70000" is not a port`},
+		{name: "not a number", fileName: "config.yaml", file: "max_record_count: many", message: `MAX_RECORD_COUNT from the config file: "many" is not a whole number`},
+		{name: "not positive", env: map[string]string{"MAX_RECORD_COUNT": "0"}, message: "MAX_RECORD_COUNT from the environment: must be greater than 0"},
+		{name: "log format", env: map[string]string{"LOG_FORMAT": "XML"}, message: `"XML" is not TEXT or JSON`},
+		{name: "log level", env: map[string]string{"LOG_LEVEL": "LOUD"}, message: `"LOUD" is not DEBUG, INFO, WARN, or ERROR`},
+		{name: "origin", env: map[string]string{"CORS_ORIGINS": "localhost"}, message: `"localhost" is not *, null, or scheme://host[:port]`},
+		{name: "trusted proxy", env: map[string]string{"TRUSTED_PROXIES": "proxy"}, message: "TRUSTED_PROXIES from the environment"},
+		{name: "timeouts", env: map[string]string{"READ_TIMEOUT": "3", "WRITE_TIMEOUT": "3"}, message: "WRITE_TIMEOUT must be greater than READ_TIMEOUT"},
+		{name: "credentials with any origin", env: map[string]string{"CORS_ORIGINS": "*", "CORS_CREDENTIALS": "TRUE"}, message: "CORS_CREDENTIALS cannot be TRUE when CORS_ORIGINS is *"},
+		{name: "https without certificate", env: map[string]string{"HTTPS": "TRUE", "SERVER_PORT_HTTPS": "3443"}, message: "SERVER_CRT is required with HTTPS"},
+		{name: "binding without client auth", env: map[string]string{"TLS_CLIENT_BIND": "TRUE"}, message: "TLS_CLIENT_BIND requires TLS_CLIENT_AUTH"},
+		{name: "metrics port", env: map[string]string{"METRICS_PORT": "3001"}, message: "METRICS_PORT must differ"},
+		{name: "unknown setting", fileName: "config.yaml", file: "db_hots: localhost", message: "unknown setting db_hots in config file"},
+		{name: "config file type", fileName: "config.json", file: "{}", message: "must end in .yaml, .yml, or .toml"},
+		{name: "unknown flag", args: []string{"-db-hots", "localhost"}, message: "flag provided but not defined"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupConfig(t, withBase(test.env), test.fileName, test.file)
+			_, err := LoadConfig(test.args)
+			if err == nil {
+				t.Fatalf("expected an error containing %q", test.message)
+			}
+			if !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected an error containing %q, got %q", test.message, err)
+			}
+		})
+	}
+}
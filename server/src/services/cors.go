@@ -0,0 +1,120 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file applies the CORS policy from the .env variables, which decides the web and electron origins allowed to call the server from a browser.
+ * Requests from other origins are still handled, but without the headers the browser needs to let the page read the response.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"openorganizer/src/models"
+)
+
+// request headers of the protocol, allowed unless CORS_HEADERS is set
+var corsDefaultHeaders = []string{
+	"Content-Type",
+	"Accept",
+	"Content-Encoding",
+	"Protocol-Version",
+	"Clock",
+	"Conflict-Response",
+	"Folder-Delete-Policy",
+	"Idempotency-Key",
+	"Authorization",
+	requestIDHeader,
+}
+
+// response headers of the protocol a page may read, on top of those browsers always expose
+var corsExposedHeaders = []string{
+	requestIDHeader,
+	"Protocol-Version",
+	"Server-Clock",
+	"Idempotent-Replayed",
+	"Retry-After",
+	"Allow",
+}
+
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	headers     string
+	maxAge      string
+	credentials bool
+}
+
+func newCORSPolicy(env models.ENVVars) corsPolicy {
+	policy := corsPolicy{
+		origins:     map[string]bool{},
+		headers:     strings.Join(env.CORS_HEADERS, ", "),
+		maxAge:      strconv.Itoa(int(env.CORS_MAX_AGE)),
+		credentials: env.CORS_CREDENTIALS,
+	}
+	if len(env.CORS_HEADERS) == 0 {
+		policy.headers = strings.Join(corsDefaultHeaders, ", ")
+	}
+	for _, origin := range env.CORS_ORIGINS {
+		if origin == "*" {
+			policy.anyOrigin = true
+		}
+		policy.origins[normalizeOrigin(origin)] = true
+	}
+	return policy
+}
+
+// origins are compared without case or a trailing slash
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(origin, "/"))
+}
+
+// sets the origin headers if the request's origin is allowed, and reports whether it was
+func (policy corsPolicy) allowOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if policy.anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return origin != ""
+	}
+	// the response differs by origin, so caches must not share it between them
+	w.Header().Add("Vary", "Origin")
+	if origin == "" || !policy.origins[normalizeOrigin(origin)] {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if policy.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+func withCORS(policy corsPolicy) middleware {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if policy.allowOrigin(w, r) {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+			}
+			handler(w, r)
+		}
+	}
+}
+
+// answers a CORS preflight from an allowed origin with the methods of the path and the allowed headers
+// the origin headers are already set by withCORS
+func (policy corsPolicy) preflight(w http.ResponseWriter, r *http.Request, methods []string) {
+	if r.Header.Get("Access-Control-Request-Method") == "" || w.Header().Get("Access-Control-Allow-Origin") == "" {
+		return
+	}
+	w.Header().Del("Access-Control-Expose-Headers")
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", policy.headers)
+	w.Header().Set("Access-Control-Max-Age", policy.maxAge)
+}
@@ -0,0 +1,50 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file sends error responses, which carry a stable code from the catalogue in schema/protocol.json along with a message and the ID of the request.
+ * Errors are sent in the codec the client asked for, so JSON and Protobuf clients can decode them the same way as any other response.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"mime"
+	"net/http"
+
+	"openorganizer/src/models"
+	"openorganizer/src/utils"
+)
+
+// errors use the negotiated response codec where there is one, and otherwise the request's codec or the binary format
+func errorCodec(r *http.Request) *codec {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	requestCodec, _ := codecByMediaType(mediaType)
+	if c, acceptable := acceptedCodec(r.Header.Get("Accept"), requestCodec); acceptable {
+		return c
+	}
+	return requestCodec
+}
+
+// sends an error with the status of its code, and must be called before anything is written to the body
+func writeError(w http.ResponseWriter, r *http.Request, code models.ErrorCode, message string) {
+	response := models.ErrorResponse{Code: code, RequestID: requestID(r), Message: message}
+	contentType := contentTypeBinary
+	var body []byte
+	if c := errorCodec(r); c != nil {
+		contentType = c.contentType
+		body, _ = c.marshal(response)
+	} else {
+		body, _ = utils.PackErrorResponse(response)
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(models.ErrorStatus[code])
+	w.Write(body)
+}
@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-09-20
- * Updated: 2025-10-26
+ * Updated: 2026-10-19
  *
  * This file defines handlers for non-syncing requests, helper functions, and general services const values.
  * The other handler files use const values and helper functions defined here.
@@ -16,84 +16,112 @@ package services
 import (
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"openorganizer/src/db"
 	"openorganizer/src/models"
 	"openorganizer/src/utils"
 )
 
-const messageSizeLimit = 0x100
-const timeoutMessage = "Content-Length is too high, body is too large, or other read timeout"
-
-func enableCors(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
-}
-
-func redirectHTTPS(w http.ResponseWriter, r *http.Request, env models.ENVVars) {
-	host, _, _ := net.SplitHostPort(r.Host)
-	url := r.URL
-	url.Scheme = "https"
-	url.Host = net.JoinHostPort(host, env.SERVER_PORT_HTTPS)
-	http.Redirect(w, r, url.String(), http.StatusPermanentRedirect)
-}
-
-func verifyRequestSize(w http.ResponseWriter, r *http.Request, headerSize uint32, recordSize uint32, recordCount uint32) bool {
-	if recordCount > maxRecordCount {
-		http.Error(w, "recordCount higher than server limit of "+strconv.Itoa(int(maxRecordCount)), http.StatusBadRequest)
-		return false
+// serves requests that a trusted proxy received over HTTPS, and redirects the rest to HTTPS
+func redirectHTTPS(w http.ResponseWriter, r *http.Request, env models.ENVVars, handler http.Handler) {
+	_, https, proxied := forwarded(r)
+	if https {
+		handler.ServeHTTP(w, r)
+		return
 	}
-	expectedSize := headerSize + (recordSize * recordCount)
-	if r.ContentLength == int64(expectedSize) {
-		return true
+	hostname := (&url.URL{Host: r.Host}).Hostname()
+	target := r.URL
+	target.Scheme = "https"
+	target.Host = net.JoinHostPort(hostname, env.SERVER_PORT_HTTPS)
+	// a proxy serves HTTPS on the default port rather than the port of this server
+	if proxied {
+		target.Host = strings.TrimSuffix(net.JoinHostPort(hostname, "443"), ":443")
 	}
-	http.Error(w, "content length header does not match expected body size", http.StatusBadRequest)
-	return false
+	http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
 }
 
-func readRequestGeneral(w http.ResponseWriter, r *http.Request, headerSize uint32) ([]byte, error) {
-	enableCors(&w)
-
-	r.Body = http.MaxBytesReader(w, r.Body, messageSizeLimit)
+// reads whether the client sends and expects lastModified values as hybrid logical clock values (HLC) or milliseconds (MS)
+func readClockFormat(w http.ResponseWriter, r *http.Request) (hlc bool, err error) {
+	switch strings.ToUpper(r.Header.Get("Clock")) {
+	case "", "MS":
+		return false, nil
+	case "HLC":
+		return true, nil
+	}
+	writeError(w, r, models.ErrorInvalidClock, "Clock must be MS or HLC.")
+	return false, errors.New("")
+}
 
-	body, err := io.ReadAll(r.Body)
+// merges the lastModified of every received record into the server clock, converting from milliseconds first if needed
+// lastModified is always bytes 8-16 of a record, and the body is modified in place before it is unpacked
+// received holds the values as sent, which are compared against stored rows, so that a record only replaces a row the client had already seen
+// records are stored with the merged clock with Clock: HLC, since those clients merge Server-Clock into their own and so send values after it
+// clients sending milliseconds cannot, so their records are stored with the value sent, or their later edits would conflict with their own earlier ones
+func receiveClocks(w http.ResponseWriter, r *http.Request, body []byte, recordSize uint32) (hlc bool, received []int64, err error) {
+	hlc, err = readClockFormat(w, r)
 	if err != nil {
-		http.Error(w, timeoutMessage, http.StatusBadRequest)
-		return nil, errors.New("")
-	}
-	if !verifyRequestSize(w, r, headerSize, 0, 0) {
-		return nil, errors.New("")
-	}
+		return false, nil, err
+	}
+	for start := uint32(utils.SyncupHeaderSize); start < uint32(len(body)); start += recordSize {
+		lastModified := utils.BytesToBigint(body[start+8 : start+16])
+		if !hlc {
+			lastModified = utils.MillisToClock(lastModified)
+		}
+		clock, err := utils.ClockReceive(lastModified)
+		if err != nil {
+			w.Header().Set("Server-Clock", strconv.FormatInt(clock, 10))
+			writeError(w, r, models.ErrorClockDrift, "lastModified is too far ahead of the server clock.")
+			return false, nil, err
+		}
+		received = append(received, lastModified)
+		if !hlc {
+			clock = lastModified
+		}
+		copy(body[start+8:start+16], utils.BigintToBytes(clock))
+	}
+	w.Header().Set("Server-Clock", strconv.FormatInt(utils.ClockNow(), 10))
+	return hlc, received, nil
+}
 
-	return body, nil
+// converts the lastModified of every packed record back to milliseconds if needed, and sets the server clock header
+// must be called before anything is written to the body
+func sendClocks(w http.ResponseWriter, hlc bool, packed []byte, recordSize uint32) {
+	const recordCountSize = 4
+	if !hlc {
+		for start := uint32(recordCountSize); start < uint32(len(packed)); start += recordSize {
+			lastModified := utils.BytesToBigint(packed[start+8 : start+16])
+			copy(packed[start+8:start+16], utils.BigintToBytes(utils.ClockToMillis(lastModified)))
+		}
+	}
+	w.Header().Set("Server-Clock", strconv.FormatInt(utils.ClockNow(), 10))
 }
 
 // bound HTTP handlers
 
 func root(w http.ResponseWriter, r *http.Request) {
-	enableCors(&w)
-
-	fmt.Fprintf(w, "%s", utils.IntToBytes(int32(maxRecordCount)))
+	fmt.Fprintf(w, "%s", utils.PackRootResponse(models.RootResponse{MaxRecordCount: maxRecordCount}))
 }
 
 func register(w http.ResponseWriter, r *http.Request) {
-	const headerSize = 128
-	body, err := readRequestGeneral(w, r, headerSize)
-	if err != nil {
+	request := utils.UnpackRegisterRequest(requestBody(r))
+	userLogin, userData := request.Login, request.Data
+	if !db.ValidateUsername(userLogin.Username) {
+		writeError(w, r, models.ErrorInvalidUsername, "Invalid character found in username.")
 		return
 	}
-
-	userLogin, userData := utils.UnpackRegister(body)
-	if !db.ValidateUsername(userLogin.Username) {
-		http.Error(w, "Invalid character found in username.", http.StatusBadRequest)
+	response, err := db.RegisterUser(r.Context(), userLogin, userData, clientFingerprint(r))
+	if errors.Is(err, db.ErrUsernameTaken) {
+		writeError(w, r, models.ErrorUsernameTaken, "An account with that username already exists.")
 		return
 	}
-	response, err := db.RegisterUser(userLogin, userData)
-	if err != nil {
-		http.Error(w, "Account with that username already exists.", http.StatusUnauthorized)
+	if utils.LogError(r.Context(), err, "register user") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 
@@ -101,20 +129,18 @@ func register(w http.ResponseWriter, r *http.Request) {
 }
 
 func login(w http.ResponseWriter, r *http.Request) {
-	const headerSize = 64
-	body, err := readRequestGeneral(w, r, headerSize)
-	if err != nil {
+	userLogin := utils.UnpackUserLogin(requestBody(r))
+	if !db.ValidateUsername(userLogin.Username) {
+		writeError(w, r, models.ErrorInvalidUsername, "Invalid character found in username.")
 		return
 	}
-
-	userLogin := utils.UnpackLogin(body)
-	if !db.ValidateUsername(userLogin.Username) {
-		http.Error(w, "Invalid character found in username.", http.StatusBadRequest)
+	response, err := db.Login(r.Context(), userLogin, clientFingerprint(r))
+	if errors.Is(err, db.ErrInvalidLogin) {
+		writeError(w, r, models.ErrorInvalidLogin, "Invalid username+password combination.")
 		return
 	}
-	response, err := db.Login(userLogin)
-	if err != nil {
-		http.Error(w, "Invalid username+password combination.", http.StatusUnauthorized)
+	if utils.LogError(r.Context(), err, "login") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 
@@ -122,53 +148,106 @@ func login(w http.ResponseWriter, r *http.Request) {
 }
 
 func changeLogin(w http.ResponseWriter, r *http.Request) {
-	const headerSize = 192
-	body, err := readRequestGeneral(w, r, headerSize)
-	if err != nil {
-		return
-	}
-
-	userLogin, userLoginNew, userData := utils.UnpackChangeLogin(body)
+	request := utils.UnpackChangeLoginRequest(requestBody(r))
+	userLogin, userLoginNew, userData := request.Login, request.LoginNew, request.Data
 	if !db.ValidateUsername(userLogin.Username) {
-		http.Error(w, "Invalid character found in username.", http.StatusBadRequest)
+		writeError(w, r, models.ErrorInvalidUsername, "Invalid character found in username.")
 		return
 	}
 	if !db.ValidateUsername(userLoginNew.Username) {
-		http.Error(w, "Invalid character found in username.", http.StatusBadRequest)
+		writeError(w, r, models.ErrorInvalidUsername, "Invalid character found in username.")
 		return
 	}
-	_, err = db.Login(userLogin)
-	if err != nil {
-		http.Error(w, "Invalid username+password combination.", http.StatusUnauthorized)
+	_, err := db.Login(r.Context(), userLogin, clientFingerprint(r))
+	if errors.Is(err, db.ErrInvalidLogin) {
+		writeError(w, r, models.ErrorInvalidLogin, "Invalid username+password combination.")
 		return
 	}
-	response, err := db.ModifyUser(userLogin, userLoginNew, userData)
-	if err != nil {
-		http.Error(w, "An account with that username already exists.", http.StatusUnauthorized)
+	if utils.LogError(r.Context(), err, "login") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
+		return
+	}
+	response, err := db.ModifyUser(r.Context(), userLogin, userLoginNew, userData, clientFingerprint(r))
+	if errors.Is(err, db.ErrUsernameTaken) {
+		writeError(w, r, models.ErrorUsernameTaken, "An account with that username already exists.")
+		return
+	}
+	if utils.LogError(r.Context(), err, "modify user") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 
 	fmt.Fprintf(w, "%s", response)
 }
 
-func lastUpdated(w http.ResponseWriter, r *http.Request) {
-	const headerSize = 40
-	body, err := readRequestGeneral(w, r, headerSize)
-	if err != nil {
-		return
+// reads the user's lastUpdated, writing the error response if it fails
+func readLastUpdated(w http.ResponseWriter, r *http.Request, userID int64) (row models.RowLastUpdated, err error) {
+	row, err = db.GetLastUpdated(r.Context(), userID)
+	if errors.Is(err, db.ErrNoLastUpdated) {
+		utils.LogError(r.Context(), err, "read lastUpdated")
+		writeError(w, r, models.ErrorNoLastUpdated, "No lastUpdated entry found for the user.")
+		return row, err
+	}
+	if utils.LogError(r.Context(), err, "read lastUpdated") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 	}
+	return row, err
+}
 
-	userAuth := utils.UnpackUserAuth(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+// with the long polling body, the response is held until any lastUpdated is newer than the client's, the wait runs out, or the server shuts down
+func lastUpdated(w http.ResponseWriter, r *http.Request) {
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	longPoll := len(body) == utils.LastUpdatedWaitSize
+
+	if !longPoll {
+		row, err := readLastUpdated(w, r, userAuth.UserID)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "%s", utils.PackLastUpdated(row))
 		return
 	}
 
-	row, err := db.GetLastUpdated(userAuth.UserID)
-	if err != nil {
-		http.Error(w, "No lastUpdated entry found???", http.StatusUnauthorized)
-		return
+	request := utils.UnpackLastUpdatedWait(body)
+	known := *request.Known
+	wait := min(time.Duration(request.MaxWait)*time.Millisecond, longPollMaxWaitTime)
+	// subscribed before the first check so that a change in between is not missed
+	changes := subscribe(userAuth.UserID)
+	defer unsubscribe(userAuth.UserID, changes)
+	timeout := time.After(wait)
+	for {
+		row, err := readLastUpdated(w, r, userAuth.UserID)
+		if err != nil {
+			return
+		}
+		if lastUpdatedAdvanced(row, known) {
+			fmt.Fprintf(w, "%s", utils.PackLastUpdated(row))
+			return
+		}
+		select {
+		case <-changes:
+		case <-timeout:
+			fmt.Fprintf(w, "%s", utils.PackLastUpdated(row))
+			return
+		case <-shutdown:
+			fmt.Fprintf(w, "%s", utils.PackLastUpdated(row))
+			return
+		case <-r.Context().Done():
+			return
+		}
 	}
+}
 
-	fmt.Fprintf(w, "%s", utils.PackLastUpdated(row))
+func lastUpdatedAdvanced(row models.RowLastUpdated, known models.RowLastUpdated) bool {
+	return row.LastUpNotes > known.LastUpNotes ||
+		row.LastUpReminders > known.LastUpReminders ||
+		row.LastUpDaily > known.LastUpDaily ||
+		row.LastUpWeekly > known.LastUpWeekly ||
+		row.LastUpMonthly > known.LastUpMonthly ||
+		row.LastUpYearly > known.LastUpYearly ||
+		row.LastUpExtensions > known.LastUpExtensions ||
+		row.LastUpOverrides > known.LastUpOverrides ||
+		row.LastUpFolders > known.LastUpFolders ||
+		row.LastUpDeleted > known.LastUpDeleted
 }
@@ -0,0 +1,198 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file defines the handler for pushing change notifications to clients over Server-Sent Events.
+ * Syncup handlers publish a change after committing, and every open stream of that user is sent the table and its new lastUpdated.
+ * With multiple server instances, changes are published through the database so that streams held by other instances receive them.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"openorganizer/src/db"
+	"openorganizer/src/models"
+	"openorganizer/src/utils"
+)
+
+const eventsHeartbeatInterval = 15 * time.Second
+const eventsTokenCheckInterval = 30 * time.Second
+const eventsRetryMillis = 5000
+
+// changes waiting to be written to a stream, extra changes are dropped since the next one carries a newer lastUpdated anyway
+const eventsBufferSize = 16
+
+type changeEvent struct {
+	table       string
+	lastUpdated int64
+}
+
+var subscribersMutex sync.Mutex
+var subscribers = map[int64]map[chan changeEvent]struct{}{}
+var multiInstance bool
+
+func subscribe(userID int64) chan changeEvent {
+	changes := make(chan changeEvent, eventsBufferSize)
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	if subscribers[userID] == nil {
+		subscribers[userID] = map[chan changeEvent]struct{}{}
+	}
+	subscribers[userID][changes] = struct{}{}
+	return changes
+}
+
+func unsubscribe(userID int64, changes chan changeEvent) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	delete(subscribers[userID], changes)
+	if len(subscribers[userID]) == 0 {
+		delete(subscribers, userID)
+	}
+}
+
+// notifies every open stream of the user that a table has changed, on every instance
+// table is the route of the table after syncup/ or syncdown/
+func publishChange(ctx context.Context, userID int64, table string, lastUpdated int64) {
+	if multiInstance {
+		// the listener delivers it back to this instance as well
+		if utils.LogError(ctx, db.NotifyChange(ctx, userID, table, lastUpdated), "notify change", "userID", userID, "table", table) {
+			deliverChange(userID, table, lastUpdated)
+		}
+		return
+	}
+	deliverChange(userID, table, lastUpdated)
+}
+
+// notifies every open stream of the user on this instance
+func deliverChange(userID int64, table string, lastUpdated int64) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	for changes := range subscribers[userID] {
+		select {
+		case changes <- changeEvent{table: table, lastUpdated: lastUpdated}:
+		default:
+		}
+	}
+}
+
+// sends every table's current lastUpdated to all streams on this instance, for when changes may have been missed
+func deliverAllLastUpdated() {
+	subscribersMutex.Lock()
+	var userIDs []int64
+	for userID := range subscribers {
+		userIDs = append(userIDs, userID)
+	}
+	subscribersMutex.Unlock()
+
+	ctx := context.Background()
+	for _, userID := range userIDs {
+		row, err := db.GetLastUpdated(ctx, userID)
+		if utils.LogError(ctx, err, "read lastUpdated", "userID", userID) {
+			continue
+		}
+		for _, change := range lastUpdatedChanges(row) {
+			deliverChange(userID, change.table, change.lastUpdated)
+		}
+	}
+}
+
+func lastUpdatedChanges(row models.RowLastUpdated) []changeEvent {
+	return []changeEvent{
+		{"notes", row.LastUpNotes},
+		{"reminders", row.LastUpReminders},
+		{"reminders/daily", row.LastUpDaily},
+		{"reminders/weekly", row.LastUpWeekly},
+		{"reminders/monthly", row.LastUpMonthly},
+		{"reminders/yearly", row.LastUpYearly},
+		{"extensions", row.LastUpExtensions},
+		{"overrides", row.LastUpOverrides},
+		{"folders", row.LastUpFolders},
+		{"deleted", row.LastUpDeleted},
+	}
+}
+
+// starts forwarding changes published by other server instances until ctx is done, if there are multiple
+func LaunchChangeListener(ctx context.Context, env models.ENVVars) error {
+	multiInstance = env.MULTI_INSTANCE
+	if !multiInstance {
+		return nil
+	}
+	return db.ListenForChanges(ctx, deliverChange, deliverAllLastUpdated)
+}
+
+func writeChangeEvent(w http.ResponseWriter, change changeEvent) {
+	fmt.Fprintf(w, "event: changed\nid: %v\ndata: %s %v\n\n", change.lastUpdated, change.table, change.lastUpdated)
+}
+
+// bound HTTP handlers
+
+// stream stays open until the client disconnects, the token expires, or the server shuts down, starting with the current lastUpdated of every table
+func events(w http.ResponseWriter, r *http.Request) {
+	userAuth := requestAuth(r)
+	row, err := readLastUpdated(w, r, userAuth.UserID)
+	if err != nil {
+		return
+	}
+
+	// the stream outlives the server's read and write timeouts
+	controller := http.NewResponseController(w)
+	if controller.SetReadDeadline(time.Time{}) != nil || controller.SetWriteDeadline(time.Time{}) != nil {
+		writeError(w, r, models.ErrorStreamingUnsupported, "Streaming is not supported on this connection.")
+		return
+	}
+	changes := subscribe(userAuth.UserID)
+	defer unsubscribe(userAuth.UserID, changes)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "retry: %v\n\n", eventsRetryMillis)
+	for _, change := range lastUpdatedChanges(row) {
+		writeChangeEvent(w, change)
+	}
+	controller.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+	tokenCheck := time.NewTicker(eventsTokenCheckInterval)
+	defer tokenCheck.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		// the client reconnects after the retry time, to another instance if this one is gone
+		case <-shutdown:
+			return
+		case change := <-changes:
+			writeChangeEvent(w, change)
+		case <-heartbeat.C:
+			fmt.Fprintf(w, ": heartbeat\n\n")
+		case <-tokenCheck.C:
+			// checking must not refresh the token, or an idle stream would keep it alive forever
+			// a failed check is tried again on the next tick instead of ending the stream
+			valid, err := db.CheckTokenValid(r.Context(), userAuth, clientFingerprint(r))
+			if utils.LogError(r.Context(), err, "check token", "userID", userAuth.UserID) {
+				break
+			}
+			if !valid {
+				fmt.Fprintf(w, "event: expired\ndata: \n\n")
+				controller.Flush()
+				return
+			}
+		}
+		if controller.Flush() != nil {
+			return
+		}
+	}
+}
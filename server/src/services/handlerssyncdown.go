@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-09-25
- * Updated: 2025-10-18
+ * Updated: 2026-10-19
  *
  * This file defines handlers for receiving syncdown requests.
  *
@@ -13,254 +13,227 @@
 package services
 
 import (
-	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"openorganizer/src/db"
+	"openorganizer/src/models"
 	"openorganizer/src/utils"
 )
 
-func readRequestSyncdown(w http.ResponseWriter, r *http.Request) ([]byte, error) {
-	enableCors(&w)
-	const syncdownHeaderSize = 56
-
-	r.Body = http.MaxBytesReader(w, r.Body, syncdownHeaderSize)
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, timeoutMessage, http.StatusBadRequest)
-		return nil, errors.New("")
-	}
-	if !verifyRequestSize(w, r, syncdownHeaderSize, 0, 0) {
-		return nil, errors.New("")
-	}
-
-	return body, nil
-}
-
 // bound HTTP handlers
 
 func downNotes(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetItemRows(r.Context(), "notes", request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "notes") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
-
-	const expectedEncrDataSize = 128
-	rows, _ := db.GetItemRows("notes", userAuth.UserID, startTime, endTime)
-	response, err := utils.PackItems(rows, expectedEncrDataSize)
+	response, err := utils.PackNotesSyncdown(models.SyncdownResponse[models.RowItems]{Records: rows})
 	if err != nil {
-		http.Error(w, "one or more rows had the incorrect encrypted data size", http.StatusInternalServerError)
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
 		return
 	}
 
+	sendClocks(w, hlc, response, notesRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
 
 func downReminders(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetItemRows(r.Context(), "reminders", request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
-
-	const expectedEncrDataSize = 96
-	rows, _ := db.GetItemRows("reminders", userAuth.UserID, startTime, endTime)
-	response, err := utils.PackItems(rows, expectedEncrDataSize)
+	response, err := utils.PackRemindersSyncdown(models.SyncdownResponse[models.RowItems]{Records: rows})
 	if err != nil {
-		http.Error(w, "one or more rows had the incorrect encrypted data size", http.StatusInternalServerError)
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
 		return
 	}
 
+	sendClocks(w, hlc, response, remindersRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
 
 func downRemindersDaily(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetItemRows(r.Context(), "daily_reminders", request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "daily_reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
-
-	const expectedEncrDataSize = 96
-	rows, _ := db.GetItemRows("daily_reminders", userAuth.UserID, startTime, endTime)
-	response, err := utils.PackItems(rows, expectedEncrDataSize)
+	response, err := utils.PackRemindersSyncdown(models.SyncdownResponse[models.RowItems]{Records: rows})
 	if err != nil {
-		http.Error(w, "one or more rows had the incorrect encrypted data size", http.StatusInternalServerError)
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
 		return
 	}
 
+	sendClocks(w, hlc, response, remindersRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
 
 func downRemindersWeekly(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetItemRows(r.Context(), "weekly_reminders", request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "weekly_reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
-
-	const expectedEncrDataSize = 96
-	rows, _ := db.GetItemRows("weekly_reminders", userAuth.UserID, startTime, endTime)
-	response, err := utils.PackItems(rows, expectedEncrDataSize)
+	response, err := utils.PackRemindersSyncdown(models.SyncdownResponse[models.RowItems]{Records: rows})
 	if err != nil {
-		http.Error(w, "one or more rows had the incorrect encrypted data size", http.StatusInternalServerError)
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
 		return
 	}
 
+	sendClocks(w, hlc, response, remindersRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
 
 func downRemindersMonthly(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetItemRows(r.Context(), "monthly_reminders", request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "monthly_reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
-
-	const expectedEncrDataSize = 96
-	rows, _ := db.GetItemRows("monthly_reminders", userAuth.UserID, startTime, endTime)
-	response, err := utils.PackItems(rows, expectedEncrDataSize)
+	response, err := utils.PackRemindersSyncdown(models.SyncdownResponse[models.RowItems]{Records: rows})
 	if err != nil {
-		http.Error(w, "one or more rows had the incorrect encrypted data size", http.StatusInternalServerError)
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
 		return
 	}
 
+	sendClocks(w, hlc, response, remindersRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
 
 func downRemindersYearly(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetItemRows(r.Context(), "yearly_reminders", request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "yearly_reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
-
-	const expectedEncrDataSize = 96
-	rows, _ := db.GetItemRows("yearly_reminders", userAuth.UserID, startTime, endTime)
-	response, err := utils.PackItems(rows, expectedEncrDataSize)
+	response, err := utils.PackRemindersSyncdown(models.SyncdownResponse[models.RowItems]{Records: rows})
 	if err != nil {
-		http.Error(w, "one or more rows had the incorrect encrypted data size", http.StatusInternalServerError)
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
 		return
 	}
 
+	sendClocks(w, hlc, response, remindersRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
 
 func downExtensions(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetExtensionRows(r.Context(), request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "extensions") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
-
-	const expectedEncrDataSize = 64
-	rows, _ := db.GetExtensionRows(userAuth.UserID, startTime, endTime)
-	response, err := utils.PackExtensions(rows, expectedEncrDataSize)
+	response, err := utils.PackExtensionsSyncdown(models.SyncdownResponse[models.RowExtensions]{Records: rows})
 	if err != nil {
-		http.Error(w, "one or more rows had the incorrect encrypted data size", http.StatusInternalServerError)
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
 		return
 	}
 
+	sendClocks(w, hlc, response, extensionsRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
 
 func downOverrides(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetOverrideRows(r.Context(), request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "overrides") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
-
-	const expectedEncrDataSize = 64
-	rows, _ := db.GetOverrideRows(userAuth.UserID, startTime, endTime)
-	response, err := utils.PackOverrides(rows, expectedEncrDataSize)
+	response, err := utils.PackOverridesSyncdown(models.SyncdownResponse[models.RowOverrides]{Records: rows})
 	if err != nil {
-		http.Error(w, "one or more rows had the incorrect encrypted data size", http.StatusInternalServerError)
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
 		return
 	}
 
+	sendClocks(w, hlc, response, overridesRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
 
 func downFolders(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetFolderRows(r.Context(), request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "folders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
-
-	const expectedEncrDataSize = 64
-	rows, _ := db.GetFolderRows(userAuth.UserID, startTime, endTime)
-	response, err := utils.PackFolders(rows, expectedEncrDataSize)
+	response, err := utils.PackFoldersSyncdown(models.SyncdownResponse[models.RowFolders]{Records: rows})
 	if err != nil {
-		http.Error(w, "one or more rows had the incorrect encrypted data size", http.StatusInternalServerError)
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
 		return
 	}
 
+	sendClocks(w, hlc, response, foldersRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
 
 func downDeleted(w http.ResponseWriter, r *http.Request) {
-	body, err := readRequestSyncdown(w, r)
+	request := utils.UnpackSyncdownRequest(requestBody(r))
+	hlc, err := readClockFormat(w, r)
 	if err != nil {
 		return
 	}
 
-	userAuth, startTime, endTime := utils.UnpackSyncdownHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	rows, err := db.GetDeletedRows(r.Context(), request.Auth.UserID, request.StartTime, request.EndTime)
+	if utils.LogError(r.Context(), err, "read rows", "table", "deleted") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
+	response := utils.PackDeletedSyncdown(models.SyncdownResponse[models.RowDeleted]{Records: rows})
 
-	rows, _ := db.GetDeletedRows(userAuth.UserID, startTime, endTime)
-	response := utils.PackDeleted(rows)
-
+	sendClocks(w, hlc, response, deletedRecordSize)
 	fmt.Fprintf(w, "%s", response)
 }
@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-09-25
- * Updated: 2025-10-19
+ * Updated: 2026-10-19
  *
  * This file defines handlers for receiving syncup requests.
  *
@@ -13,298 +13,528 @@
 package services
 
 import (
-	"encoding/binary"
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"strconv"
+	"strings"
+
 	"openorganizer/src/db"
+	"openorganizer/src/models"
 	"openorganizer/src/utils"
 )
 
-// reads in data and validates that the header + records is the correct size
-func readRequestSyncup(w http.ResponseWriter, r *http.Request, recordSize uint32) ([]byte, error) {
-	enableCors(&w)
-	const syncupHeaderSize = 44
+// reads whether the client wants only the fail bits for rejected records, or the fail bits followed by the stored rows that won
+// the winning rows are packed in the same format as the syncdown response of the table
+func readConflictResponse(w http.ResponseWriter, r *http.Request) (detailed bool, err error) {
+	switch strings.ToUpper(r.Header.Get("Conflict-Response")) {
+	case "", "FAILS":
+		return false, nil
+	case "DETAILED":
+		return true, nil
+	}
+	writeError(w, r, models.ErrorInvalidConflictResponse, "Conflict-Response must be FAILS or DETAILED.")
+	return false, errors.New("")
+}
 
-	var maxSyncupSize = syncupHeaderSize + (maxRecordCount * recordSize)
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxSyncupSize))
-	body, err := io.ReadAll(r.Body)
+// appends the stored rows that won over the rejected records to the fail bits, packed like the syncdown response of the table
+// a rejected record without a stored row, such as a deletion refused by the folder policy, has no entry, so clients match the rows to their records by ID
+// the rows are read in the transaction of the batch, so a failure to read them fails the batch instead of answering a committed one with an error
+func appendConflicts[Row any](w http.ResponseWriter, r *http.Request, response []byte, hlc bool, recordSize uint32,
+	conflicts []Row, pack func(models.SyncdownResponse[Row]) ([]byte, error)) ([]byte, error) {
+	packed, err := pack(models.SyncdownResponse[Row]{Records: conflicts})
 	if err != nil {
-		http.Error(w, timeoutMessage, http.StatusBadRequest)
-		return nil, errors.New("")
+		writeError(w, r, models.ErrorStoredRecordSize, "One or more stored records have the incorrect encrypted data size.")
+		return nil, err
+	}
+	sendClocks(w, hlc, packed, recordSize)
+	return append(response, packed...), nil
+}
+
+// headers that change what a syncup writes or responds with, so a retry has to repeat them to be replayed
+var idempotentHeaders = []string{"Clock", "Conflict-Response", "Folder-Delete-Policy"}
+
+// reserves the idempotency key for this request, or writes the stored response if the user already sent this request with the same key
+// replayed is true if the handler is done, either from a replay or a written error, including when the request holding the key is still running
+func replayIdempotent(w http.ResponseWriter, r *http.Request, userID int64, body []byte) (idempotencyKey string, requestHash []byte, replayed bool) {
+	const maxIdempotencyKeyLength = 64
+	idempotencyKey = r.Header.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		return "", nil, false
 	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		writeError(w, r, models.ErrorInvalidIdempotencyKey, "Idempotency-Key is longer than "+strconv.Itoa(maxIdempotencyKeyLength)+" characters.")
+		return "", nil, true
+	}
+
+	hasher := sha256.New()
+	hasher.Write([]byte(r.URL.Path))
+	for _, header := range idempotentHeaders {
+		hasher.Write([]byte("\n" + strings.ToUpper(r.Header.Get(header))))
+	}
+	hasher.Write([]byte("\n"))
+	hasher.Write(body)
+	requestHash = hasher.Sum(nil)
 
-	if r.ContentLength < 44 {
-		http.Error(w, "content length header does not match expected body size", http.StatusBadRequest)
-		return nil, errors.New("")
+	reserved, err := db.ReserveIdempotencyKey(r.Context(), userID, idempotencyKey, requestHash)
+	if utils.LogError(r.Context(), err, "reserve idempotency key") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
+		return "", nil, true
 	}
-	var recordCount uint32 = binary.LittleEndian.Uint32(body[40:44])
-	if !verifyRequestSize(w, r, syncupHeaderSize, recordSize, recordCount) {
-		return nil, errors.New("")
+	if reserved {
+		return idempotencyKey, requestHash, false
 	}
 
-	return body, nil
+	storedHash, response, found, err := db.GetIdempotentResponse(r.Context(), userID, idempotencyKey)
+	if utils.LogError(r.Context(), err, "read idempotent response") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
+		return "", nil, true
+	}
+	if found && !bytes.Equal(storedHash, requestHash) {
+		writeError(w, r, models.ErrorIdempotencyKeyReused, "Idempotency-Key was already used for a different request.")
+		return "", nil, true
+	}
+	// the key was taken by a request that has not finished, or it expired in between, and either way a retry settles it
+	if !found || response == nil {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, models.ErrorIdempotencyKeyInProgress, "A request with the same Idempotency-Key is still being handled.")
+		return "", nil, true
+	}
+	w.Header().Set("Server-Clock", strconv.FormatInt(utils.ClockNow(), 10))
+	w.Header().Set("Idempotent-Replayed", "TRUE")
+	fmt.Fprintf(w, "%s", response)
+	return "", nil, true
+}
+
+// stores the response of an executed request so that retries with the same idempotency key are replayed
+func storeIdempotent(r *http.Request, userID int64, idempotencyKey string, requestHash []byte, response []byte) {
+	if idempotencyKey == "" {
+		return
+	}
+	err := db.StoreIdempotentResponse(r.Context(), userID, idempotencyKey, requestHash, response)
+	utils.LogError(r.Context(), err, "store idempotent response")
+}
+
+// deferred by handlers that reserved a key, to free it if they stopped before storing a response
+func releaseIdempotent(r *http.Request, userID int64, idempotencyKey string, requestHash []byte) {
+	if idempotencyKey == "" {
+		return
+	}
+	err := db.ReleaseIdempotencyKey(r.Context(), userID, idempotencyKey, requestHash)
+	utils.LogError(r.Context(), err, "release idempotency key")
 }
 
 // bound HTTP handlers
 
 func upNotes(w http.ResponseWriter, r *http.Request) {
-	const upNotesRecordSize uint32 = 144
-	body, err := readRequestSyncup(w, r, upNotesRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
 	if err != nil {
 		return
 	}
-
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
 		return
 	}
-
-	rows := utils.UnpackItems(body, upNotesRecordSize)
-	fails, err := db.InsertItems("notes", rows)
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, notesRecordSize)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	rows := utils.StampItems(utils.UnpackNotesSyncup(body))
+	fails, conflicts, err := db.InsertItems(r.Context(), "notes", rows, received, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "notes") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpNotes", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpNotes", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "notes", rows[0].LastUpdated)
+	}
+
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, notesRecordSize, conflicts, utils.PackNotesSyncdown)
+		if err != nil {
+			return
+		}
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
 
 func upReminders(w http.ResponseWriter, r *http.Request) {
-	const upRemindersRecordSize uint32 = 112
-	body, err := readRequestSyncup(w, r, upRemindersRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
 	if err != nil {
 		return
 	}
-
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
 		return
 	}
-
-	rows := utils.UnpackItems(body, upRemindersRecordSize)
-	fails, err := db.InsertItems("reminders", rows)
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, remindersRecordSize)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	rows := utils.StampItems(utils.UnpackRemindersSyncup(body))
+	fails, conflicts, err := db.InsertItems(r.Context(), "reminders", rows, received, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpReminders", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpReminders", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "reminders", rows[0].LastUpdated)
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, remindersRecordSize, conflicts, utils.PackRemindersSyncdown)
+		if err != nil {
+			return
+		}
+	}
+
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
 
 func upRemindersDaily(w http.ResponseWriter, r *http.Request) {
-	const upDailyRecordSize uint32 = 112
-	body, err := readRequestSyncup(w, r, upDailyRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
 	if err != nil {
 		return
 	}
-
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
 		return
 	}
-
-	rows := utils.UnpackItems(body, upDailyRecordSize)
-	fails, err := db.InsertItems("daily_reminders", rows)
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, remindersRecordSize)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	rows := utils.StampItems(utils.UnpackRemindersSyncup(body))
+	fails, conflicts, err := db.InsertItems(r.Context(), "daily_reminders", rows, received, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "daily_reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpDaily", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpDaily", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "reminders/daily", rows[0].LastUpdated)
+	}
+
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, remindersRecordSize, conflicts, utils.PackRemindersSyncdown)
+		if err != nil {
+			return
+		}
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
 
 func upRemindersWeekly(w http.ResponseWriter, r *http.Request) {
-	const upWeeklyRecordSize uint32 = 112
-	body, err := readRequestSyncup(w, r, upWeeklyRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
 	if err != nil {
 		return
 	}
-
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
 		return
 	}
-
-	rows := utils.UnpackItems(body, upWeeklyRecordSize)
-	fails, err := db.InsertItems("weekly_reminders", rows)
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, remindersRecordSize)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	rows := utils.StampItems(utils.UnpackRemindersSyncup(body))
+	fails, conflicts, err := db.InsertItems(r.Context(), "weekly_reminders", rows, received, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "weekly_reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpWeekly", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpWeekly", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "reminders/weekly", rows[0].LastUpdated)
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, remindersRecordSize, conflicts, utils.PackRemindersSyncdown)
+		if err != nil {
+			return
+		}
+	}
+
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
 
 func upRemindersMonthly(w http.ResponseWriter, r *http.Request) {
-	const upMonthlyRecordSize uint32 = 112
-	body, err := readRequestSyncup(w, r, upMonthlyRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
 	if err != nil {
 		return
 	}
-
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
 		return
 	}
-
-	rows := utils.UnpackItems(body, upMonthlyRecordSize)
-	fails, err := db.InsertItems("monthly_reminders", rows)
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, remindersRecordSize)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	rows := utils.StampItems(utils.UnpackRemindersSyncup(body))
+	fails, conflicts, err := db.InsertItems(r.Context(), "monthly_reminders", rows, received, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "monthly_reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpMonthly", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpMonthly", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "reminders/monthly", rows[0].LastUpdated)
+	}
+
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, remindersRecordSize, conflicts, utils.PackRemindersSyncdown)
+		if err != nil {
+			return
+		}
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
 
 func upRemindersYearly(w http.ResponseWriter, r *http.Request) {
-	const upYearlyRecordSize uint32 = 112
-	body, err := readRequestSyncup(w, r, upYearlyRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
 	if err != nil {
 		return
 	}
-
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
 		return
 	}
-
-	rows := utils.UnpackItems(body, upYearlyRecordSize)
-	fails, err := db.InsertItems("yearly_reminders", rows)
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, remindersRecordSize)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	rows := utils.StampItems(utils.UnpackRemindersSyncup(body))
+	fails, conflicts, err := db.InsertItems(r.Context(), "yearly_reminders", rows, received, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "yearly_reminders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpYearly", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpYearly", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "reminders/yearly", rows[0].LastUpdated)
+	}
+
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, remindersRecordSize, conflicts, utils.PackRemindersSyncdown)
+		if err != nil {
+			return
+		}
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
 
 func upExtensions(w http.ResponseWriter, r *http.Request) {
-	const upExtensionsRecordSize uint32 = 84
-	body, err := readRequestSyncup(w, r, upExtensionsRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
 	if err != nil {
 		return
 	}
-
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
 		return
 	}
-
-	rows := utils.UnpackExtensions(body, upExtensionsRecordSize)
-	fails, err := db.InsertExtensions(rows)
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, extensionsRecordSize)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	rows := utils.StampExtensions(utils.UnpackExtensionsSyncup(body))
+	fails, conflicts, err := db.InsertExtensions(r.Context(), rows, received, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "extensions") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpExtensions", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpExtensions", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "extensions", rows[0].LastUpdated)
+	}
+
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, extensionsRecordSize, conflicts, utils.PackExtensionsSyncdown)
+		if err != nil {
+			return
+		}
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
 
 func upOverrides(w http.ResponseWriter, r *http.Request) {
-	const upOverridesRecordSize uint32 = 88
-	body, err := readRequestSyncup(w, r, upOverridesRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
 	if err != nil {
 		return
 	}
-
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
 		return
 	}
-
-	rows := utils.UnpackOverrides(body, upOverridesRecordSize)
-	fails, err := db.InsertOverrides(rows)
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, overridesRecordSize)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	rows := utils.StampOverrides(utils.UnpackOverridesSyncup(body))
+	fails, conflicts, err := db.InsertOverrides(r.Context(), rows, received, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "overrides") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpOverrides", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpOverrides", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "overrides", rows[0].LastUpdated)
+	}
+
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, overridesRecordSize, conflicts, utils.PackOverridesSyncdown)
+		if err != nil {
+			return
+		}
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
 
 func upFolders(w http.ResponseWriter, r *http.Request) {
-	const upFoldersRecordSize uint32 = 80
-	body, err := readRequestSyncup(w, r, upFoldersRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
 	if err != nil {
 		return
 	}
-
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
 		return
 	}
-
-	rows := utils.UnpackFolders(body, upFoldersRecordSize)
-	fails, err := db.InsertFolders(rows)
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, foldersRecordSize)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	rows := utils.StampFolders(utils.UnpackFoldersSyncup(body))
+	fails, conflicts, err := db.InsertFolders(r.Context(), rows, received, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "folders") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpFolders", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpFolders", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "folders", rows[0].LastUpdated)
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, foldersRecordSize, conflicts, utils.PackFoldersSyncdown)
+		if err != nil {
+			return
+		}
+	}
+
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
 
 func upDeleted(w http.ResponseWriter, r *http.Request) {
-	const upDeletedRecordSize uint32 = 18
-	body, err := readRequestSyncup(w, r, upDeletedRecordSize)
+	body := requestBody(r)
+	userAuth := requestAuth(r)
+	detailed, err := readConflictResponse(w, r)
+	if err != nil {
+		return
+	}
+	idempotencyKey, requestHash, replayed := replayIdempotent(w, r, userAuth.UserID, body)
+	if replayed {
+		return
+	}
+	defer releaseIdempotent(r, userAuth.UserID, idempotencyKey, requestHash)
+	hlc, received, err := receiveClocks(w, r, body, deletedRecordSize)
 	if err != nil {
 		return
 	}
 
-	userAuth, _ := utils.UnpackSyncupHeader(body)
-	if !db.CheckTokenAuth(userAuth) {
-		http.Error(w, "Invalid userID+token combination.", http.StatusUnauthorized)
+	folderPolicy := strings.ToUpper(r.Header.Get("Folder-Delete-Policy"))
+	if folderPolicy == "" {
+		folderPolicy = db.FolderPolicyKeep
+	}
+	if folderPolicy != db.FolderPolicyKeep && folderPolicy != db.FolderPolicyCascade {
+		writeError(w, r, models.ErrorInvalidFolderDeletePolicy, "Folder-Delete-Policy must be KEEP or CASCADE.")
 		return
 	}
 
-	rows := utils.UnpackDeleted(body, upDeletedRecordSize)
-	fails, err := db.InsertDeleted(rows)
-	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+	rows := utils.StampDeleted(utils.UnpackDeletedSyncup(body))
+	fails, conflicts, err := db.InsertDeleted(r.Context(), rows, received, folderPolicy, detailed)
+	if utils.LogError(r.Context(), err, "insert rows", "table", "deleted") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
 		return
 	}
 	if len(rows) > 0 {
-		db.UpdateLastup("LastUpDeleted", rows[0].UserID, rows[0].LastUpdated)
+		db.UpdateLastup(r.Context(), "LastUpDeleted", rows[0].UserID, rows[0].LastUpdated)
+		publishChange(r.Context(), rows[0].UserID, "deleted", rows[0].LastUpdated)
+	}
+
+	response := utils.PackFails(fails)
+	if detailed {
+		response, err = appendConflicts(w, r, response, hlc, deletedRecordSize, conflicts, func(conflicts models.SyncdownResponse[models.RowDeleted]) ([]byte, error) {
+			return utils.PackDeletedSyncdown(conflicts), nil
+		})
+		if err != nil {
+			return
+		}
 	}
 
-	fmt.Fprintf(w, "%s", utils.PackFails(fails))
+	storeIdempotent(r, userAuth.UserID, idempotencyKey, requestHash, response)
+	fmt.Fprintf(w, "%s", response)
 }
@@ -0,0 +1,71 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file defines the handlers for the liveness and readiness probes of an orchestrator.
+ * /healthz only shows that the process can answer, while /readyz checks everything a request depends on, and fails once the server begins shutting down.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"openorganizer/src/db"
+	"openorganizer/src/models"
+	"openorganizer/src/utils"
+)
+
+// max time for the database to answer a readiness check, kept below the timeouts of common probes
+const readyTimeout = 2 * time.Second
+
+// closed once the server begins shutting down, which also ends long polls and event streams so that they do not hold up the shutdown
+var shutdown = make(chan struct{})
+var shutdownOnce sync.Once
+
+// fails readiness from now on, so that traffic is routed elsewhere while the requests in flight finish
+func BeginShutdown() {
+	shutdownOnce.Do(func() {
+		close(shutdown)
+	})
+}
+
+func shuttingDown() bool {
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// the client is only told which check failed, and the error itself is logged
+func readyz(w http.ResponseWriter, r *http.Request) {
+	if shuttingDown() {
+		writeError(w, r, models.ErrorNotReady, "The server is shutting down.")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if utils.LogError(ctx, db.CheckReady(ctx), "check database") {
+		writeError(w, r, models.ErrorNotReady, "The database cannot be reached or is missing migrations.")
+		return
+	}
+	if utils.LogError(ctx, jobsReady(), "check periodic jobs") {
+		writeError(w, r, models.ErrorNotReady, "A periodic job has stopped or keeps failing.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
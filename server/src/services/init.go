@@ -1,9 +1,10 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-09-20
- * Updated: 2025-10-30
+ * Updated: 2026-10-19
  *
- * This file handles many of the initialization functions, such as pulling .env variables and assigning handlers for HTTP requests.
+ * This file handles many of the initialization functions, such as starting the HTTP servers.
+ * The servers shut down gracefully once the context given to Run is done, failing readiness for SHUTDOWN_DRAIN and then finishing the requests in flight.
  *
  * This file is a part of OpenOrganizer.
  * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
@@ -13,183 +14,20 @@
 package services
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
-	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
-	"github.com/joho/godotenv"
-
 	"openorganizer/src/models"
 )
 
-var maxRecordCount uint32
-
-// retrieves vital variables from local .env file
-func RetrieveENVVars() (env models.ENVVars, err error) {
-	if err := godotenv.Load(); err != nil {
-		fmt.Printf("error loading: %v\n", err)
-		return env, err
-	}
-
-	env.LOCAL_ONLY = false
-	var LOCAL_ONLY = strings.ToUpper(os.Getenv("LOCAL_ONLY"))
-	if LOCAL_ONLY == "TRUE" {
-		env.LOCAL_ONLY = true
-	}
-
-	var HTTPS = strings.ToUpper(os.Getenv("HTTPS"))
-	var SERVER_CRT = os.Getenv("SERVER_CRT")
-	var SERVER_KEY = os.Getenv("SERVER_KEY")
-	var SERVER_PORT_HTTPS = strings.ToUpper(os.Getenv("SERVER_PORT_HTTPS"))
-	if HTTPS == "TRUE" {
-		env.HTTPS = true
-		if SERVER_PORT_HTTPS == "" {
-			return env, errors.New("SERVER_PORT_HTTPS is null")
-		}
-		if SERVER_CRT == "" {
-			return env, errors.New("SERVER_CRT is null")
-		}
-		if SERVER_KEY == "" {
-			return env, errors.New("SERVER_KEY is null")
-		}
-		env.SERVER_PORT_HTTPS = SERVER_PORT_HTTPS
-	} else if HTTPS == "FALSE" {
-		env.HTTPS = false
-	} else {
-		return env, errors.New("HTTPS is invalid, use TRUE or FALSE")
-	}
-
-	var SERVER_PORT_HTTP = os.Getenv("SERVER_PORT_HTTP")
-	if SERVER_PORT_HTTP == "" {
-		return env, errors.New("SERVER_PORT_HTTP is null")
-	}
-
-	var DB_HOST = os.Getenv("DB_HOST")
-	if DB_HOST == "" {
-		return env, errors.New("DB_HOST is null")
-	}
-	var DB_PORT = os.Getenv("DB_PORT")
-	if DB_PORT == "" {
-		return env, errors.New("DB_HOST is null")
-	}
-	var DB_USER = os.Getenv("DB_USER")
-	if DB_USER == "" {
-		return env, errors.New("DB_USER is null")
-	}
-	var DB_PWD = os.Getenv("DB_PWD")
-	if DB_PWD == "" {
-		return env, errors.New("DB_PWD is null")
-	}
-
-	env.SERVER_PORT_HTTP = SERVER_PORT_HTTP
-	env.SERVER_CRT = SERVER_CRT
-	env.SERVER_KEY = SERVER_KEY
-	env.DB_HOST = DB_HOST
-	env.DB_PORT = DB_PORT
-	env.DB_USER = DB_USER
-	env.DB_PWD = DB_PWD
-
-	env.TOKEN_EXPIRE_REFRESH = false
-	var TOKEN_EXPIRE_REFRESH = os.Getenv("TOKEN_EXPIRE_REFRESH")
-	if TOKEN_EXPIRE_REFRESH == "TRUE" {
-		env.TOKEN_EXPIRE_REFRESH = true
-	}
-	var TOKEN_EXPIRE_TIME = os.Getenv("TOKEN_EXPIRE_TIME")
-	if TOKEN_EXPIRE_TIME == "" {
-		TOKEN_EXPIRE_TIME = "3600"
-	}
-	var TOKEN_PURGE_INTERVAL = os.Getenv("TOKEN_PURGE_INTERVAL")
-	if TOKEN_PURGE_INTERVAL == "" {
-		TOKEN_PURGE_INTERVAL = "3600"
-	}
-	var MAX_RECORD_COUNT = os.Getenv("MAX_RECORD_COUNT")
-	if MAX_RECORD_COUNT == "" {
-		MAX_RECORD_COUNT = "1000"
-	}
-
-	tokenExpireTime, err := strconv.Atoi(TOKEN_EXPIRE_TIME)
-	if err != nil {
-		return env, errors.New("invalid value in TOKEN_EXPIRE_TIME, must be convertible to int32")
-	}
-	tokenPurgeInterval, err := strconv.Atoi(TOKEN_PURGE_INTERVAL)
-	if err != nil {
-		return env, errors.New("invalid value in TOKEN_PURGE_INTERVAL, must be convertible to int32")
-	}
-	recordCount, err := strconv.Atoi(MAX_RECORD_COUNT)
-	if err != nil {
-		return env, errors.New("invalid value in MAX_RECORD_COUNT, must be convertible to int32")
-	}
-	env.TOKEN_EXPIRE_TIME = uint32(tokenExpireTime)
-	env.TOKEN_PURGE_INTERVAL = uint32(tokenPurgeInterval)
-	env.MAX_RECORD_COUNT = uint32(recordCount)
-	maxRecordCount = uint32(recordCount)
-
-	env.CLEAR_DB_AUTH = false
-	var CLEAR_DB_AUTH = os.Getenv("CLEAR_DB_AUTH")
-	if CLEAR_DB_AUTH == "TRUE" {
-		env.CLEAR_DB_AUTH = true
-	}
-	env.CLEAR_DB_DATA = false
-	var CLEAR_DB_DATA = os.Getenv("CLEAR_DB_DATA")
-	if CLEAR_DB_DATA == "TRUE" {
-		env.CLEAR_DB_DATA = true
-	}
-	env.TEST_SUITE = false
-	var TEST_SUITE = os.Getenv("TEST_SUITE")
-	if TEST_SUITE == "TRUE" {
-		env.TEST_SUITE = true
-	}
-	var TEST_SUITE_DELAY = os.Getenv("TEST_SUITE_DELAY")
-	if TEST_SUITE_DELAY == "" {
-		TEST_SUITE_DELAY = "20"
-	}
-	testSuiteDelay, err := strconv.Atoi(TEST_SUITE_DELAY)
-	if err != nil {
-		return env, errors.New("invalid value in TOKEN_EXPIRE_TIME, must be convertible to int32")
-	}
-	env.TEST_SUITE_DELAY = uint16(testSuiteDelay)
-
-	return env, err
-}
-
-// assigns HTTP routes to their respective handling functions
-func AssignHandlers() {
-	http.HandleFunc("/", root)
-	http.HandleFunc("/register", register)
-	http.HandleFunc("/login", login)
-	http.HandleFunc("/changelogin", changeLogin)
-	http.HandleFunc("/lastupdated", lastUpdated)
-
-	http.HandleFunc("/syncup/notes", upNotes)
-	http.HandleFunc("/syncup/reminders", upReminders)
-	http.HandleFunc("/syncup/reminders/daily", upRemindersDaily)
-	http.HandleFunc("/syncup/reminders/weekly", upRemindersWeekly)
-	http.HandleFunc("/syncup/reminders/monthly", upRemindersMonthly)
-	http.HandleFunc("/syncup/reminders/yearly", upRemindersYearly)
-	http.HandleFunc("/syncup/extensions", upExtensions)
-	http.HandleFunc("/syncup/overrides", upOverrides)
-	http.HandleFunc("/syncup/folders", upFolders)
-	http.HandleFunc("/syncup/deleted", upDeleted)
-
-	http.HandleFunc("/syncdown/notes", downNotes)
-	http.HandleFunc("/syncdown/reminders", downReminders)
-	http.HandleFunc("/syncdown/reminders/daily", downRemindersDaily)
-	http.HandleFunc("/syncdown/reminders/weekly", downRemindersWeekly)
-	http.HandleFunc("/syncdown/reminders/monthly", downRemindersMonthly)
-	http.HandleFunc("/syncdown/reminders/yearly", downRemindersYearly)
-	http.HandleFunc("/syncdown/extensions", downExtensions)
-	http.HandleFunc("/syncdown/overrides", downOverrides)
-	http.HandleFunc("/syncdown/folders", downFolders)
-	http.HandleFunc("/syncdown/deleted", downDeleted)
-}
-
-// initialize HTTP (and HTTPS) servers
-func Run(env models.ENVVars) chan error {
+// initialize HTTP (and HTTPS) servers, serving the handler from NewRouter, and the metrics server if it has a port
+// blocks until one of the servers fails, or until ctx is done and the servers have shut down
+func Run(ctx context.Context, env models.ENVVars, handler http.Handler) error {
 	var localOnly string = ""
 	if env.LOCAL_ONLY {
 		localOnly = "localhost"
@@ -198,41 +36,121 @@ func Run(env models.ENVVars) chan error {
 	serverHTTP := http.Server{
 		Addr: localOnly + ":" + env.SERVER_PORT_HTTP,
 		// write must stay longer than read to have responses
-		ReadTimeout:  2 * time.Second,
-		WriteTimeout: 3 * time.Second,
+		ReadTimeout:  time.Duration(env.READ_TIMEOUT) * time.Second,
+		WriteTimeout: time.Duration(env.WRITE_TIMEOUT) * time.Second,
+		Handler:      handler,
 	}
 	serverHTTPS := http.Server{
 		Addr: localOnly + ":" + env.SERVER_PORT_HTTPS,
 		// write must stay longer than read to have responses
-		ReadTimeout:  2 * time.Second,
-		WriteTimeout: 3 * time.Second,
+		ReadTimeout:  time.Duration(env.READ_TIMEOUT) * time.Second,
+		WriteTimeout: time.Duration(env.WRITE_TIMEOUT) * time.Second,
+		Handler:      handler,
 		TLSConfig: &tls.Config{
 			MinVersion: tls.VersionTLS12,
 			MaxVersion: tls.VersionTLS13,
 		},
 	}
+	serverMetrics := http.Server{
+		Addr:         localOnly + ":" + env.METRICS_PORT,
+		ReadTimeout:  time.Duration(env.READ_TIMEOUT) * time.Second,
+		WriteTimeout: time.Duration(env.WRITE_TIMEOUT) * time.Second,
+		Handler:      newMetricsRouter(),
+	}
 	if env.HTTPS {
 		serverHTTP.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			redirectHTTPS(w, r, env)
+			redirectHTTPS(w, r, env, handler)
 		})
 	}
-	fmt.Printf("Max record count per transmission: %v\n", maxRecordCount)
+	// the socket is for a proxy on the same machine, so it is served like the HTTP port
+	serverSocket := http.Server{
+		ReadTimeout:  time.Duration(env.READ_TIMEOUT) * time.Second,
+		WriteTimeout: time.Duration(env.WRITE_TIMEOUT) * time.Second,
+		Handler:      serverHTTP.Handler,
+		ConnContext:  socketConnContext,
+	}
+	slog.Info("max record count per transmission", "maxRecordCount", maxRecordCount)
 
-	var errs = make(chan error)
-	if env.HTTPS {
+	var servers []*http.Server
+	// buffered so that a server failing during shutdown does not block
+	var errs = make(chan error, 4)
+	serve := func(name string, server *http.Server, listen func() error) {
+		servers = append(servers, server)
 		go func() {
-			fmt.Printf("Initializing HTTPS server at %s:%s\n", localOnly, env.SERVER_PORT_HTTPS)
-			if err := serverHTTPS.ListenAndServeTLS(env.SERVER_CRT, env.SERVER_KEY); err != nil {
+			slog.Info("initializing "+name+" server", "address", server.Addr)
+			if err := listen(); !errors.Is(err, http.ErrServerClosed) {
 				errs <- err
 			}
 		}()
 	}
-	go func() {
-		fmt.Printf("Initializing HTTP server at %s:%s\n", localOnly, env.SERVER_PORT_HTTP)
-		if err := serverHTTP.ListenAndServe(); err != nil {
-			errs <- err
+	if env.HTTPS {
+		certificate, err := loadCertificate(ctx, env)
+		if err != nil {
+			return err
 		}
-	}()
+		serverHTTPS.TLSConfig.GetCertificate = certificate.getCertificate
+		if err := configureClientAuth(serverHTTPS.TLSConfig, env); err != nil {
+			return err
+		}
+		// the certificate comes from GetCertificate, so that it can be reloaded
+		serve("HTTPS", &serverHTTPS, func() error {
+			return serverHTTPS.ListenAndServeTLS("", "")
+		})
+	}
+	if env.SERVER_PORT_HTTP != "" {
+		serve("HTTP", &serverHTTP, serverHTTP.ListenAndServe)
+	}
+	if env.SERVER_SOCKET != "" {
+		serverSocket.Addr = env.SERVER_SOCKET
+		// the socket file is removed once Serve closes the listener
+		serve("socket", &serverSocket, func() error {
+			listener, err := listenSocket(env.SERVER_SOCKET, env.SERVER_SOCKET_MODE)
+			if err != nil {
+				return err
+			}
+			return serverSocket.Serve(listener)
+		})
+	}
+	if env.METRICS_PORT != "" {
+		serve("metrics", &serverMetrics, serverMetrics.ListenAndServe)
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	// readiness fails while the servers still accept connections, so that probes see it before they close
+	drain := time.Duration(env.SHUTDOWN_DRAIN) * time.Second
+	slog.Info("draining before shutting down", "drain", drain)
+	BeginShutdown()
+	drainTimer := time.NewTimer(drain)
+	defer drainTimer.Stop()
+	select {
+	case err := <-errs:
+		slog.Error("server failed while draining", "error", err)
+	case <-drainTimer.C:
+	}
+	timeout := time.Duration(env.SHUTDOWN_TIMEOUT) * time.Second
+	slog.Info("shutting down", "timeout", timeout)
+	return shutdownServers(servers, timeout)
+}
 
-	return errs
+// stops accepting connections and waits for the requests in flight, closing the connections left after the timeout
+func shutdownServers(servers []*http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, len(servers))
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				errs[i] = errors.Join(err, server.Close())
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
@@ -0,0 +1,42 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file declares the metrics of requests and periodic jobs, and serves every metric of the server at /metrics in the Prometheus text format.
+ * The metrics are served on their own port so that they can be scraped without being exposed alongside the API.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"net/http"
+
+	"openorganizer/src/utils"
+)
+
+// routes are labeled by their pattern rather than their path, so that unknown paths share the fallback route's series
+var requestsTotal = utils.NewCounter("openorganizer_http_requests_total",
+	"Requests answered, by route and status.", "route", "status")
+var requestDuration = utils.NewHistogram("openorganizer_http_request_duration_seconds",
+	"Time taken to answer requests, by route and status.", utils.LatencyBuckets, "route", "status")
+var jobDuration = utils.NewHistogram("openorganizer_job_duration_seconds",
+	"Time taken by each run of a periodic job, by job.", utils.LatencyBuckets, "job")
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+func metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	utils.LogError(r.Context(), utils.WriteMetrics(r.Context(), w), "write metrics")
+}
+
+// the metrics server only has the one route, and the mux answers anything else in plain text
+func newMetricsRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", metrics)
+	return mux
+}
@@ -0,0 +1,340 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file defines the middleware every route is built from, so that handlers only contain the logic of their endpoint.
+ * Middleware runs in the order it is given to chain, and the body and authentication of a request are passed to the handler in its context.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"openorganizer/src/db"
+	"openorganizer/src/models"
+	"openorganizer/src/utils"
+)
+
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// wraps the handler so that the first middleware runs first
+func chain(handler http.HandlerFunc, middlewares ...middleware) http.HandlerFunc {
+	for _, m := range slices.Backward(middlewares) {
+		handler = m(handler)
+	}
+	return handler
+}
+
+type requestIDKey struct{}
+type requestBodyKey struct{}
+type requestAuthKey struct{}
+
+// the body read by withBody or withSyncupBody
+func requestBody(r *http.Request) []byte {
+	body, _ := r.Context().Value(requestBodyKey{}).([]byte)
+	return body
+}
+
+// the user checked by withAuth
+func requestAuth(r *http.Request) models.UserAuth {
+	userAuth, _ := r.Context().Value(requestAuthKey{}).(models.UserAuth)
+	return userAuth
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+func withValue(r *http.Request, key any, value any) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), key, value))
+}
+
+// remembers the status of a response for the middleware outside the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.written {
+		sr.status, sr.written = status, true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(data []byte) (int, error) {
+	sr.written = true
+	return sr.ResponseWriter.Write(data)
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// reuses the recorder of an outer middleware if there is one
+func recordStatus(w http.ResponseWriter) *statusRecorder {
+	if sr, ok := w.(*statusRecorder); ok {
+		return sr
+	}
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// request IDs
+
+const requestIDHeader = "X-Request-ID"
+const requestIDMaxLength = 64
+
+// a request ID from the client is kept so that it can follow the request through a proxy, as long as it is short and printable
+func validRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMaxLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// gives every request an ID, sent back in the X-Request-ID header and in error responses
+func withRequestID(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = withValue(r, requestIDKey{}, id)
+		handler(w, r.WithContext(utils.WithLogger(r.Context(), slog.Default().With("requestID", id))))
+	}
+}
+
+// logging, recovery, and metrics
+
+// every request is logged at debug level and server errors at error level, since the test suite alone sends thousands of requests
+func withLogging(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := recordStatus(w)
+		handler(sr, r)
+		level := slog.LevelDebug
+		// a request cancelled by its client fails with an internal error that nobody receives
+		if sr.status >= http.StatusInternalServerError && !errors.Is(r.Context().Err(), context.Canceled) {
+			level = slog.LevelError
+		}
+		utils.Logger(r.Context()).Log(r.Context(), level, "request", "method", r.Method, "path", r.URL.Path, "status", sr.status, "duration", time.Since(start), "client", r.RemoteAddr)
+	}
+}
+
+// a panicking handler is answered with an internal error instead of dropping the connection
+func withRecovery(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sr := recordStatus(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// the server aborts the response itself for this one
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			utils.Logger(r.Context()).Error("panic", "method", r.Method, "path", r.URL.Path, "panic", recovered, "stack", string(debug.Stack()))
+			if !sr.written {
+				writeError(sr, r, models.ErrorInternal, "The server failed to handle the request.")
+			}
+		}()
+		handler(sr, r)
+	}
+}
+
+func withMetrics(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := recordStatus(w)
+		handler(sr, r)
+		status := strconv.Itoa(sr.status)
+		requestsTotal.Inc(r.Pattern, status)
+		requestDuration.Observe(time.Since(start).Seconds(), r.Pattern, status)
+	}
+}
+
+// headers
+
+func withProtocolVersion(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := readProtocolVersion(w, r); err != nil {
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// read and write deadlines for a single route, overriding the server-wide timeouts once the handler is reached
+// the context of the request ends at the write deadline too, since no response can be sent after it, which cancels its database calls
+func withTimeouts(readTimeout time.Duration, writeTimeout time.Duration) middleware {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			controller := http.NewResponseController(w)
+			writeDeadline := time.Now().Add(writeTimeout)
+			_ = controller.SetWriteDeadline(writeDeadline)
+			// after the body, the connection is only read to notice the client leaving, which cancels the request if it times out
+			if r.Body == nil || r.Body == http.NoBody {
+				_ = controller.SetReadDeadline(writeDeadline)
+			} else {
+				_ = controller.SetReadDeadline(time.Now().Add(readTimeout))
+				r.Body = &deadlineBody{ReadCloser: r.Body, controller: controller, deadline: writeDeadline}
+			}
+			ctx, cancel := context.WithDeadline(r.Context(), writeDeadline)
+			defer cancel()
+			handler(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// moves the read deadline to the given deadline once the body has been read to the end
+type deadlineBody struct {
+	io.ReadCloser
+	controller *http.ResponseController
+	deadline   time.Time
+}
+
+func (body *deadlineBody) Read(data []byte) (int, error) {
+	n, err := body.ReadCloser.Read(data)
+	if err == io.EOF {
+		_ = body.controller.SetReadDeadline(body.deadline)
+	}
+	return n, err
+}
+
+// bodies
+
+const timeoutMessage = "Content-Length is too high, body is too large, or other read timeout"
+
+// reads the whole body, limited to limit bytes before and after decompression
+// errors are already written, so the caller only needs to return
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	body, err := readRequestBody(w, r, limit)
+	if errors.Is(err, errUnsupportedEncoding) {
+		writeError(w, r, models.ErrorUnsupportedEncoding, "Content-Encoding must be gzip or zstd.")
+		return nil, err
+	}
+	if err != nil {
+		writeError(w, r, models.ErrorMalformedBody, timeoutMessage)
+		return nil, err
+	}
+	return body, nil
+}
+
+func verifyRequestSize(w http.ResponseWriter, r *http.Request, headerSize uint32, recordSize uint32, recordCount uint32) bool {
+	if recordCount > maxRecordCount {
+		writeError(w, r, models.ErrorTooManyRecords, "recordCount higher than server limit of "+strconv.Itoa(int(maxRecordCount)))
+		return false
+	}
+	expectedSize := headerSize + (recordSize * recordCount)
+	if r.ContentLength == int64(expectedSize) {
+		return true
+	}
+	writeError(w, r, models.ErrorMalformedBody, "Content-Length does not match the expected body size.")
+	return false
+}
+
+// reads a body that must be exactly one of the given sizes, which are too small to be sent compressed
+func withBody(sizes ...uint32) middleware {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, int64(slices.Max(sizes)))
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, r, models.ErrorMalformedBody, timeoutMessage)
+				return
+			}
+			if !slices.Contains(sizes, uint32(r.ContentLength)) {
+				writeError(w, r, models.ErrorMalformedBody, "Content-Length does not match the expected body size.")
+				return
+			}
+			handler(w, withValue(r, requestBodyKey{}, body))
+		}
+	}
+}
+
+// reads a syncup body and validates that the header + records is the correct size
+func withSyncupBody(recordSize uint32) middleware {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, err := readBody(w, r, int64(utils.SyncupHeaderSize+(maxRecordCount*recordSize)))
+			if err != nil {
+				return
+			}
+			if r.ContentLength < utils.SyncupHeaderSize {
+				writeError(w, r, models.ErrorMalformedBody, "Content-Length does not match the expected body size.")
+				return
+			}
+			recordCount := utils.UnpackSyncupHeader(body).RecordCount
+			if !verifyRequestSize(w, r, utils.SyncupHeaderSize, recordSize, recordCount) {
+				return
+			}
+			handler(w, withValue(r, requestBodyKey{}, body))
+		}
+	}
+}
+
+// checks the user and token every authenticated body starts with, so must come after the body is read
+// reads the credentials of a GET request from its Authorization header in place of a body, for clients that cannot send one, such as Server-Sent Events libraries
+// the header is Bearer followed by the UserAuth layout in base64
+func withAuthHeader(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoded, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		body, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if !found || err != nil || len(body) != utils.UserAuthSize {
+			writeError(w, r, models.ErrorInvalidToken, "Authorization must be Bearer followed by the userID and token in base64.")
+			return
+		}
+		handler(w, withValue(r, requestBodyKey{}, body))
+	}
+}
+
+func withAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userAuth := utils.UnpackUserAuth(requestBody(r))
+		valid, err := db.CheckTokenAuth(r.Context(), userAuth, clientFingerprint(r))
+		if utils.LogError(r.Context(), err, "check token", "userID", userAuth.UserID) {
+			writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
+			return
+		}
+		if !valid {
+			writeError(w, r, models.ErrorInvalidToken, "Invalid userID+token combination.")
+			return
+		}
+		r = withValue(r, requestAuthKey{}, userAuth)
+		handler(w, r.WithContext(utils.WithLogger(r.Context(), utils.Logger(r.Context()).With("userID", userAuth.UserID))))
+	}
+}
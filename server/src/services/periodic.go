@@ -1,10 +1,11 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-10-30
- * Updated: 2025-10-30
+ * Updated: 2026-10-19
  *
  * This file declares the function for periodic actions the server does.
- * For example, it currently purges expired authTokens from the database.
+ * For example, it currently purges expired authTokens and idempotency keys from the database.
+ * Each job is tracked while it runs, so that the server is not ready if one of them stops or keeps failing.
  *
  * This file is a part of OpenOrganizer.
  * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
@@ -14,22 +15,103 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	"openorganizer/src/db"
 	"openorganizer/src/models"
+	"openorganizer/src/utils"
 )
 
-func LaunchPeriodics(env models.ENVVars) {
-	go func() {
-		purgeExpiredTokens(env)
-	}()
+// launches every job, and returns a function that stops them and waits for a run in progress to finish
+func LaunchPeriodics(env models.ENVVars) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var running sync.WaitGroup
+	launchPeriodic(ctx, &running, "purgeExpiredTokens", time.Duration(env.TOKEN_PURGE_INTERVAL)*time.Second, db.ClearExpiredTokens)
+	launchPeriodic(ctx, &running, "purgeExpiredIdempotencyKeys", time.Duration(env.IDEMPOTENCY_WINDOW)*time.Second, db.ClearExpiredIdempotencyKeys)
+	return func() {
+		cancel()
+		running.Wait()
+	}
+}
+
+// a job is stale once it has not succeeded for this many of its intervals, which allows one failed run
+const jobStaleIntervals = 2
+
+type jobStatus struct {
+	running  bool
+	interval time.Duration
+	// the last successful run, or the launch before the first one
+	lastSuccess time.Time
+}
+
+// the launched jobs and whether each is still running and succeeding, for readiness
+var jobsLock sync.Mutex
+var jobs = map[string]*jobStatus{}
+
+func setJobRunning(job string, interval time.Duration, running bool) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	if running {
+		jobs[job] = &jobStatus{running: true, interval: interval, lastSuccess: time.Now()}
+	} else if status, found := jobs[job]; found {
+		status.running = false
+	}
 }
 
-func purgeExpiredTokens(env models.ENVVars) {
-	var sleepTime time.Duration = time.Duration(env.TOKEN_PURGE_INTERVAL)
-	for {
-		time.Sleep(sleepTime * time.Second)
-		db.ClearExpiredTokens()
+func setJobSucceeded(job string) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	if status, found := jobs[job]; found {
+		status.lastSuccess = time.Now()
+	}
+}
+
+// fails if the jobs were never launched, one of them has stopped, or one has not succeeded for too long
+func jobsReady() error {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	if len(jobs) == 0 {
+		return errors.New("periodic jobs have not been launched")
+	}
+	for job, status := range jobs {
+		if !status.running {
+			return errors.New("periodic job " + job + " has stopped")
+		}
+		if since := time.Since(status.lastSuccess); since > jobStaleIntervals*status.interval {
+			return fmt.Errorf("periodic job %s has not succeeded for %v", job, since.Round(time.Second))
+		}
 	}
+	return nil
+}
+
+// runs the job after every interval in its own goroutine until ctx is done, timing each run
+// errors from the job are logged with its name
+func launchPeriodic(ctx context.Context, running *sync.WaitGroup, job string, interval time.Duration, run func(ctx context.Context) error) {
+	setJobRunning(job, interval, true)
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		defer setJobRunning(job, interval, false)
+		ctx := utils.WithLogger(ctx, slog.Default().With("job", job))
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			start := time.Now()
+			err := run(ctx)
+			jobDuration.Observe(time.Since(start).Seconds(), job)
+			if !utils.LogError(ctx, err, job) {
+				setJobSucceeded(job)
+			}
+		}
+	}()
 }
@@ -0,0 +1,103 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file declares the protocol versions, record sizes, and optional features the server supports.
+ * It also defines the handler clients use to negotiate them before syncing.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"openorganizer/src/models"
+	"openorganizer/src/utils"
+)
+
+// requests without a Protocol-Version header are treated as version 1
+const protocolVersionMin uint16 = 1
+const protocolVersionMax uint16 = 1
+
+// record sizes in bytes for each table, shared between syncup and syncdown and generated from schema/protocol.json
+
+const notesRecordSize uint32 = utils.NoteSize
+const remindersRecordSize uint32 = utils.ReminderSize
+const extensionsRecordSize uint32 = utils.ExtensionSize
+const overridesRecordSize uint32 = utils.OverrideSize
+const foldersRecordSize uint32 = utils.FolderSize
+const deletedRecordSize uint32 = utils.DeletedSize
+
+var tableLayouts = []models.TableLayout{
+	{Name: "notes", RecordSize: notesRecordSize},
+	{Name: "reminders", RecordSize: remindersRecordSize},
+	{Name: "reminders/daily", RecordSize: remindersRecordSize},
+	{Name: "reminders/weekly", RecordSize: remindersRecordSize},
+	{Name: "reminders/monthly", RecordSize: remindersRecordSize},
+	{Name: "reminders/yearly", RecordSize: remindersRecordSize},
+	{Name: "extensions", RecordSize: extensionsRecordSize},
+	{Name: "overrides", RecordSize: overridesRecordSize},
+	{Name: "folders", RecordSize: foldersRecordSize},
+	{Name: "deleted", RecordSize: deletedRecordSize},
+}
+
+// optional request headers and endpoints the server supports
+var features = []string{
+	"FOLDER_DELETE_POLICY",
+	"CONFLICT_RESPONSE",
+	"HLC",
+	"IDEMPOTENCY_KEY",
+	"EVENTS",
+	"LONG_POLL",
+	"COMPRESSION",
+	"CODECS",
+	"ERROR_CODES",
+}
+
+var clockMaxDrift uint32
+var idempotencyWindow uint32
+
+// checks the protocol version the request is formatted in and echoes it back, failing if the server does not support it
+// every supported version is handled the same, so handlers do not need the version until a later one changes a layout
+func readProtocolVersion(w http.ResponseWriter, r *http.Request) error {
+	header := r.Header.Get("Protocol-Version")
+	version := protocolVersionMin
+	if header != "" {
+		parsed, err := strconv.ParseUint(header, 10, 16)
+		if err != nil || uint16(parsed) < protocolVersionMin || uint16(parsed) > protocolVersionMax {
+			writeError(w, r, models.ErrorInvalidProtocolVersion, fmt.Sprintf("Protocol-Version must be between %v and %v.", protocolVersionMin, protocolVersionMax))
+			return errors.New("")
+		}
+		version = uint16(parsed)
+	}
+	w.Header().Set("Protocol-Version", strconv.Itoa(int(version)))
+	return nil
+}
+
+// bound HTTP handlers
+
+func capabilities(w http.ResponseWriter, r *http.Request) {
+	response, err := utils.PackCapabilities(models.Capabilities{
+		ProtocolVersionMin: protocolVersionMin,
+		ProtocolVersionMax: protocolVersionMax,
+		MaxRecordCount:     maxRecordCount,
+		ClockMaxDrift:      clockMaxDrift,
+		IdempotencyWindow:  idempotencyWindow,
+		Tables:             tableLayouts,
+		Features:           features,
+	})
+	if utils.LogError(r.Context(), err, "pack capabilities") {
+		writeError(w, r, models.ErrorInternal, "The server failed to handle the request.")
+		return
+	}
+
+	fmt.Fprintf(w, "%s", response)
+}
@@ -0,0 +1,161 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file serves the server on a Unix socket, and finds the real client address and scheme of requests passed on by reverse proxies.
+ * X-Forwarded-For and X-Forwarded-Proto are only trusted from the proxies in TRUSTED_PROXIES, since any other client could set them to anything.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// the entry of TRUSTED_PROXIES that trusts every connection to SERVER_SOCKET
+const trustedSocket = "unix"
+
+// set from TRUSTED_PROXIES
+var trustedProxies []netip.Prefix
+var trustSocket bool
+
+type socketConnKey struct{}
+
+// parses TRUSTED_PROXIES, where single addresses are trusted as prefixes of their full length
+func parseTrustedProxies(entries []string) (prefixes []netip.Prefix, socket bool, err error) {
+	for _, entry := range entries {
+		if entry == trustedSocket {
+			socket = true
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, false, errors.New(strconv.Quote(entry) + " is not an address, a CIDR range, or " + trustedSocket)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, socket, nil
+}
+
+func trustedAddress(address string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil {
+		return false
+	}
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// the address and scheme of the client, which come from the forwarded headers if the request was passed on by a trusted proxy
+// the addresses of X-Forwarded-For are read from the right, since each proxy appends the one it received from, so the client is the first that is not trusted
+func forwarded(r *http.Request) (address string, https bool, proxied bool) {
+	https = r.TLS != nil
+	fromSocket, _ := r.Context().Value(socketConnKey{}).(bool)
+	if fromSocket {
+		address = trustedSocket
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		address = host
+	} else {
+		address = r.RemoteAddr
+	}
+	if !(fromSocket && trustSocket) && !trustedAddress(address) {
+		return address, https, false
+	}
+
+	hops := headerList(r, "X-Forwarded-For")
+	client := -1
+	for i := len(hops) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(hops[i]); err != nil {
+			break
+		}
+		address = hops[i]
+		client = i
+		if !trustedAddress(hops[i]) {
+			break
+		}
+	}
+	// each proxy appends to both headers, so the scheme the client connected with is as far from the right as its address
+	// the entries before it may be sent by the client, so without a matching entry the proxy nearest to the server is used
+	protos := headerList(r, "X-Forwarded-Proto")
+	proto := ""
+	if i := len(protos) - (len(hops) - client); client >= 0 && i >= 0 && i < len(protos) {
+		proto = protos[i]
+	} else if len(protos) > 0 {
+		proto = protos[len(protos)-1]
+	}
+	switch strings.ToLower(proto) {
+	case "https":
+		https = true
+	case "http":
+		https = false
+	}
+	return address, https, true
+}
+
+// the comma separated entries of every instance of a header, in order
+func headerList(r *http.Request, name string) (entries []string) {
+	for _, header := range r.Header.Values(name) {
+		for _, entry := range strings.Split(header, ",") {
+			entries = append(entries, strings.TrimSpace(entry))
+		}
+	}
+	return entries
+}
+
+// replaces the address of a proxy with that of its client, so that logging sees the real client
+func withForwarded(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr, _, _ = forwarded(r)
+		handler(w, r)
+	}
+}
+
+// marks the connections of the socket server, whose remote address is empty
+func socketConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, socketConnKey{}, true)
+}
+
+// listens on a Unix socket at path with the permissions of mode, replacing a socket left behind by a server that did not shut down cleanly
+func listenSocket(path string, mode string) (net.Listener, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, errors.New(path + " already exists and is not a socket")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+		return nil, errors.Join(err, listener.Close())
+	}
+	return listener, nil
+}
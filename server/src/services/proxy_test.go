@@ -0,0 +1,106 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file tests which client address and scheme are taken from X-Forwarded-For and X-Forwarded-Proto, depending on TRUSTED_PROXIES.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwarded(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+		// the peer the request arrived from, or empty for SERVER_SOCKET
+		remoteAddr string
+		tls        bool
+		// X-Forwarded-For headers, each of which may list several hops
+		forwardedFor []string
+		proto        string
+		address      string
+		https        bool
+		proxied      bool
+	}{
+		{name: "no proxies", remoteAddr: "203.0.113.7:5000", address: "203.0.113.7"},
+		{name: "direct https", remoteAddr: "203.0.113.7:5000", tls: true, address: "203.0.113.7", https: true},
+		{name: "untrusted peer with spoofed headers", trusted: []string{"10.0.0.1"}, remoteAddr: "203.0.113.7:5000", forwardedFor: []string{"198.51.100.1"}, proto: "https", address: "203.0.113.7"},
+		{name: "untrusted peer cannot downgrade https", trusted: []string{"10.0.0.1"}, remoteAddr: "203.0.113.7:5000", tls: true, proto: "http", address: "203.0.113.7", https: true},
+		{name: "trusted proxy", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"203.0.113.7"}, proto: "https", address: "203.0.113.7", https: true, proxied: true},
+		{name: "trusted proxy without headers", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:5000", address: "10.0.0.1", proxied: true},
+		{name: "trusted proxy over http", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:5000", tls: true, forwardedFor: []string{"203.0.113.7"}, proto: "http", address: "203.0.113.7", proxied: true},
+		{name: "chain of trusted proxies", trusted: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"203.0.113.7, 10.0.0.3, 10.0.0.2"}, proto: "https, http, http", address: "203.0.113.7", https: true, proxied: true},
+		{name: "spoofed leading proto", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"203.0.113.7"}, proto: "https, http", address: "203.0.113.7", proxied: true},
+		{name: "spoofed proto and hop before the client", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"198.51.100.1, 203.0.113.7"}, proto: "https, http", address: "203.0.113.7", proxied: true},
+		{name: "spoofed proto without forwarded for", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:5000", proto: "https, http", address: "10.0.0.1", proxied: true},
+		{name: "proto of the client in a chain", trusted: []string{"10.0.0.1", "10.0.0.2"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"}, proto: "http, https, http", address: "203.0.113.7", https: true, proxied: true},
+		{name: "one proto for a chain", trusted: []string{"10.0.0.1", "10.0.0.2"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"203.0.113.7", "10.0.0.2"}, proto: "https", address: "203.0.113.7", https: true, proxied: true},
+		{name: "chain over several headers", trusted: []string{"10.0.0.1", "10.0.0.2"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"203.0.113.7", "10.0.0.2"}, address: "203.0.113.7", proxied: true},
+		{name: "chain with spoofed hops before the client", trusted: []string{"10.0.0.1", "10.0.0.2"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"198.51.100.1, 10.0.0.2, 203.0.113.7, 10.0.0.2"}, address: "203.0.113.7", proxied: true},
+		{name: "chain with an untrusted proxy", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"203.0.113.7, 198.51.100.1"}, address: "198.51.100.1", proxied: true},
+		{name: "invalid hop stops the chain", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:5000", forwardedFor: []string{"203.0.113.7, unknown"}, address: "10.0.0.1", proxied: true},
+		{name: "cidr match", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"203.0.113.7, 10.200.0.1"}, proto: "https", address: "203.0.113.7", https: true, proxied: true},
+		{name: "cidr miss", trusted: []string{"10.0.0.0/24"}, remoteAddr: "10.0.1.1:5000", forwardedFor: []string{"203.0.113.7"}, proto: "https", address: "10.0.1.1"},
+		{name: "ipv6 cidr match", trusted: []string{"fd00::/8"}, remoteAddr: "[fd00::1]:5000", forwardedFor: []string{"2001:db8::7"}, address: "2001:db8::7", proxied: true},
+		{name: "ipv4 mapped peer", trusted: []string{"10.0.0.0/8"}, remoteAddr: "[::ffff:10.0.0.1]:5000", forwardedFor: []string{"203.0.113.7"}, address: "203.0.113.7", proxied: true},
+		{name: "trusted socket", trusted: []string{"unix"}, forwardedFor: []string{"203.0.113.7"}, proto: "https", address: "203.0.113.7", https: true, proxied: true},
+		{name: "untrusted socket", trusted: []string{"10.0.0.1"}, forwardedFor: []string{"203.0.113.7"}, proto: "https", address: "unix"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var err error
+			trustedProxies, trustSocket, err = parseTrustedProxies(test.trusted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				trustedProxies, trustSocket = nil, false
+			})
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if test.remoteAddr == "" {
+				r.RemoteAddr = ""
+				r = r.WithContext(context.WithValue(r.Context(), socketConnKey{}, true))
+			} else {
+				r.RemoteAddr = test.remoteAddr
+			}
+			if test.tls {
+				r.TLS = &tls.ConnectionState{}
+			} else {
+				r.TLS = nil
+			}
+			for _, header := range test.forwardedFor {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if test.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", test.proto)
+			}
+
+			address, https, proxied := forwarded(r)
+			if address != test.address || https != test.https || proxied != test.proxied {
+				t.Errorf("forwarded is %q, https %v, proxied %v, expected %q, https %v, proxied %v", address, https, proxied, test.address, test.https, test.proxied)
+			}
+
+			// the logged client is the forwarded address
+			var logged string
+			withForwarded(func(w http.ResponseWriter, r *http.Request) {
+				logged = r.RemoteAddr
+			})(httptest.NewRecorder(), r)
+			if logged != test.address {
+				t.Errorf("withForwarded set RemoteAddr to %q, expected %q", logged, test.address)
+			}
+		})
+	}
+}
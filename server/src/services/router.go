@@ -0,0 +1,118 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file builds the router of the server, matching each route by method and path and giving it the middleware it needs in front of its handler.
+ * Requests that match no route are answered with NotFound, or with MethodNotAllowed and the Allow header, and OPTIONS requests with the Allow header alone.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"openorganizer/src/models"
+	"openorganizer/src/utils"
+)
+
+// assigns HTTP routes to their respective handling functions on a new mux
+func NewRouter(env models.ENVVars) *http.ServeMux {
+	mux := http.NewServeMux()
+	readTimeout := time.Duration(env.READ_TIMEOUT) * time.Second
+	writeTimeout := time.Duration(env.WRITE_TIMEOUT) * time.Second
+	timeouts := withTimeouts(readTimeout, writeTimeout)
+
+	// the methods of each path, for requests that match a path but not its method
+	allowed := map[string][]string{}
+
+	// every route is given a request ID first, so that the rest of the chain can log and send errors with it
+	cors := newCORSPolicy(env)
+	common := []middleware{withForwarded, withRequestID, withLogging, withMetrics, withRecovery, withCORS(cors)}
+	route := func(pattern string, handler http.HandlerFunc, middlewares ...middleware) {
+		method, path, _ := strings.Cut(pattern, " ")
+		path = strings.TrimSuffix(path, "{$}")
+		allowed[path] = append(allowed[path], method)
+		mux.HandleFunc(pattern, chain(handler, slices.Concat(common, middlewares)...))
+	}
+	// sync responses are large enough to benefit from compression
+	syncup := func(table string, handler http.HandlerFunc, m routeMessages, recordSize uint32) {
+		route("POST /syncup/"+table, handler, timeouts, withCompression, withCodec(m), withProtocolVersion, withSyncupBody(recordSize), withAuth)
+	}
+	syncdown := func(table string, handler http.HandlerFunc, m routeMessages) {
+		route("POST /syncdown/"+table, handler, timeouts, withCompression, withCodec(m), withProtocolVersion, withBody(utils.SyncdownRequestSize), withAuth)
+	}
+
+	route("GET /{$}", root, timeouts, withCodec(rootMessages))
+	route("POST /{$}", root, timeouts, withCodec(rootMessages))
+	route("GET /capabilities", capabilities, timeouts, withCodec(capabilitiesMessages), withProtocolVersion)
+	route("POST /capabilities", capabilities, timeouts, withCodec(capabilitiesMessages), withProtocolVersion)
+	route("GET /healthz", healthz, timeouts)
+	route("GET /readyz", readyz, timeouts)
+	route("POST /register", register, timeouts, withCodec(registerMessages), withProtocolVersion, withBody(utils.RegisterRequestSize))
+	route("POST /login", login, timeouts, withCodec(loginMessages), withProtocolVersion, withBody(utils.UserLoginSize))
+	route("POST /changelogin", changeLogin, timeouts, withCodec(changeLoginMessages), withProtocolVersion, withBody(utils.ChangeLoginRequestSize))
+	// long polling holds the response for up to the max wait
+	route("POST /lastupdated", lastUpdated, withTimeouts(readTimeout, writeTimeout+longPollMaxWaitTime), withCodec(lastUpdatedMessages), withProtocolVersion, withBody(utils.UserAuthSize, utils.LastUpdatedWaitSize), withAuth)
+	// streams clear their own deadlines
+	route("POST /events", events, withCodec(eventsMessages), withProtocolVersion, withBody(utils.UserAuthSize), withAuth)
+	route("GET /events", events, withProtocolVersion, withAuthHeader, withAuth)
+
+	syncup("notes", upNotes, upNotesMessages, notesRecordSize)
+	syncup("reminders", upReminders, upRemindersMessages, remindersRecordSize)
+	syncup("reminders/daily", upRemindersDaily, upRemindersMessages, remindersRecordSize)
+	syncup("reminders/weekly", upRemindersWeekly, upRemindersMessages, remindersRecordSize)
+	syncup("reminders/monthly", upRemindersMonthly, upRemindersMessages, remindersRecordSize)
+	syncup("reminders/yearly", upRemindersYearly, upRemindersMessages, remindersRecordSize)
+	syncup("extensions", upExtensions, upExtensionsMessages, extensionsRecordSize)
+	syncup("overrides", upOverrides, upOverridesMessages, overridesRecordSize)
+	syncup("folders", upFolders, upFoldersMessages, foldersRecordSize)
+	syncup("deleted", upDeleted, upDeletedMessages, deletedRecordSize)
+
+	syncdown("notes", downNotes, downNotesMessages)
+	syncdown("reminders", downReminders, downRemindersMessages)
+	syncdown("reminders/daily", downRemindersDaily, downRemindersMessages)
+	syncdown("reminders/weekly", downRemindersWeekly, downRemindersMessages)
+	syncdown("reminders/monthly", downRemindersMonthly, downRemindersMessages)
+	syncdown("reminders/yearly", downRemindersYearly, downRemindersMessages)
+	syncdown("extensions", downExtensions, downExtensionsMessages)
+	syncdown("overrides", downOverrides, downOverridesMessages)
+	syncdown("folders", downFolders, downFoldersMessages)
+	syncdown("deleted", downDeleted, downDeletedMessages)
+
+	// the mux's own 404 and 405 responses are plain text, so every request that matches no route comes here instead
+	mux.HandleFunc("/", chain(unrouted(allowed, cors), common...))
+	return mux
+}
+
+// answers requests with no route, either because no route has the path or because none of its routes has the method
+func unrouted(allowed map[string][]string, cors corsPolicy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		methods, found := allowed[r.URL.Path]
+		if !found {
+			writeError(w, r, models.ErrorNotFound, "No endpoint has the path "+r.URL.Path+".")
+			return
+		}
+		// the slice is shared between requests, so it is copied before adding to it
+		methods = slices.Clone(methods)
+		// GET routes also match HEAD
+		if slices.Contains(methods, http.MethodGet) {
+			methods = append(methods, http.MethodHead)
+		}
+		methods = append(methods, http.MethodOptions)
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		if r.Method == http.MethodOptions {
+			cors.preflight(w, r, methods)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeError(w, r, models.ErrorMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path+".")
+	}
+}
@@ -0,0 +1,237 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file loads the certificate of the HTTPS server, and reloads it when its files change or on SIGHUP, so that a renewed certificate is used without a restart.
+ * With TLS_SELF_SIGNED, a self-signed certificate for localhost is generated for development when its files do not exist yet.
+ * With TLS_CLIENT_AUTH, clients authenticate with certificates issued by TLS_CLIENT_CA, and TLS_CLIENT_BIND binds their tokens to those certificates.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"openorganizer/src/models"
+)
+
+// set by TLS_CLIENT_BIND, to bind new tokens to the client certificate they were created with
+var bindClientCertificates bool
+
+// the values of TLS_CLIENT_AUTH
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"NONE":            tls.NoClientCert,
+	"VERIFY_IF_GIVEN": tls.VerifyClientCertIfGiven,
+	"REQUIRE":         tls.RequireAndVerifyClientCert,
+}
+
+// how often the certificate files are checked for changes
+const certCheckInterval = 10 * time.Second
+
+// self-signed certificates are only meant for development, so they do not need to last
+const selfSignedLifetime = 365 * 24 * time.Hour
+
+// serves the last certificate that loaded, so that a renewal that is only half written keeps the old one until it is complete
+type certReloader struct {
+	crtFile string
+	keyFile string
+	lock    sync.RWMutex
+	cert    *tls.Certificate
+	// modification times of the files the certificate was loaded from
+	crtModified time.Time
+	keyModified time.Time
+}
+
+// loads the certificate, generating it first if it is self-signed and missing, and reloads it until ctx is done
+func loadCertificate(ctx context.Context, env models.ENVVars) (*certReloader, error) {
+	if env.TLS_SELF_SIGNED {
+		created, err := ensureSelfSigned(env.SERVER_CRT, env.SERVER_KEY)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate a self-signed certificate: %w", err)
+		}
+		if created {
+			slog.Info("generated a self-signed certificate for localhost", "certificate", env.SERVER_CRT, "key", env.SERVER_KEY)
+		}
+		slog.Warn("using a self-signed certificate, which clients will not trust outside of development")
+	}
+	reloader := &certReloader{crtFile: env.SERVER_CRT, keyFile: env.SERVER_KEY}
+	if _, err := reloader.reload(true); err != nil {
+		return nil, err
+	}
+	// registered before returning, so that a SIGHUP right after startup does not stop the server instead
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go reloader.watch(ctx, hangup)
+	return reloader, nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cert, nil
+}
+
+// loads the files again if they changed since the last load, or whenever force is set
+func (c *certReloader) reload(force bool) (bool, error) {
+	crtInfo, err := os.Stat(c.crtFile)
+	if err != nil {
+		return false, err
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.lock.RLock()
+	changed := !crtInfo.ModTime().Equal(c.crtModified) || !keyInfo.ModTime().Equal(c.keyModified)
+	c.lock.RUnlock()
+	if !changed && !force {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.crtFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cert = &cert
+	c.crtModified = crtInfo.ModTime()
+	c.keyModified = keyInfo.ModTime()
+	return true, nil
+}
+
+// checks the files every certCheckInterval, and reloads them on SIGHUP even if they seem unchanged
+func (c *certReloader) watch(ctx context.Context, hangup chan os.Signal) {
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+	for {
+		var force bool
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-hangup:
+			force = true
+		}
+		reloaded, err := c.reload(force)
+		if err != nil {
+			slog.Error("failed to reload the certificate, keeping the current one", "error", err, "certificate", c.crtFile, "key", c.keyFile)
+		} else if reloaded {
+			slog.Info("reloaded the certificate", "certificate", c.crtFile, "key", c.keyFile)
+		}
+	}
+}
+
+// generates a certificate for localhost if neither file exists, and reports whether it did
+func ensureSelfSigned(crtFile string, keyFile string) (bool, error) {
+	_, crtErr := os.Stat(crtFile)
+	_, keyErr := os.Stat(keyFile)
+	if crtErr == nil && keyErr == nil {
+		return false, nil
+	}
+	if !errors.Is(crtErr, fs.ErrNotExist) || !errors.Is(keyErr, fs.ErrNotExist) {
+		return false, errors.Join(errors.New("only one of the certificate and key files exists"), crtErr, keyErr)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return false, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost", Organization: []string{"OpenOrganizer development"}},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		// backdated so that clocks that are slightly behind still accept it
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	crtDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return false, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	// the key is written first and only readable by the server, and neither file is written over if it appeared in the meantime
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER, 0600); err != nil {
+		return false, err
+	}
+	if err := writePEM(crtFile, "CERTIFICATE", crtDER, 0644); err != nil {
+		return false, errors.Join(err, os.Remove(keyFile))
+	}
+	return true, nil
+}
+
+func writePEM(path string, blockType string, der []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	err = pem.Encode(file, &pem.Block{Type: blockType, Bytes: der})
+	return errors.Join(err, file.Close())
+}
+
+// sets how the HTTPS server authenticates clients, with the certificate authorities in TLS_CLIENT_CA
+func configureClientAuth(config *tls.Config, env models.ENVVars) error {
+	config.ClientAuth = clientAuthTypes[env.TLS_CLIENT_AUTH]
+	if config.ClientAuth == tls.NoClientCert {
+		return nil
+	}
+	bundle, err := os.ReadFile(env.TLS_CLIENT_CA)
+	if err != nil {
+		return fmt.Errorf("failed to read the client certificate authorities: %w", err)
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(bundle) {
+		return errors.New("no certificates found in " + env.TLS_CLIENT_CA)
+	}
+	slog.Info("authenticating clients with certificates", "mode", env.TLS_CLIENT_AUTH, "bind", env.TLS_CLIENT_BIND)
+	return nil
+}
+
+// the SHA-256 fingerprint of the verified client certificate that tokens are bound to, or nil without one or when binding is off
+// requests over SERVER_SOCKET or from a proxy that terminates TLS have no certificate, so tokens that are already bound are rejected on them
+func clientFingerprint(r *http.Request) []byte {
+	if !bindClientCertificates || r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	fingerprint := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+	return fingerprint[:]
+}
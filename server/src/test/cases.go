@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-10-20
- * Updated: 2025-10-29
+ * Updated: 2026-10-19
  *
  * This file has the test cases.
  *
@@ -13,14 +13,36 @@
 package test
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"net"
+	"net/http"
+	"openorganizer/src/db"
 	"openorganizer/src/models"
+	"openorganizer/src/services"
 	"openorganizer/src/utils"
+	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/lib/pq"
 )
 
 // test MAX_RECORD_COUNT retrieval from /
@@ -366,7 +388,7 @@ func test7() bool {
 	// try to double register
 
 	response, responseBody, err = send("register", requestBodyReg)
-	if !expect("7", response, 401, responseBody, -1, err) {
+	if !expect("7", response, 409, responseBody, -1, err) {
 		return fail()
 	}
 
@@ -881,3 +903,1780 @@ func test20() bool {
 
 	return success()
 }
+
+// delete a reminder and check that its extensions and linked overrides are removed, with the overrides getting deleted records
+func test21() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	syncRange := append(utils.BigintToBytes(math.MinInt64), utils.BigintToBytes(math.MaxInt64)...)
+
+	// reminders 1-4 and extensions on itemIDs 1-4
+
+	if !simpleSync("21", 96, "reminders/daily", authHeader) {
+		return fail()
+	}
+	if !simpleSync("21", 4+64, "extensions", authHeader) {
+		return fail()
+	}
+
+	// two overrides linked to reminder 1, one linked to reminder 2
+
+	overrides := []models.RowOverrides{
+		{ItemID: 101, LastModified: 11, LinkedItemID: 1, EncryptedData: utils.RandArray(64)},
+		{ItemID: 102, LastModified: 11, LinkedItemID: 1, EncryptedData: utils.RandArray(64)},
+		{ItemID: 103, LastModified: 11, LinkedItemID: 2, EncryptedData: utils.RandArray(64)},
+	}
+	requestBody := append(authHeader, utils.IntToBytes(int32(len(overrides)))...)
+	for _, override := range overrides {
+		requestBody = append(requestBody, packOverride(override)...)
+	}
+	response, responseBody, err := send("syncup/overrides", requestBody)
+	if !expect("21", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+
+	// delete reminder 1
+
+	delete1 := models.RowDeleted{ItemID: 1, LastModified: 21, ItemTable: 21}
+	requestBody = append(authHeader, utils.IntToBytes(1)...)
+	requestBody = append(requestBody, packDeleted(delete1)...)
+	response, responseBody, err = send("syncup/deleted", requestBody)
+	if !expect("21", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+
+	// 3 extensions and 1 override remain, deleted has the reminder and both of its overrides
+
+	response, responseBody, err = send("syncdown/extensions", append(authHeader, syncRange...))
+	if !expect("21", response, 200, responseBody, 4+(3*(16+4+64)), err) {
+		return fail()
+	}
+	response, responseBody, err = send("syncdown/overrides", append(authHeader, syncRange...))
+	if !expect("21", response, 200, responseBody, 4+(16+8+64), err) {
+		return fail()
+	}
+	if utils.BytesToBigint(responseBody[4:12]) != 103 {
+		fmt.Printf("test21: Override linked to a different item was removed.\n")
+		return fail()
+	}
+	response, responseBody, err = send("syncdown/deleted", append(authHeader, syncRange...))
+	if !expect("21", response, 200, responseBody, 4+(3*18), err) {
+		return fail()
+	}
+
+	return success()
+}
+
+// delete a folder alongside its contents under both folder policies, with the folder deletion being stale
+func test22() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	syncRange := append(utils.BigintToBytes(math.MinInt64), utils.BigintToBytes(math.MaxInt64)...)
+
+	// folders 1-4 with lastModified 11-14 and notes 1-4
+
+	if !simpleSync("22", 0+64, "folders", authHeader) {
+		return fail()
+	}
+	if !simpleSync("22", 128, "notes", authHeader) {
+		return fail()
+	}
+
+	// folder 1 deleted with a lastModified older than an existing deleted record, note 1 is its content
+
+	staleFolder := models.RowDeleted{ItemID: 1, LastModified: 5, ItemTable: 32}
+	newerFolder := models.RowDeleted{ItemID: 1, LastModified: 6, ItemTable: 32}
+	content := models.RowDeleted{ItemID: 1, LastModified: 21, ItemTable: 11}
+	requestBody := append(authHeader, utils.IntToBytes(1)...)
+	requestBody = append(requestBody, packDeleted(newerFolder)...)
+	response, responseBody, err := send("syncup/deleted", requestBody)
+	if !expect("22", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+
+	requestBody = append(authHeader, utils.IntToBytes(2)...)
+	requestBody = append(requestBody, packDeleted(staleFolder)...)
+	requestBody = append(requestBody, packDeleted(content)...)
+
+	// invalid policy
+
+	response, responseBody, err = send("syncup/deleted", requestBody, "Folder-Delete-Policy", "SOMETIMES")
+	if !expect("22", response, 400, responseBody, -1, err) {
+		return fail()
+	}
+
+	// cascade, folder 1 and its note fail, while note 2 before any folder and folder 2 with its note 3 are deleted
+
+	unrelated := models.RowDeleted{ItemID: 2, LastModified: 22, ItemTable: 11}
+	otherFolder := models.RowDeleted{ItemID: 2, LastModified: 30, ItemTable: 32}
+	otherContent := models.RowDeleted{ItemID: 3, LastModified: 31, ItemTable: 11}
+	cascadeBody := append(authHeader, utils.IntToBytes(5)...)
+	for _, deleted := range []models.RowDeleted{unrelated, staleFolder, content, otherFolder, otherContent} {
+		cascadeBody = append(cascadeBody, packDeleted(deleted)...)
+	}
+	response, responseBody, err = send("syncup/deleted", cascadeBody, "Folder-Delete-Policy", "CASCADE")
+	if !expect("22", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+	if responseBody[0] != '\x60' {
+		fmt.Printf("test22: Only folder 1 and its content should have failed under CASCADE, received fails %08b.\n", responseBody[0])
+		return fail()
+	}
+	response, responseBody, err = send("syncdown/notes", append(authHeader, syncRange...))
+	if !expect("22", response, 200, responseBody, 4+(2*(16+128)), err) {
+		return fail()
+	}
+
+	// keep, only the folder fails and the note is deleted
+
+	response, responseBody, err = send("syncup/deleted", requestBody, "Folder-Delete-Policy", "KEEP")
+	if !expect("22", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+	if responseBody[0] != '\x80' {
+		fmt.Printf("test22: Only the folder deletion should have failed under KEEP.\n")
+		return fail()
+	}
+	response, responseBody, err = send("syncdown/notes", append(authHeader, syncRange...))
+	if !expect("22", response, 200, responseBody, 4+(1*(16+128)), err) {
+		return fail()
+	}
+
+	return success()
+}
+
+// upload notes, then upload older versions of them with detailed conflict responses and check the stored versions are returned
+func test23() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+
+	newer := models.RowItems{ItemID: 1, LastModified: 20, EncryptedData: utils.RandArray(128)}
+	older := models.RowItems{ItemID: 1, LastModified: 10, EncryptedData: utils.RandArray(128)}
+	added := models.RowItems{ItemID: 2, LastModified: 10, EncryptedData: utils.RandArray(128)}
+
+	requestBody := append(authHeader, utils.IntToBytes(1)...)
+	requestBody = append(requestBody, packItem(newer)...)
+	response, responseBody, err := send("syncup/notes", requestBody, "Conflict-Response", "DETAILED")
+	if !expect("23", response, 200, responseBody, 1+4, err) {
+		return fail()
+	}
+
+	requestBody = append(authHeader, utils.IntToBytes(2)...)
+	requestBody = append(requestBody, packItem(older)...)
+	requestBody = append(requestBody, packItem(added)...)
+	response, responseBody, err = send("syncup/notes", requestBody, "Conflict-Response", "BOTH")
+	if !expect("23", response, 400, responseBody, -1, err) {
+		return fail()
+	}
+	response, responseBody, err = send("syncup/notes", requestBody, "Conflict-Response", "DETAILED")
+	if !expect("23", response, 200, responseBody, 1+4+(16+128), err) {
+		return fail()
+	}
+	if responseBody[0] != '\x80' || utils.BytesToInt(responseBody[1:5]) != 1 {
+		fmt.Printf("test23: Only the older note should have been rejected.\n")
+		return fail()
+	}
+	if !compareItem(newer, unpackItem(responseBody[5:])) {
+		fmt.Printf("test23: Returned conflict is not the stored note.\n")
+		return fail()
+	}
+
+	return success()
+}
+
+// upload notes with hybrid logical clock values, rejecting ones too far ahead, and retrieve them in both clock formats
+func test24() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	syncRange := append(utils.BigintToBytes(math.MinInt64), utils.BigintToBytes(math.MaxInt64)...)
+
+	const year int64 = 365 * 24 * 60 * 60 * 1000
+	future := models.RowItems{ItemID: 1, LastModified: utils.MillisToClock(utils.Now() + year), EncryptedData: utils.RandArray(128)}
+	present := models.RowItems{ItemID: 1, LastModified: utils.MillisToClock(utils.Now()) + 3, EncryptedData: utils.RandArray(128)}
+
+	requestBody := append(authHeader, utils.IntToBytes(1)...)
+	requestBody = append(requestBody, packItem(future)...)
+	response, responseBody, err := send("syncup/notes", requestBody, "Clock", "HLC")
+	if !expect("24", response, 400, responseBody, -1, err) {
+		return fail()
+	}
+
+	requestBody = append(authHeader, utils.IntToBytes(1)...)
+	requestBody = append(requestBody, packItem(present)...)
+	response, responseBody, err = send("syncup/notes", requestBody, "Clock", "HLC")
+	if !expect("24", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+	serverClock, err := strconv.ParseInt(response.Header.Get("Server-Clock"), 10, 64)
+	if err != nil || serverClock <= present.LastModified {
+		fmt.Printf("test24: Server clock %v did not advance past the received value.\n", serverClock)
+		return fail()
+	}
+
+	response, responseBody, err = send("syncdown/notes", append(authHeader, syncRange...), "Clock", "HLC")
+	if !expect("24", response, 200, responseBody, 4+(16+128), err) {
+		return fail()
+	}
+	stored := unpackItem(responseBody[4:])
+	if stored.LastModified <= present.LastModified || stored.LastModified > serverClock || !compareItem(models.RowItems{ItemID: present.ItemID, LastModified: stored.LastModified, EncryptedData: present.EncryptedData}, stored) {
+		fmt.Printf("test24: Returned note was not stored with the merged clock value.\n")
+		return fail()
+	}
+
+	response, responseBody, err = send("syncdown/notes", append(authHeader, syncRange...))
+	if !expect("24", response, 200, responseBody, 4+(16+128), err) {
+		return fail()
+	}
+	if unpackItem(responseBody[4:]).LastModified != utils.ClockToMillis(stored.LastModified) {
+		fmt.Printf("test24: Returned note does not have the stored clock value in milliseconds.\n")
+		return fail()
+	}
+
+	// a client sending milliseconds from a clock behind the server can still replace its own notes
+
+	behind := models.RowItems{ItemID: 2, LastModified: utils.Now() - 30000, EncryptedData: utils.RandArray(128)}
+	edited := models.RowItems{ItemID: 2, LastModified: behind.LastModified + 1, EncryptedData: utils.RandArray(128)}
+	for _, note := range []models.RowItems{behind, edited} {
+		requestBody = append(authHeader, utils.IntToBytes(1)...)
+		requestBody = append(requestBody, packItem(note)...)
+		response, responseBody, err = send("syncup/notes", requestBody)
+		if !expect("24", response, 200, responseBody, 1, err) {
+			return fail()
+		}
+		if responseBody[0] != '\x00' {
+			fmt.Printf("test24: Note from a clock behind the server with lastModified %v was rejected.\n", note.LastModified)
+			return fail()
+		}
+	}
+	response, responseBody, err = send("syncdown/notes", append(authHeader, syncRange...))
+	if !expect("24", response, 200, responseBody, 4+2*(16+128), err) {
+		return fail()
+	}
+	if !compareItem(edited, unpackItem(responseBody[4+16+128:])) && !compareItem(edited, unpackItem(responseBody[4:])) {
+		fmt.Printf("test24: Edited note was not stored as sent.\n")
+		return fail()
+	}
+
+	// a logical counter that is used up moves the clock to the next millisecond
+
+	saturated := utils.MillisToClock(utils.Now()+10) + 0xFFFF
+	clock, err := utils.ClockReceive(saturated)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if clock != utils.MillisToClock(utils.ClockToMillis(saturated)+1) {
+		fmt.Printf("test24: Clock %v did not move on from the saturated value %v.\n", clock, saturated)
+		return fail()
+	}
+
+	return success()
+}
+
+// retry a syncup with the same idempotency key and check the original response is replayed without new writes
+func test25() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+
+	note := models.RowItems{ItemID: 1, LastModified: 10, EncryptedData: utils.RandArray(128)}
+	requestBody := append(authHeader, utils.IntToBytes(1)...)
+	requestBody = append(requestBody, packItem(note)...)
+	response, responseBody, err := send("syncup/notes", requestBody, "Idempotency-Key", "key1")
+	if !expect("25", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+	_, lastUpBody, err := send("lastupdated", authHeader)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+
+	// retry, the insertion would fail if it was executed again
+
+	time.Sleep(5 * time.Millisecond)
+	response, responseBody, err = send("syncup/notes", requestBody, "Idempotency-Key", "key1")
+	if !expect("25", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+	if responseBody[0] != '\x00' || response.Header.Get("Idempotent-Replayed") != "TRUE" {
+		fmt.Printf("test25: Retried request was not replayed.\n")
+		return fail()
+	}
+	_, lastUpBodyRetry, err := send("lastupdated", authHeader)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if !slices.Equal(lastUpBody, lastUpBodyRetry) {
+		fmt.Printf("test25: Retried request updated lastUpdated.\n")
+		return fail()
+	}
+
+	// same key on a different request, and a new key on the same request
+
+	note.LastModified = 20
+	requestBody = append(authHeader, utils.IntToBytes(1)...)
+	requestBody = append(requestBody, packItem(note)...)
+	response, responseBody, err = send("syncup/notes", requestBody, "Idempotency-Key", "key1")
+	if !expect("25", response, 422, responseBody, -1, err) {
+		return fail()
+	}
+	response, responseBody, err = send("syncup/notes", requestBody, "Idempotency-Key", "key2")
+	if !expect("25", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+	if response.Header.Get("Idempotent-Replayed") != "" {
+		fmt.Printf("test25: New idempotency key was replayed.\n")
+		return fail()
+	}
+
+	// same key and body with a header that changes the response
+
+	response, responseBody, err = send("syncup/notes", requestBody, "Idempotency-Key", "key2", "Conflict-Response", "DETAILED")
+	if !expect("25", response, 422, responseBody, -1, err) {
+		return fail()
+	}
+
+	return success()
+}
+
+// retrieve capabilities, and send requests with supported and unsupported protocol versions
+func test26() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	response, responseBody, err := send("capabilities", []byte{})
+	if !expect("26", response, 200, responseBody, -1, err) {
+		return fail()
+	}
+	versionMax := utils.BytesToSmallint(responseBody[2:4])
+	recordCount := uint32(utils.BytesToInt(responseBody[4:8]))
+	if recordCount != env.MAX_RECORD_COUNT {
+		fmt.Printf("test26: Expected maxRecordCount %v does not match with received %v.\n", env.MAX_RECORD_COUNT, recordCount)
+		return fail()
+	}
+	tableCount := int(responseBody[16])
+	if tableCount != 10 {
+		fmt.Printf("test26: Expected 10 tables but received %v.\n", tableCount)
+		return fail()
+	}
+	nameLength := int(responseBody[17])
+	name := string(responseBody[18 : 18+nameLength])
+	recordSize := utils.BytesToInt(responseBody[18+nameLength : 22+nameLength])
+	if name != "notes" || recordSize != 144 {
+		fmt.Printf("test26: Expected notes with record size 144 but received %s with %v.\n", name, recordSize)
+		return fail()
+	}
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	response, responseBody, err = send("lastupdated", authHeader, "Protocol-Version", strconv.Itoa(int(versionMax)))
+	if !expect("26", response, 200, responseBody, 80, err) {
+		return fail()
+	}
+	response, responseBody, err = send("lastupdated", authHeader, "Protocol-Version", strconv.Itoa(int(versionMax)+1))
+	if !expect("26", response, 400, responseBody, -1, err) {
+		return fail()
+	}
+
+	return success()
+}
+
+// open an event stream, then upload notes and check that a change event for notes arrives
+func test27() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+
+	response, err := http.Post(url+"events", "", bytes.NewBuffer(authHeader))
+	if !expect("27", response, 200, nil, -1, err) {
+		return fail()
+	}
+	defer response.Body.Close()
+
+	// collect the table of every change event as they arrive
+	tables := make(chan string)
+	go func() {
+		reader := bufio.NewReader(response.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(tables)
+				return
+			}
+			if table, found := strings.CutPrefix(line, "data: "); found {
+				tables <- strings.Fields(table)[0]
+			}
+		}
+	}()
+	nextTable := func() string {
+		select {
+		case table := <-tables:
+			return table
+		case <-time.After(2 * time.Second):
+			return ""
+		}
+	}
+
+	for range 10 {
+		if nextTable() == "" {
+			fmt.Printf("test27: Did not receive the initial lastUpdated of every table.\n")
+			return fail()
+		}
+	}
+
+	note := models.RowItems{ItemID: 1, LastModified: 10, EncryptedData: utils.RandArray(128)}
+	requestBody := append(authHeader, utils.IntToBytes(1)...)
+	requestBody = append(requestBody, packItem(note)...)
+	response2, responseBody, err := send("syncup/notes", requestBody)
+	if !expect("27", response2, 200, responseBody, 1, err) {
+		return fail()
+	}
+	if table := nextTable(); table != "notes" {
+		fmt.Printf("test27: Expected a change event for notes but received \"%s\".\n", table)
+		return fail()
+	}
+
+	// the same stream over GET, with the credentials in the Authorization header
+
+	response2, _, err = sendMethod("GET", "events", nil)
+	if !expect("27", response2, 401, nil, -1, err) {
+		return fail()
+	}
+	request, err := http.NewRequest("GET", url+"events", nil)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	request.Header.Set("Authorization", "Bearer "+base64.StdEncoding.EncodeToString(authHeader))
+	response3, err := http.DefaultClient.Do(request)
+	if !expect("27", response3, 200, nil, -1, err) {
+		return fail()
+	}
+	defer response3.Body.Close()
+	line, err := bufio.NewReader(response3.Body).ReadString('\n')
+	if utils.PrintErrorLine(err) || response3.Header.Get("Content-Type") != "text/event-stream" || !strings.HasPrefix(line, "retry: ") {
+		fmt.Printf("test27: GET did not open an event stream.\n")
+		return fail()
+	}
+
+	return success()
+}
+
+// long poll lastUpdated, first timing out without changes, then returning early once notes are uploaded
+func test28() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	response, known, err := send("lastupdated", authHeader)
+	if !expect("28", response, 200, known, 80, err) {
+		return fail()
+	}
+
+	// no changes, held for the whole wait
+
+	requestBody := slices.Concat(authHeader, known, utils.IntToBytes(300))
+	start := time.Now()
+	response, responseBody, err := send("lastupdated", requestBody)
+	if !expect("28", response, 200, responseBody, 80, err) {
+		return fail()
+	}
+	if time.Since(start) < 300*time.Millisecond || !slices.Equal(known, responseBody) {
+		fmt.Printf("test28: Long poll without changes returned early or with different values.\n")
+		return fail()
+	}
+
+	// notes uploaded while waiting
+
+	// authHeader is shared with the goroutine, so neither appends to it
+	requestBody = slices.Concat(authHeader, known, utils.IntToBytes(2000))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		note := models.RowItems{ItemID: 1, LastModified: 10, EncryptedData: utils.RandArray(128)}
+		notesBody := slices.Concat(authHeader, utils.IntToBytes(1), packItem(note))
+		send("syncup/notes", notesBody)
+	}()
+	start = time.Now()
+	response, responseBody, err = send("lastupdated", requestBody)
+	if !expect("28", response, 200, responseBody, 80, err) {
+		return fail()
+	}
+	if time.Since(start) >= 2000*time.Millisecond || utils.BytesToBigint(responseBody[0:8]) <= utils.BytesToBigint(known[0:8]) {
+		fmt.Printf("test28: Long poll did not return once notes changed.\n")
+		return fail()
+	}
+
+	return success()
+}
+
+// upload gzip compressed notes, then sync them down with zstd and gzip compression
+func test29() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+
+	// zeroes compress well enough to be worth compressing
+	requestBody := slices.Concat(authHeader, utils.IntToBytes(4))
+	for i := range 4 {
+		note := models.RowItems{ItemID: int64(i + 1), LastModified: 10, EncryptedData: make([]byte, 128)}
+		requestBody = append(requestBody, packItem(note)...)
+	}
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write(requestBody)
+	gzipWriter.Close()
+	response, responseBody, err := send("syncup/notes", compressed.Bytes(), "Content-Encoding", "gzip")
+	if !expect("29", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+	if responseBody[0] != '\x00' {
+		fmt.Printf("test29: Compressed notes failed to insert.\n")
+		return fail()
+	}
+
+	response, _, err = send("syncup/notes", compressed.Bytes(), "Content-Encoding", "br")
+	if !expect("29", response, 415, nil, -1, err) {
+		return fail()
+	}
+
+	syncRange := append(utils.BigintToBytes(math.MinInt64), utils.BigintToBytes(math.MaxInt64)...)
+	// zstd wins ties, otherwise the higher weight is used
+	acceptEncodings := []string{"gzip, zstd", "gzip, zstd;q=0.5"}
+	for i, encoding := range []string{"zstd", "gzip"} {
+		response, responseBody, err = send("syncdown/notes", slices.Concat(authHeader, syncRange), "Accept-Encoding", acceptEncodings[i])
+		if !expect("29", response, 200, responseBody, -1, err) {
+			return fail()
+		}
+		if response.Header.Get("Content-Encoding") != encoding {
+			fmt.Printf("test29: Expected Content-Encoding %s but received \"%s\".\n", encoding, response.Header.Get("Content-Encoding"))
+			return fail()
+		}
+		var decoder io.ReadCloser
+		if encoding == "zstd" {
+			zstdReader, err := zstd.NewReader(bytes.NewReader(responseBody))
+			if utils.PrintErrorLine(err) {
+				return fail()
+			}
+			decoder = zstdReader.IOReadCloser()
+		} else {
+			decoder, err = gzip.NewReader(bytes.NewReader(responseBody))
+			if utils.PrintErrorLine(err) {
+				return fail()
+			}
+		}
+		decompressed, err := io.ReadAll(decoder)
+		decoder.Close()
+		if utils.PrintErrorLine(err) {
+			return fail()
+		}
+		if len(decompressed) != 4+(4*(16+128)) {
+			fmt.Printf("test29: Expected %v decompressed bytes but received %v.\n", 4+(4*(16+128)), len(decompressed))
+			return fail()
+		}
+	}
+
+	return success()
+}
+
+// sync notes up as JSON and down as Protobuf, then check unsupported codecs are refused
+func test30() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	userAuth := utils.UnpackUserAuth(authHeader)
+
+	notes := []models.RowItems{
+		{ItemID: 1, LastModified: 10, EncryptedData: utils.RandArray(128)},
+		{ItemID: 2, LastModified: 10, EncryptedData: utils.RandArray(128)},
+	}
+	requestBody, err := json.Marshal(models.SyncupRequest[models.RowItems]{Auth: userAuth, Records: notes})
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	response, responseBody, err := send("syncup/notes", requestBody, "Content-Type", "application/json")
+	if !expect("30", response, 200, responseBody, -1, err) {
+		return fail()
+	}
+	var syncupResponse models.SyncupResponse[models.RowItems]
+	err = json.Unmarshal(responseBody, &syncupResponse)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if !slices.Equal(syncupResponse.Fails, []bool{false, false}) {
+		fmt.Printf("test30: Expected no fails but received %v.\n", syncupResponse.Fails)
+		return fail()
+	}
+
+	// protobuf response to a binary request
+
+	syncRange := append(utils.BigintToBytes(math.MinInt64), utils.BigintToBytes(math.MaxInt64)...)
+	response, responseBody, err = send("syncdown/notes", slices.Concat(authHeader, syncRange), "Accept", "application/x-protobuf")
+	if !expect("30", response, 200, responseBody, -1, err) {
+		return fail()
+	}
+	var syncdownResponse models.SyncdownResponse[models.RowItems]
+	err = utils.UnmarshalProtobuf(responseBody, &syncdownResponse)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if len(syncdownResponse.Records) != 2 || !bytes.Equal(syncdownResponse.Records[1].EncryptedData, notes[1].EncryptedData) {
+		fmt.Printf("test30: Protobuf syncdown did not return the notes sent as JSON.\n")
+		return fail()
+	}
+
+	// unsupported codecs, and a token of the wrong size
+
+	response, _, err = send("syncup/notes", requestBody, "Content-Type", "text/plain")
+	if !expect("30", response, 415, nil, -1, err) {
+		return fail()
+	}
+	response, _, err = send("syncdown/notes", slices.Concat(authHeader, syncRange), "Accept", "text/html")
+	if !expect("30", response, 406, nil, -1, err) {
+		return fail()
+	}
+	userAuth.AuthToken = userAuth.AuthToken[:16]
+	requestBody, err = json.Marshal(models.SyncupRequest[models.RowItems]{Auth: userAuth, Records: notes})
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	response, _, err = send("syncup/notes", requestBody, "Content-Type", "application/json")
+	if !expect("30", response, 400, nil, -1, err) {
+		return fail()
+	}
+
+	return success()
+}
+
+// check errors carry their code and request ID in the codec of the request
+func test31() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+
+	// binary error with the client's request ID
+
+	badAuth := slices.Clone(authHeader)
+	badAuth[8] ^= 0xFF
+	response, responseBody, err := send("lastupdated", badAuth, "X-Request-ID", "test31-request")
+	if !expect("31", response, 401, responseBody, -1, err) {
+		return fail()
+	}
+	errorResponse := utils.UnpackErrorResponse(responseBody)
+	if errorResponse.Code != models.ErrorInvalidToken || errorResponse.RequestID != "test31-request" || response.Header.Get("X-Request-ID") != "test31-request" {
+		fmt.Printf("test31: Expected code %v for test31-request but received %v for %s.\n", models.ErrorInvalidToken, errorResponse.Code, errorResponse.RequestID)
+		return fail()
+	}
+
+	// JSON error with a generated request ID
+
+	requestBody, err := json.Marshal(models.UserLogin{Username: pad32([]byte("nobody")), PasswordHash: pad32([]byte("password"))})
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	response, responseBody, err = send("login", requestBody, "Content-Type", "application/json")
+	if !expect("31", response, 401, responseBody, -1, err) {
+		return fail()
+	}
+	err = json.Unmarshal(responseBody, &errorResponse)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if errorResponse.Code != models.ErrorInvalidLogin || errorResponse.RequestID == "" || errorResponse.RequestID != response.Header.Get("X-Request-ID") {
+		fmt.Printf("test31: Expected code %v with a request ID but received %v for %s.\n", models.ErrorInvalidLogin, errorResponse.Code, errorResponse.RequestID)
+		return fail()
+	}
+
+	// taken usernames are a conflict rather than an authorization failure
+
+	response, responseBody, err = simpleRegister()
+	if !expect("31", response, 409, responseBody, -1, err) {
+		return fail()
+	}
+	if code := utils.UnpackErrorResponse(responseBody).Code; code != models.ErrorUsernameTaken {
+		fmt.Printf("test31: Expected code %v but received %v.\n", models.ErrorUsernameTaken, code)
+		return fail()
+	}
+
+	return success()
+}
+
+func test32() bool {
+	// each route only accepts its own methods
+
+	response, responseBody, err := sendMethod("GET", "login", nil)
+	if !expect("32", response, 405, responseBody, -1, err) {
+		return fail()
+	}
+	if code := utils.UnpackErrorResponse(responseBody).Code; code != models.ErrorMethodNotAllowed || response.Header.Get("Allow") != "POST, OPTIONS" {
+		fmt.Printf("test32: Expected code %v with Allow POST, OPTIONS but received %v with %s.\n", models.ErrorMethodNotAllowed, code, response.Header.Get("Allow"))
+		return fail()
+	}
+	response, responseBody, err = sendMethod("GET", "capabilities", nil)
+	if !expect("32", response, 200, responseBody, -1, err) {
+		return fail()
+	}
+
+	// unknown paths are not answered by root
+
+	response, responseBody, err = send("syncup/nothing", nil)
+	if !expect("32", response, 404, responseBody, -1, err) {
+		return fail()
+	}
+	if code := utils.UnpackErrorResponse(responseBody).Code; code != models.ErrorNotFound {
+		fmt.Printf("test32: Expected code %v but received %v.\n", models.ErrorNotFound, code)
+		return fail()
+	}
+
+	// OPTIONS lists the methods
+
+	response, responseBody, err = sendMethod("OPTIONS", "syncdown/notes", nil)
+	if !expect("32", response, 204, responseBody, 0, err) {
+		return fail()
+	}
+	if response.Header.Get("Allow") != "POST, OPTIONS" {
+		fmt.Printf("test32: Expected POST, OPTIONS to be allowed but received %s.\n", response.Header.Get("Allow"))
+		return fail()
+	}
+
+	return success()
+}
+
+func test33() bool {
+	// origins that are not allowed get no CORS headers, unless every origin is
+
+	anyOrigin := slices.Contains(env.CORS_ORIGINS, "*")
+	response, responseBody, err := sendMethod("OPTIONS", "login", nil, "Origin", "https://test33.invalid", "Access-Control-Request-Method", "POST")
+	if !expect("33", response, 204, responseBody, 0, err) {
+		return fail()
+	}
+	if allowed := response.Header.Get("Access-Control-Allow-Methods") != ""; allowed != anyOrigin {
+		fmt.Printf("test33: Expected an unlisted origin to be allowed %v but it was %v.\n", anyOrigin, allowed)
+		return fail()
+	}
+
+	// listed origins are echoed back on the preflight and the request
+
+	if anyOrigin || len(env.CORS_ORIGINS) == 0 {
+		return success()
+	}
+	origin := env.CORS_ORIGINS[0]
+	response, responseBody, err = sendMethod("OPTIONS", "login", nil, "Origin", origin, "Access-Control-Request-Method", "POST")
+	if !expect("33", response, 204, responseBody, 0, err) {
+		return fail()
+	}
+	if response.Header.Get("Access-Control-Allow-Origin") != origin || response.Header.Get("Access-Control-Allow-Methods") != "POST, OPTIONS" {
+		fmt.Printf("test33: Expected %s to be allowed POST, OPTIONS but received %s with %s.\n", origin, response.Header.Get("Access-Control-Allow-Origin"), response.Header.Get("Access-Control-Allow-Methods"))
+		return fail()
+	}
+	response, responseBody, err = send("", nil, "Origin", origin)
+	if !expect("33", response, 200, responseBody, -1, err) {
+		return fail()
+	}
+	if response.Header.Get("Access-Control-Allow-Origin") != origin || !strings.Contains(response.Header.Get("Access-Control-Expose-Headers"), "X-Request-ID") {
+		fmt.Printf("test33: Expected %s to be allowed with exposed headers but received %s.\n", origin, response.Header.Get("Access-Control-Allow-Origin"))
+		return fail()
+	}
+
+	return success()
+}
+
+func test34() bool {
+	// metrics are only served when they have a port
+
+	if env.METRICS_PORT == "" {
+		return success()
+	}
+	response, err := http.Get("http://localhost:" + env.METRICS_PORT + "/metrics")
+	if err != nil {
+		fmt.Printf("test34: %v\n", err)
+		return fail()
+	}
+	defer response.Body.Close()
+	responseBody, err := io.ReadAll(response.Body)
+	if !expect("34", response, 200, responseBody, -1, err) {
+		return fail()
+	}
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/plain") {
+		fmt.Printf("test34: Expected text/plain but received %s.\n", response.Header.Get("Content-Type"))
+		return fail()
+	}
+
+	// the earlier tests logged in, synced notes, and sent an unknown method to /login
+
+	metrics := string(responseBody)
+	for _, series := range []string{
+		`openorganizer_http_requests_total{route="POST /login",status="200"}`,
+		`openorganizer_http_requests_total{route="/",status="405"}`,
+		`openorganizer_http_request_duration_seconds_bucket{route="POST /login",status="200",le="+Inf"}`,
+		`openorganizer_syncup_records_total{table="notes",result="inserted"}`,
+		`openorganizer_syncdown_rows_count{table="notes"}`,
+		`openorganizer_token_validations_total{result="valid"}`,
+		"openorganizer_active_tokens ",
+		"openorganizer_db_open_connections ",
+	} {
+		if !strings.Contains(metrics, series) {
+			fmt.Printf("test34: Expected the series %s in the metrics.\n", series)
+			return fail()
+		}
+	}
+
+	return success()
+}
+
+func test35() bool {
+	// the server is alive and, with the database up and the periodic jobs launched, ready
+
+	response, responseBody, err := sendMethod("GET", "healthz", nil)
+	if !expect("35", response, 204, responseBody, 0, err) {
+		return fail()
+	}
+	response, responseBody, err = sendMethod("GET", "readyz", nil)
+	if !expect("35", response, 204, responseBody, 0, err) {
+		return fail()
+	}
+
+	// probes only accept GET and HEAD
+
+	response, responseBody, err = send("readyz", nil)
+	if !expect("35", response, 405, responseBody, -1, err) {
+		return fail()
+	}
+	if response.Header.Get("Allow") != "GET, HEAD, OPTIONS" {
+		fmt.Printf("test35: Expected GET, HEAD, OPTIONS to be allowed but received %s.\n", response.Header.Get("Allow"))
+		return fail()
+	}
+
+	return success()
+}
+
+// send the same syncup concurrently with one idempotency key and check it is only executed once
+func test36() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	note := models.RowItems{ItemID: 1, LastModified: 10, EncryptedData: utils.RandArray(128)}
+	requestBody := slices.Concat(authHeader, utils.IntToBytes(1), packItem(note))
+
+	// each retry either executes the request, replays it, or is told to retry while it is still running
+	const retries = 8
+	statuses := make([]int, retries)
+	bodies := make([][]byte, retries)
+	replayed := make([]bool, retries)
+	var waitGroup sync.WaitGroup
+	for i := range retries {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			response, responseBody, err := send("syncup/notes", requestBody, "Idempotency-Key", "key1")
+			if utils.PrintErrorLine(err) {
+				return
+			}
+			statuses[i] = response.StatusCode
+			bodies[i] = responseBody
+			replayed[i] = response.Header.Get("Idempotent-Replayed") == "TRUE"
+		}()
+	}
+	waitGroup.Wait()
+
+	executed := 0
+	for i := range retries {
+		if statuses[i] == 409 {
+			continue
+		}
+		// a second execution would have failed to insert the same note
+		if statuses[i] != 200 || !slices.Equal(bodies[i], []byte{'\x00'}) {
+			fmt.Printf("test36: Retry %v received status %v with body %v.\n", i, statuses[i], bodies[i])
+			return fail()
+		}
+		if !replayed[i] {
+			executed++
+		}
+	}
+	if executed != 1 {
+		fmt.Printf("test36: Request was executed %v times.\n", executed)
+		return fail()
+	}
+
+	// once it finished, retries are replayed
+	response, responseBody, err := send("syncup/notes", requestBody, "Idempotency-Key", "key1")
+	if !expect("36", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+	if responseBody[0] != '\x00' || response.Header.Get("Idempotent-Replayed") != "TRUE" {
+		fmt.Printf("test36: Retry after the request finished was not replayed.\n")
+		return fail()
+	}
+
+	return success()
+}
+
+// tokens bound to the fingerprint of a client certificate
+func test37() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	ctx := context.Background()
+	fingerprintA := bytes.Repeat([]byte{'a'}, 32)
+	fingerprintB := bytes.Repeat([]byte{'b'}, 32)
+	userLogin := models.UserLogin{Username: pad32([]byte("username")), PasswordHash: pad32([]byte("password"))}
+	userData := models.UserData{EncrPrivateKey: pad32([]byte("key1")), EncrPrivateKey2: pad32([]byte("key2"))}
+
+	// a token registered with a certificate is only accepted with that certificate
+
+	responseBody, err := db.RegisterUser(ctx, userLogin, userData, fingerprintA)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	boundAuth := utils.UnpackUserAuth(responseBody)
+	if !checkToken(boundAuth, fingerprintA) {
+		fmt.Printf("test37: Bound token was rejected with its own certificate.\n")
+		return fail()
+	}
+	if checkToken(boundAuth, fingerprintB) || checkTokenValid(boundAuth, fingerprintB) {
+		fmt.Printf("test37: Bound token was accepted with another certificate.\n")
+		return fail()
+	}
+	if checkToken(boundAuth, nil) || checkTokenValid(boundAuth, nil) {
+		fmt.Printf("test37: Bound token was accepted without a certificate.\n")
+		return fail()
+	}
+
+	// the test suite sends plain HTTP, which has no certificate, so the bound token fails closed
+
+	authHeader := slices.Concat(utils.BigintToBytes(boundAuth.UserID), boundAuth.AuthToken)
+	response, responseBody, err := send("lastupdated", authHeader)
+	if !expect("37", response, 401, responseBody, -1, err) {
+		return fail()
+	}
+
+	// logging in from another machine binds the new token to its certificate, and leaves the old one bound
+
+	responseBody, err = db.Login(ctx, userLogin, fingerprintB)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	otherAuth := utils.UnpackUserAuth(responseBody)
+	if !checkToken(otherAuth, fingerprintB) || checkToken(otherAuth, fingerprintA) {
+		fmt.Printf("test37: Token from the second login was not bound to its certificate.\n")
+		return fail()
+	}
+	if checkToken(boundAuth, fingerprintB) {
+		fmt.Printf("test37: First token was accepted with the certificate of the second login.\n")
+		return fail()
+	}
+
+	// a token created without a certificate is not bound, and is accepted with any or none
+
+	responseBody, err = db.Login(ctx, userLogin, nil)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	unboundAuth := utils.UnpackUserAuth(responseBody)
+	if !checkToken(unboundAuth, nil) || !checkToken(unboundAuth, fingerprintA) {
+		fmt.Printf("test37: Unbound token was rejected.\n")
+		return fail()
+	}
+	authHeader = slices.Concat(utils.BigintToBytes(unboundAuth.UserID), unboundAuth.AuthToken)
+	response, responseBody, err = send("lastupdated", authHeader)
+	if !expect("37", response, 200, responseBody, 80, err) {
+		return fail()
+	}
+
+	return success()
+}
+
+// migration of the tokens table to schema version 2, which added certFingerprint
+func test38() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	// go back to the tokens table of schema version 1, with a token in it
+
+	ctx := context.Background()
+	userAuth := models.UserAuth{UserID: 1, AuthToken: pad32([]byte("token"))}
+	err := execSQL(`
+DROP TABLE tokens;
+CREATE TABLE tokens (
+	userID BIGINT,
+	creationTime BIGINT,
+	expirationTime BIGINT,
+	authToken BYTEA,
+	PRIMARY KEY(userID, creationTime)
+);
+UPDATE schema_version SET version = 1;
+`)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	err = execSQL(fmt.Sprintf("INSERT INTO tokens VALUES (%v, %v, %v, '\\x%x');", userAuth.UserID, utils.Now(), utils.Now()+3600000, userAuth.AuthToken))
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if db.CheckReady(ctx) == nil {
+		fmt.Printf("test38: Server was ready before the migration.\n")
+		return fail()
+	}
+
+	// the migration adds the column, and tokens from before it are not bound
+
+	errs := db.EnsureDBTables(ctx, models.ENVVars{})
+	if utils.PrintErrorLine(errors.Join(errs...)) {
+		return fail()
+	}
+	if utils.PrintErrorLine(db.CheckReady(ctx)) {
+		return fail()
+	}
+	if !checkToken(userAuth, nil) || !checkToken(userAuth, bytes.Repeat([]byte{'a'}, 32)) {
+		fmt.Printf("test38: Token from before the migration was rejected.\n")
+		return fail()
+	}
+
+	// tokens created after it can be bound
+
+	userLogin := models.UserLogin{Username: pad32([]byte("username")), PasswordHash: pad32([]byte("password"))}
+	userData := models.UserData{EncrPrivateKey: pad32([]byte("key1")), EncrPrivateKey2: pad32([]byte("key2"))}
+	responseBody, err := db.RegisterUser(ctx, userLogin, userData, bytes.Repeat([]byte{'a'}, 32))
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if checkToken(utils.UnpackUserAuth(responseBody), nil) {
+		fmt.Printf("test38: Token created after the migration was not bound.\n")
+		return fail()
+	}
+
+	// running the migrations again changes nothing
+
+	errs = db.EnsureDBTables(ctx, models.ENVVars{})
+	if utils.PrintErrorLine(errors.Join(errs...)) || utils.PrintErrorLine(db.CheckReady(ctx)) {
+		return fail()
+	}
+
+	return success()
+}
+
+// a database failure while checking a token is a server error, not an invalid token
+func test39() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+
+	// with the tokens table gone, the token cannot be checked
+
+	err = execSQL("ALTER TABLE tokens RENAME TO tokens_test39;")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	response, responseBody, err := send("lastupdated", authHeader)
+	restoreErr := execSQL("ALTER TABLE tokens_test39 RENAME TO tokens;")
+	if utils.PrintErrorLine(restoreErr) || !expect("39", response, 500, responseBody, -1, err) {
+		return fail()
+	}
+	if code := utils.UnpackErrorResponse(responseBody).Code; code != models.ErrorInternal {
+		fmt.Printf("test39: Expected code %v but received %v.\n", models.ErrorInternal, code)
+		return fail()
+	}
+
+	// once it is back, a wrong token is invalid and the right one is accepted
+
+	badAuth := slices.Clone(authHeader)
+	badAuth[8] ^= 0xFF
+	response, responseBody, err = send("lastupdated", badAuth)
+	if !expect("39", response, 401, responseBody, -1, err) {
+		return fail()
+	}
+	if code := utils.UnpackErrorResponse(responseBody).Code; code != models.ErrorInvalidToken {
+		fmt.Printf("test39: Expected code %v but received %v.\n", models.ErrorInvalidToken, code)
+		return fail()
+	}
+	response, responseBody, err = send("lastupdated", authHeader)
+	if !expect("39", response, 200, responseBody, 80, err) {
+		return fail()
+	}
+
+	return success()
+}
+
+// a failing row rolls back its syncup batch
+func test40() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	_, lastUpBody, err := send("lastupdated", authHeader)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	syncRange := append(utils.BigintToBytes(math.MinInt64), utils.BigintToBytes(math.MaxInt64)...)
+
+	// notes 1-4 where the database rejects note 3
+
+	requestBody := append(authHeader, utils.IntToBytes(4)...)
+	for i := range int64(4) {
+		note := models.RowItems{ItemID: i + 1, LastModified: 11 + i, EncryptedData: utils.RandArray(128)}
+		requestBody = append(requestBody, packItem(note)...)
+	}
+	err = execSQL("ALTER TABLE notes ADD CONSTRAINT notes_test40 CHECK (itemID <> 3);")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	time.Sleep(5 * time.Millisecond)
+	response, responseBody, err := send("syncup/notes", requestBody)
+	restoreErr := execSQL("ALTER TABLE notes DROP CONSTRAINT notes_test40;")
+	if utils.PrintErrorLine(restoreErr) || !expect("40", response, 500, responseBody, -1, err) {
+		return fail()
+	}
+
+	// none of the notes were stored and lastUpdated did not move
+
+	response, responseBody, err = send("syncdown/notes", append(authHeader, syncRange...))
+	if !expect("40", response, 200, responseBody, 4, err) {
+		return fail()
+	}
+	_, lastUpBodyFailed, err := send("lastupdated", authHeader)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if !slices.Equal(lastUpBody, lastUpBodyFailed) {
+		fmt.Printf("test40: Failed batch updated lastUpdated.\n")
+		return fail()
+	}
+
+	// the same batch succeeds as a whole once the row is accepted
+
+	response, responseBody, err = send("syncup/notes", requestBody)
+	if !expect("40", response, 200, responseBody, 1, err) {
+		return fail()
+	}
+	if responseBody[0] != '\x00' {
+		fmt.Printf("test40: All insertions should have succeeded.\n")
+		return fail()
+	}
+	response, responseBody, err = send("syncdown/notes", append(authHeader, syncRange...))
+	if !expect("40", response, 200, responseBody, 4+(4*(16+128)), err) {
+		return fail()
+	}
+	_, lastUpBodyStored, err := send("lastupdated", authHeader)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if slices.Equal(lastUpBody, lastUpBodyStored) {
+		fmt.Printf("test40: Successful batch did not update lastUpdated.\n")
+		return fail()
+	}
+
+	return success()
+}
+
+// change fan-out between server instances
+func test41() bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type change struct {
+		userID      int64
+		table       string
+		lastUpdated int64
+	}
+	changes := make(chan change, 4)
+	err := db.ListenForChanges(ctx, func(userID int64, table string, lastUpdated int64) {
+		changes <- change{userID, table, lastUpdated}
+	}, func() {})
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	nextChange := func() (change, bool) {
+		select {
+		case received := <-changes:
+			return received, true
+		case <-time.After(2 * time.Second):
+			return change{}, false
+		}
+	}
+
+	// a change published by an instance reaches the listener
+
+	err = db.NotifyChange(context.Background(), 7, "reminders/daily", 1234)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	received, found := nextChange()
+	if !found || received != (change{7, "reminders/daily", 1234}) {
+		fmt.Printf("test41: Expected the published change but received %+v.\n", received)
+		return fail()
+	}
+
+	// a malformed payload is skipped and the listener keeps forwarding
+
+	err = execSQL("NOTIFY openorganizer_changes, 'malformed';")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	err = db.NotifyChange(context.Background(), 8, "notes", 5678)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	received, found = nextChange()
+	if !found || received != (change{8, "notes", 5678}) {
+		fmt.Printf("test41: Expected the change after the malformed payload but received %+v.\n", received)
+		return fail()
+	}
+
+	// a request's cancellation does not stop a change that is already stored from being published
+
+	requestCtx, requestCancel := context.WithCancel(context.Background())
+	requestCancel()
+	err = db.NotifyChange(requestCtx, 9, "folders", 9012)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	received, found = nextChange()
+	if !found || received != (change{9, "folders", 9012}) {
+		fmt.Printf("test41: Expected the change of a cancelled request but received %+v.\n", received)
+		return fail()
+	}
+
+	// nothing is forwarded once the listener is stopped
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	err = db.NotifyChange(context.Background(), 10, "notes", 3456)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if received, found = nextChange(); found {
+		fmt.Printf("test41: Stopped listener forwarded %+v.\n", received)
+		return fail()
+	}
+
+	return success()
+}
+
+// database connection settings
+func test42() bool {
+	database, err := querySQL(env, "SELECT current_database();")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+
+	// the statement timeout is applied to every connection, and 0 lifts it
+
+	timeoutEnv := env
+	timeoutEnv.DB_STATEMENT_TIMEOUT = 1
+	timeout, err := querySQL(timeoutEnv, "SHOW statement_timeout;")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if timeout != "1s" {
+		fmt.Printf("test42: Expected a statement timeout of 1s but received %s.\n", timeout)
+		return fail()
+	}
+	_, err = querySQL(timeoutEnv, "SELECT pg_sleep(2)::text;")
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "57014" {
+		fmt.Printf("test42: Expected a statement past the timeout to be cancelled but received %v.\n", err)
+		return fail()
+	}
+	timeoutEnv.DB_STATEMENT_TIMEOUT = 0
+	timeout, err = querySQL(timeoutEnv, "SHOW statement_timeout;")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if timeout != "0" {
+		fmt.Printf("test42: Expected no statement timeout but received %s.\n", timeout)
+		return fail()
+	}
+
+	// a connection string given as DB_DSN, where the settings that are set override its pairs
+
+	connStr, err := db.ConnString(env)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	dsnEnv := models.ENVVars{DB_DSN: connStr, DB_STATEMENT_TIMEOUT: 3}
+	value, err := querySQL(dsnEnv, "SELECT current_database() || ' ' || current_setting('statement_timeout');")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if value != database+" 3s" {
+		fmt.Printf("test42: Expected %s 3s from DB_DSN but received %s.\n", database, value)
+		return fail()
+	}
+	dsnEnv.DB_NAME = "test42_missing"
+	_, err = querySQL(dsnEnv, "SELECT current_database();")
+	if !errors.As(err, &pqErr) || pqErr.Code != "3D000" {
+		fmt.Printf("test42: Expected DB_NAME to override DB_DSN but received %v.\n", err)
+		return fail()
+	}
+
+	// a postgres:// URL, overridden by the settings of the suite when it is not itself given a DB_DSN
+
+	if env.DB_DSN == "" {
+		urlEnv := env
+		urlEnv.DB_DSN = "postgres://nobody@invalid.invalid:1/nowhere?sslmode=verify-full"
+		value, err = querySQL(urlEnv, "SELECT current_database();")
+		if utils.PrintErrorLine(err) {
+			return fail()
+		}
+		if value != database {
+			fmt.Printf("test42: Expected the settings to override the URL but connected to %s.\n", value)
+			return fail()
+		}
+	}
+	_, err = db.ConnString(models.ENVVars{DB_DSN: "postgres://%zz"})
+	if err == nil {
+		fmt.Printf("test42: Expected an invalid URL in DB_DSN to be rejected.\n")
+		return fail()
+	}
+
+	return success()
+}
+
+// a free port to start another server on
+func freePort() (string, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port), nil
+}
+
+// runs another server until it is shut down, returning once its ports accept connections, and the error Run returns on done
+func startServer(serverEnv models.ENVVars, handler http.Handler) (shutdownServer context.CancelFunc, done chan error, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done = make(chan error, 1)
+	go func() {
+		done <- services.Run(ctx, serverEnv, handler)
+	}()
+	ports := []string{serverEnv.SERVER_PORT_HTTP}
+	if serverEnv.HTTPS {
+		ports = append(ports, serverEnv.SERVER_PORT_HTTPS)
+	}
+	for _, port := range ports {
+		started := false
+		for range 50 {
+			conn, err := net.Dial("tcp", "localhost:"+port)
+			if err == nil {
+				conn.Close()
+				started = true
+				break
+			}
+			select {
+			case err := <-done:
+				cancel()
+				return nil, nil, err
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+		if !started {
+			cancel()
+			return nil, nil, errors.New("server on port " + port + " did not start")
+		}
+	}
+	return cancel, done, nil
+}
+
+// starts another HTTP server whose every request takes inFlight
+func startShutdownServer(drain uint32, timeout uint32, inFlight time.Duration) (serverURL string, shutdownServer context.CancelFunc, done chan error, err error) {
+	shutdownEnv := env
+	shutdownEnv.HTTPS = false
+	shutdownEnv.SERVER_PORT_HTTP, err = freePort()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	shutdownEnv.SERVER_SOCKET = ""
+	shutdownEnv.METRICS_PORT = ""
+	shutdownEnv.SHUTDOWN_DRAIN = drain
+	shutdownEnv.SHUTDOWN_TIMEOUT = timeout
+	shutdownServer, done, err = startServer(shutdownEnv, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(inFlight)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return "http://localhost:" + shutdownEnv.SERVER_PORT_HTTP + "/", shutdownServer, done, err
+}
+
+// graceful shutdown, after every test that uses the running server since the shutdown it begins fails readiness for the whole process
+func test43() bool {
+	clearAllTables()
+	defer clearAllTables()
+
+	authHeader, err := simpleAuthSetup()
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+
+	// an event stream on the running server, which must not hold up the shutdown
+
+	stream, err := http.Post(url+"events", "", bytes.NewBuffer(authHeader))
+	if !expect("43", stream, 200, nil, -1, err) {
+		return fail()
+	}
+	defer stream.Body.Close()
+	streamEnded := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, stream.Body)
+		close(streamEnded)
+	}()
+
+	// a request in flight when the shutdown begins is answered
+
+	serverURL, shutdownServer, done, err := startShutdownServer(1, 2, 1500*time.Millisecond)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	inFlight := make(chan int, 1)
+	go func() {
+		response, err := http.Get(serverURL)
+		if err != nil {
+			inFlight <- 0
+			return
+		}
+		response.Body.Close()
+		inFlight <- response.StatusCode
+	}()
+	time.Sleep(100 * time.Millisecond)
+	shutdownServer()
+
+	// while draining, readiness fails but the server stays alive, and event streams end
+
+	time.Sleep(100 * time.Millisecond)
+	response, responseBody, err := sendMethod("GET", "readyz", nil)
+	if !expect("43", response, 503, responseBody, -1, err) {
+		return fail()
+	}
+	if code := utils.UnpackErrorResponse(responseBody).Code; code != models.ErrorNotReady {
+		fmt.Printf("test43: Expected code %v but received %v.\n", models.ErrorNotReady, code)
+		return fail()
+	}
+	response, responseBody, err = sendMethod("GET", "healthz", nil)
+	if !expect("43", response, 204, responseBody, 0, err) {
+		return fail()
+	}
+	select {
+	case <-streamEnded:
+	case <-time.After(2 * time.Second):
+		fmt.Printf("test43: Event stream stayed open after the shutdown began.\n")
+		return fail()
+	}
+
+	// the server stops once the request is answered, and refuses connections after
+
+	select {
+	case status := <-inFlight:
+		if status != 204 {
+			fmt.Printf("test43: Request in flight was answered with %v instead of 204.\n", status)
+			return fail()
+		}
+	case <-time.After(5 * time.Second):
+		fmt.Printf("test43: Request in flight was not answered.\n")
+		return fail()
+	}
+	select {
+	case err := <-done:
+		if utils.PrintErrorLine(err) {
+			return fail()
+		}
+	case <-time.After(5 * time.Second):
+		fmt.Printf("test43: Server did not stop.\n")
+		return fail()
+	}
+	if response, err := http.Get(serverURL); err == nil {
+		response.Body.Close()
+		fmt.Printf("test43: Server accepted a connection after stopping.\n")
+		return fail()
+	}
+
+	// a request still in flight after the timeout is cut off, and Run reports it
+
+	serverURL, shutdownServer, done, err = startShutdownServer(0, 1, 5*time.Second)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	go func() {
+		response, err := http.Get(serverURL)
+		if err != nil {
+			inFlight <- 0
+			return
+		}
+		response.Body.Close()
+		inFlight <- response.StatusCode
+	}()
+	time.Sleep(100 * time.Millisecond)
+	shutdownServer()
+	select {
+	case err := <-done:
+		if err == nil {
+			fmt.Printf("test43: Run did not report the request cut off by the timeout.\n")
+			return fail()
+		}
+	case <-time.After(5 * time.Second):
+		fmt.Printf("test43: Server did not stop after the timeout.\n")
+		return fail()
+	}
+	if status := <-inFlight; status != 0 {
+		fmt.Printf("test43: Request cut off by the timeout was answered with %v.\n", status)
+		return fail()
+	}
+
+	return success()
+}
+
+// the certificate a server presents on its HTTPS port
+func serverCertificate(port string) (*x509.Certificate, error) {
+	conn, err := tls.Dial("tcp", "localhost:"+port, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(file)
+	if block == nil {
+		return nil, errors.New("no certificate in " + path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// copies the certificate and key of one server over those of another
+func copyCertificate(fromEnv models.ENVVars, toEnv models.ENVVars) error {
+	for _, files := range [][2]string{{fromEnv.SERVER_KEY, toEnv.SERVER_KEY}, {fromEnv.SERVER_CRT, toEnv.SERVER_CRT}} {
+		contents, err := os.ReadFile(files[0])
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(files[1], contents, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reloading of the HTTPS certificate, and self-signed development certificates
+func test44() bool {
+	dir, err := os.MkdirTemp("", "test44")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	defer os.RemoveAll(dir)
+
+	// HTTPS servers with self-signed certificates that do not exist yet
+
+	newHTTPSEnv := func(name string) (models.ENVVars, error) {
+		httpsEnv := env
+		httpsEnv.HTTPS = true
+		httpsEnv.TLS_SELF_SIGNED = true
+		httpsEnv.SERVER_CRT = filepath.Join(dir, name+".crt")
+		httpsEnv.SERVER_KEY = filepath.Join(dir, name+".key")
+		httpsEnv.TLS_CLIENT_AUTH = "NONE"
+		httpsEnv.SERVER_SOCKET = ""
+		httpsEnv.METRICS_PORT = ""
+		httpsEnv.SHUTDOWN_DRAIN = 0
+		var err error
+		httpsEnv.SERVER_PORT_HTTP, err = freePort()
+		if err != nil {
+			return httpsEnv, err
+		}
+		httpsEnv.SERVER_PORT_HTTPS, err = freePort()
+		return httpsEnv, err
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	firstEnv, err := newHTTPSEnv("first")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	shutdownFirst, doneFirst, err := startServer(firstEnv, handler)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	defer shutdownFirst()
+	secondEnv, err := newHTTPSEnv("second")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	shutdownSecond, _, err := startServer(secondEnv, handler)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	defer shutdownSecond()
+
+	// the generated certificate is trusted for localhost, and the key is only readable by the server
+
+	firstCert, err := readCertificate(firstEnv.SERVER_CRT)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(firstCert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	response, err := client.Get("https://localhost:" + firstEnv.SERVER_PORT_HTTPS + "/")
+	if !expect("44", response, 204, nil, -1, err) {
+		return fail()
+	}
+	response.Body.Close()
+	keyInfo, err := os.Stat(firstEnv.SERVER_KEY)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if keyInfo.Mode().Perm() != 0600 {
+		fmt.Printf("test44: Expected the key to be written with 0600 but it has %v.\n", keyInfo.Mode().Perm())
+		return fail()
+	}
+	secondCert, err := readCertificate(secondEnv.SERVER_CRT)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if secondCert.Equal(firstCert) {
+		fmt.Printf("test44: Both servers generated the same certificate.\n")
+		return fail()
+	}
+
+	// a renewed certificate is served after SIGHUP without a restart
+
+	servesCertificate := func(port string, expected *x509.Certificate) bool {
+		for range 50 {
+			served, err := serverCertificate(port)
+			if err == nil && served.Equal(expected) {
+				return true
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		return false
+	}
+	err = copyCertificate(secondEnv, firstEnv)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	err = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if !servesCertificate(firstEnv.SERVER_PORT_HTTPS, secondCert) {
+		fmt.Printf("test44: Renewed certificate was not served after SIGHUP.\n")
+		return fail()
+	}
+
+	// a certificate that does not load keeps the current one
+
+	err = os.WriteFile(firstEnv.SERVER_CRT, []byte("not a certificate"), 0600)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	err = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	time.Sleep(200 * time.Millisecond)
+	served, err := serverCertificate(firstEnv.SERVER_PORT_HTTPS)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	if !served.Equal(secondCert) {
+		fmt.Printf("test44: Certificate that failed to load replaced the current one.\n")
+		return fail()
+	}
+
+	// existing files are served on a restart rather than generated again
+
+	shutdownFirst()
+	if utils.PrintErrorLine(<-doneFirst) {
+		return fail()
+	}
+	err = copyCertificate(secondEnv, firstEnv)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	shutdownFirst, _, err = startServer(firstEnv, handler)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	defer shutdownFirst()
+	if !servesCertificate(firstEnv.SERVER_PORT_HTTPS, secondCert) {
+		fmt.Printf("test44: Existing certificate was not served after a restart.\n")
+		return fail()
+	}
+
+	// nothing is generated when only one of the files exists
+
+	thirdEnv, err := newHTTPSEnv("third")
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	err = os.WriteFile(thirdEnv.SERVER_KEY, []byte("not a key"), 0600)
+	if utils.PrintErrorLine(err) {
+		return fail()
+	}
+	_, _, err = startServer(thirdEnv, handler)
+	if err == nil || !strings.Contains(err.Error(), "only one of the certificate and key files exists") {
+		fmt.Printf("test44: Expected the server to refuse a missing certificate but received %v.\n", err)
+		return fail()
+	}
+	if _, err := os.Stat(thirdEnv.SERVER_CRT); err == nil {
+		fmt.Printf("test44: Certificate was generated next to an existing key.\n")
+		return fail()
+	}
+
+	return success()
+}
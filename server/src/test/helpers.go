@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-10-25
- * Updated: 2025-10-29
+ * Updated: 2026-10-19
  *
  * This file has several helper functions for the testing suite.
  *
@@ -14,6 +14,8 @@ package test
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
@@ -44,7 +46,49 @@ func clearAllTables() {
 		CLEAR_DB_AUTH: true,
 		CLEAR_DB_DATA: true,
 	}
-	db.EnsureDBTables(envClear)
+	db.EnsureDBTables(context.Background(), envClear)
+}
+
+// whether the database accepts a token with the fingerprint of a client certificate, where a failed check is printed and not accepted
+func checkToken(userAuth models.UserAuth, fingerprint []byte) bool {
+	valid, err := db.CheckTokenAuth(context.Background(), userAuth, fingerprint)
+	return !utils.PrintErrorLine(err) && valid
+}
+
+// like checkToken, without refreshing the token
+func checkTokenValid(userAuth models.UserAuth, fingerprint []byte) bool {
+	valid, err := db.CheckTokenValid(context.Background(), userAuth, fingerprint)
+	return !utils.PrintErrorLine(err) && valid
+}
+
+// runs statements directly on the database, for tests that change the schema
+func execSQL(query string) error {
+	connStr, err := db.ConnString(env)
+	if err != nil {
+		return err
+	}
+	conn, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Exec(query)
+	return err
+}
+
+// reads a single value on a new connection made with the database settings of connEnv
+func querySQL(connEnv models.ENVVars, query string) (value string, err error) {
+	connStr, err := db.ConnString(connEnv)
+	if err != nil {
+		return "", err
+	}
+	conn, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	err = conn.QueryRow(query).Scan(&value)
+	return value, err
 }
 
 func clearAuthTables() {
@@ -52,7 +96,7 @@ func clearAuthTables() {
 		CLEAR_DB_AUTH: true,
 		CLEAR_DB_DATA: false,
 	}
-	db.EnsureDBTables(envClear)
+	db.EnsureDBTables(context.Background(), envClear)
 }
 
 func clearDataTables() {
@@ -60,7 +104,7 @@ func clearDataTables() {
 		CLEAR_DB_AUTH: false,
 		CLEAR_DB_DATA: true,
 	}
-	db.EnsureDBTables(envClear)
+	db.EnsureDBTables(context.Background(), envClear)
 }
 
 // pad data
@@ -102,7 +146,12 @@ func expect(testNum string, response *http.Response, expectedStatusCode int, res
 // send to server endpoint
 // headers must be an even amount that are added in (i, i + 1) key-value pairs
 func send(endpoint string, requestBody []byte, headers ...string) (response *http.Response, responseBody []byte, err error) {
-	request, err := http.NewRequest("POST", url+endpoint, bytes.NewBuffer(requestBody))
+	return sendMethod("POST", endpoint, requestBody, headers...)
+}
+
+// send to server endpoint with a method other than POST
+func sendMethod(method string, endpoint string, requestBody []byte, headers ...string) (response *http.Response, responseBody []byte, err error) {
+	request, err := http.NewRequest(method, url+endpoint, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -169,14 +218,23 @@ func packDeleted(deleted models.RowDeleted) (body []byte) {
 	return body
 }
 
-func compareItem(item1 models.RowItems, item2 models.RowItems) bool {
-	if item1.ItemID != item2.ItemID {
+func packOverride(override models.RowOverrides) (body []byte) {
+	body = append(body, utils.BigintToBytes(override.ItemID)...)
+	body = append(body, utils.BigintToBytes(override.LastModified)...)
+	body = append(body, utils.BigintToBytes(override.LinkedItemID)...)
+	body = append(body, override.EncryptedData...)
+	return body
+}
+
+// compares a sent item to the one returned for it, which keeps the lastModified sent in milliseconds
+func compareItem(sent models.RowItems, returned models.RowItems) bool {
+	if sent.ItemID != returned.ItemID {
 		return false
 	}
-	if item1.LastModified != item2.LastModified {
+	if returned.LastModified != sent.LastModified {
 		return false
 	}
-	if !slices.Equal(item1.EncryptedData, item2.EncryptedData) {
+	if !slices.Equal(sent.EncryptedData, returned.EncryptedData) {
 		return false
 	}
 	return true
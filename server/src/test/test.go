@@ -1,7 +1,7 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-10-20
- * Updated: 2025-10-29
+ * Updated: 2026-10-19
  *
  * This file is the entry point for the testing suite.
  *
@@ -85,6 +85,76 @@ PLEASE TERMINATE THE PROGRAM BEFORE THIS TIME ELAPSES IF YOU WOULD LIKE TO PRESE
 	// try incorrect body sizes for all endpoints other than root
 	test20()
 
+	// cascading deletion of extensions and overrides, and folder deletion policies
+	test21()
+	test22()
+
+	// detailed conflict responses on syncup
+	test23()
+
+	// hybrid logical clock values for lastModified
+	test24()
+
+	// retried syncup requests with idempotency keys
+	test25()
+
+	// capabilities and protocol version negotiation
+	test26()
+
+	// change notifications over server-sent events
+	test27()
+
+	// long polling lastUpdated
+	test28()
+
+	// gzip and zstd compression of sync bodies
+	test29()
+
+	// JSON and Protobuf codecs
+	test30()
+
+	// error codes and request IDs
+	test31()
+
+	// methods, unknown paths, and OPTIONS
+	test32()
+
+	// CORS policy
+	test33()
+
+	// Prometheus metrics
+	test34()
+
+	// liveness and readiness probes
+	test35()
+
+	// concurrent retries with one idempotency key
+	test36()
+
+	// tokens bound to client certificates
+	test37()
+
+	// migration that binds tokens to client certificates
+	test38()
+
+	// database failures while checking tokens
+	test39()
+
+	// rollback of a syncup batch with a failing row
+	test40()
+
+	// change fan-out between server instances over LISTEN/NOTIFY
+	test41()
+
+	// database connection settings
+	test42()
+
+	// graceful shutdown, which must follow every test that uses the running server
+	test43()
+
+	// reloading of the HTTPS certificate, and self-signed development certificates
+	test44()
+
 	fmt.Printf("\nTest Suite complete.\n")
 	var failures []uint16
 	for i, b := range successes {
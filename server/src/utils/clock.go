@@ -0,0 +1,100 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file defines the server's hybrid logical clock, which orders lastModified values across devices.
+ * A clock value is the physical time in milliseconds shifted left by 16 bits, with a logical counter in the low 16 bits.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package utils
+
+import (
+	"errors"
+	"sync"
+)
+
+const clockLogicalBits = 16
+const clockLogicalMask = (1 << clockLogicalBits) - 1
+
+var clockMutex sync.Mutex
+var clockLast int64
+
+// max milliseconds a received clock value may be ahead of the server's physical time
+var clockMaxDrift int64 = 60000
+
+func SetClockMaxDrift(seconds uint32) {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	clockMaxDrift = int64(seconds) * 1000
+}
+
+// convert between plain millisecond timestamps and clock values
+
+func MillisToClock(millis int64) int64 {
+	return millis << clockLogicalBits
+}
+
+func ClockToMillis(clock int64) int64 {
+	return clock >> clockLogicalBits
+}
+
+// the clock value of a physical time and logical counter, moving on to the next millisecond once the counter is used up
+func clockValue(physical int64, logical int64) int64 {
+	if logical > clockLogicalMask {
+		physical, logical = physical+1, 0
+	}
+	return MillisToClock(physical) + logical
+}
+
+// advance the server clock for a local event, such as sending a response
+func ClockNow() int64 {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	now := Now()
+	if lastPhysical := ClockToMillis(clockLast); now > lastPhysical {
+		clockLast = MillisToClock(now)
+	} else {
+		clockLast = clockValue(lastPhysical, clockLast&clockLogicalMask+1)
+	}
+	return clockLast
+}
+
+// move the server clock up to a value it issued before, such as the latest lastModified stored by this or another instance
+// the clock is otherwise only kept in memory, so without this a restarted instance or one whose physical time is behind could issue values older than stored ones
+func ClockSeed(clock int64) {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	clockLast = max(clockLast, clock)
+}
+
+// merge a received clock value into the server clock, failing if it is too far ahead of physical time
+func ClockReceive(remote int64) (clock int64, err error) {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	now := Now()
+	if ClockToMillis(remote) > now+clockMaxDrift {
+		return clockLast, errors.New("clock value too far ahead of server time")
+	}
+
+	lastPhysical, lastLogical := ClockToMillis(clockLast), clockLast&clockLogicalMask
+	remotePhysical, remoteLogical := ClockToMillis(remote), remote&clockLogicalMask
+	physical := max(lastPhysical, remotePhysical, now)
+	var logical int64
+	switch {
+	case physical == lastPhysical && physical == remotePhysical:
+		logical = max(lastLogical, remoteLogical) + 1
+	case physical == lastPhysical:
+		logical = lastLogical + 1
+	case physical == remotePhysical:
+		logical = remoteLogical + 1
+	default:
+		logical = 0
+	}
+	clockLast = clockValue(physical, logical)
+	return clockLast, nil
+}
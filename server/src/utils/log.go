@@ -0,0 +1,60 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file sets up structured logging with log/slog, and carries a logger in the context of each request.
+ * The services middleware adds the request ID and user ID to that logger, so anything logged while handling the request includes them.
+ * Log entries name the operation, table, and user involved, but never encrypted data, password hashes, or tokens.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+)
+
+type loggerKey struct{}
+
+// replaces the default logger, with format TEXT or JSON
+func SetupLogger(format string, level slog.Level) {
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if format == "JSON" {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// the logger of the request, or the default logger outside of one
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// logs a non-nil error along with the operation that failed
+// operations cancelled because the client went away are not failures of the server, so they are only logged at debug level
+func LogError(ctx context.Context, err error, operation string, attrs ...any) (nonnil bool) {
+	if err == nil {
+		return false
+	}
+	level := slog.LevelError
+	if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+		level = slog.LevelDebug
+	}
+	Logger(ctx).Log(ctx, level, operation+" failed", append([]any{"operation", operation, "error", err}, attrs...)...)
+	return true
+}
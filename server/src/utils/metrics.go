@@ -0,0 +1,223 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file keeps the metrics of the server and writes them in the Prometheus text format, without depending on a Prometheus client.
+ * Metrics are registered once when their package is initialized, and each series is created the first time its label values are used.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// buckets in seconds for request and query durations
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(ctx context.Context, w io.Writer)
+}
+
+var registryLock sync.Mutex
+var registry = map[string]metric{}
+
+func register(name string, m metric) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, found := registry[name]; found {
+		panic("metric " + name + " is registered twice")
+	}
+	registry[name] = m
+}
+
+// writes every registered metric, sorted by name
+func WriteMetrics(ctx context.Context, w io.Writer) error {
+	registryLock.Lock()
+	var metrics []metric
+	for _, name := range slices.Sorted(maps.Keys(registry)) {
+		metrics = append(metrics, registry[name])
+	}
+	registryLock.Unlock()
+
+	buffered := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(ctx, buffered)
+	}
+	return buffered.Flush()
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func writeHeader(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, kind)
+}
+
+// formats label pairs as {name="value",...}, and panics if a value is missing since that is a bug in the caller
+func formatLabels(names []string, values []string) string {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("metric has labels %v but was given values %v", names, values))
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i := range names {
+		pairs[i] = names[i] + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formats +Inf, -Inf, and NaN the way Prometheus expects them
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// counters
+
+// a value that only goes up, such as the number of requests
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	counter := &Counter{name: name, help: help, labels: labels, values: map[string]float64{}}
+	register(name, counter)
+	return counter
+}
+
+func (c *Counter) Add(value float64, labelValues ...string) {
+	series := formatLabels(c.labels, labelValues)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values[series] += value
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) write(_ context.Context, w io.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	for _, series := range slices.Sorted(maps.Keys(c.values)) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, series, formatValue(c.values[series]))
+	}
+}
+
+// histograms
+
+type histogramSeries struct {
+	labelValues []string
+	// cumulative, so each bucket also counts the values of the buckets below it
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// counts values into buckets by their upper bounds, such as the durations of requests
+type Histogram struct {
+	name   string
+	help   string
+	labels []string
+	bounds []float64
+	lock   sync.Mutex
+	series map[string]*histogramSeries
+}
+
+// bounds must be sorted, and a +Inf bucket is always added after them
+func NewHistogram(name string, help string, bounds []float64, labels ...string) *Histogram {
+	histogram := &Histogram{name: name, help: help, labels: labels, bounds: bounds, series: map[string]*histogramSeries{}}
+	register(name, histogram)
+	return histogram
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := formatLabels(h.labels, labelValues)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	series := h.series[key]
+	if series == nil {
+		series = &histogramSeries{labelValues: slices.Clone(labelValues), buckets: make([]uint64, len(h.bounds))}
+		h.series[key] = series
+	}
+	for i, bound := range h.bounds {
+		if value <= bound {
+			series.buckets[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+func (h *Histogram) write(_ context.Context, w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	bucketLabels := slices.Concat(h.labels, []string{"le"})
+	for _, key := range slices.Sorted(maps.Keys(h.series)) {
+		series := h.series[key]
+		for i, bound := range slices.Concat(h.bounds, []float64{math.Inf(1)}) {
+			count := series.count
+			if i < len(series.buckets) {
+				count = series.buckets[i]
+			}
+			labels := formatLabels(bucketLabels, slices.Concat(series.labelValues, []string{formatValue(bound)}))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, count)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, key, formatValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, key, series.count)
+	}
+}
+
+// values read when the metrics are written
+
+// a value kept elsewhere, such as in the database or the connection pool, and read on every scrape
+type funcMetric struct {
+	name    string
+	help    string
+	kind    string
+	collect func(ctx context.Context) (float64, error)
+}
+
+func NewGaugeFunc(name string, help string, collect func(ctx context.Context) (float64, error)) {
+	register(name, &funcMetric{name: name, help: help, kind: "gauge", collect: collect})
+}
+
+// for counters kept outside of this file, such as the totals of the connection pool
+func NewCounterFunc(name string, help string, collect func(ctx context.Context) (float64, error)) {
+	register(name, &funcMetric{name: name, help: help, kind: "counter", collect: collect})
+}
+
+// a value that fails to be read is left out of the scrape rather than reported as zero
+func (f *funcMetric) write(ctx context.Context, w io.Writer) {
+	value, err := f.collect(ctx)
+	if LogError(ctx, err, "collect metric", "metric", f.name) {
+		return
+	}
+	writeHeader(w, f.name, f.help, f.kind)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatValue(value))
+}
@@ -1,9 +1,10 @@
 /*
  * Authors: Michael Jagiello
  * Created: 2025-10-12
- * Updated: 2025-10-19
+ * Updated: 2026-10-19
  *
  * This file defines functions for turning byte arrays into structs and vice versa to handle receiving/transmitting HTTP response bodies.
+ * Most of them are generated into pack_gen.go from schema/protocol.json, and this file holds the bodies the schema cannot describe.
  *
  * This file is a part of OpenOrganizer.
  * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
@@ -13,189 +14,77 @@
 package utils
 
 import (
-	"encoding/binary"
-	"errors"
+	"fmt"
 
 	"openorganizer/src/models"
 )
 
-// unpack turns received buffer into memory struct(s)
+//go:generate go run ../gen -schema ../../schema/protocol.json -go pack_gen.go -errors ../models/errors_gen.go -doc ../../../doc/protocol.md
 
-func UnpackRegister(requestBody []byte) (userLogin models.UserLogin, userData models.UserData) {
-	userLogin = models.UserLogin{
-		Username:     requestBody[0:32],
-		PasswordHash: requestBody[32:64],
+// fixed size fields are checked so that a wrong size cannot shift the following fields or records
+func checkSize(data []byte, size int, name string) error {
+	if len(data) != size {
+		return fmt.Errorf("%s must be %v bytes", name, size)
 	}
-	userData = models.UserData{
-		EncrPrivateKey:  requestBody[64:96],
-		EncrPrivateKey2: requestBody[96:128],
-	}
-	return userLogin, userData
-}
-
-func UnpackLogin(requestBody []byte) (userLogin models.UserLogin) {
-	userLogin = models.UserLogin{
-		Username:     requestBody[0:32],
-		PasswordHash: requestBody[32:64],
-	}
-	return userLogin
-}
-
-func UnpackChangeLogin(requestBody []byte) (userLogin models.UserLogin, userLoginNew models.UserLogin, userData models.UserData) {
-	userLogin = models.UserLogin{
-		Username:     requestBody[0:32],
-		PasswordHash: requestBody[32:64],
-	}
-	userLoginNew = models.UserLogin{
-		Username:     requestBody[64:96],
-		PasswordHash: requestBody[96:128],
-	}
-	userData = models.UserData{
-		EncrPrivateKey:  requestBody[128:160],
-		EncrPrivateKey2: requestBody[160:192],
-	}
-	return userLogin, userLoginNew, userData
+	return nil
 }
 
-func UnpackUserAuth(requestBody []byte) (userAuth models.UserAuth) {
-	userAuth = models.UserAuth{
-		UserID:    BytesToBigint(requestBody[0:8]),
-		AuthToken: requestBody[8:40],
+// without known, only the auth is sent and /lastupdated responds immediately
+func PackLastUpdatedRequest(request models.LastUpdatedRequest) (requestBody []byte, err error) {
+	if request.Known == nil {
+		return PackUserAuth(request.Auth)
 	}
-	return userAuth
+	return PackLastUpdatedWait(request)
 }
 
-func UnpackSyncupHeader(requestBody []byte) (userAuth models.UserAuth, recordCount uint32) {
-	userAuth = UnpackUserAuth(requestBody)
-	recordCount = binary.LittleEndian.Uint32(requestBody[40:44])
-	return userAuth, recordCount
-}
+// stamp received syncup records with the user they were sent by and the time they were received
 
-func UnpackItems(requestBody []byte, recordSize uint32) (rows []models.RowItems) {
-	userAuth, recordCount := UnpackSyncupHeader(requestBody)
-	const syncupHeaderSize = 44
+func StampItems(request models.SyncupRequest[models.RowItems]) (rows []models.RowItems) {
 	now := Now()
-	for i := range recordCount {
-		var row models.RowItems
-		var recordStart = (recordSize * i) + syncupHeaderSize
-
-		row.UserID = userAuth.UserID
-		row.ItemID = BytesToBigint(requestBody[recordStart : recordStart+8])
-		row.LastModified = BytesToBigint(requestBody[recordStart+8 : recordStart+16])
-		row.LastUpdated = now
-		row.EncryptedData = requestBody[recordStart+16 : recordStart+recordSize]
-
-		rows = append(rows, row)
+	for i := range request.Records {
+		request.Records[i].UserID = request.Auth.UserID
+		request.Records[i].LastUpdated = now
 	}
-	return rows
+	return request.Records
 }
 
-func UnpackExtensions(requestBody []byte, recordSize uint32) (rows []models.RowExtensions) {
-	userAuth, recordCount := UnpackSyncupHeader(requestBody)
-	const syncupHeaderSize = 44
+func StampExtensions(request models.SyncupRequest[models.RowExtensions]) (rows []models.RowExtensions) {
 	now := Now()
-	for i := range recordCount {
-		var row models.RowExtensions
-		var recordStart = (recordSize * i) + syncupHeaderSize
-
-		row.UserID = userAuth.UserID
-		row.ItemID = BytesToBigint(requestBody[recordStart : recordStart+8])
-		row.LastModified = BytesToBigint(requestBody[recordStart+8 : recordStart+16])
-		row.LastUpdated = now
-		row.SequenceNum = BytesToInt(requestBody[recordStart+16 : recordStart+20])
-		row.EncryptedData = requestBody[recordStart+20 : recordStart+recordSize]
-
-		rows = append(rows, row)
+	for i := range request.Records {
+		request.Records[i].UserID = request.Auth.UserID
+		request.Records[i].LastUpdated = now
 	}
-	return rows
+	return request.Records
 }
 
-func UnpackOverrides(requestBody []byte, recordSize uint32) (rows []models.RowOverrides) {
-	userAuth, recordCount := UnpackSyncupHeader(requestBody)
-	const syncupHeaderSize = 44
+func StampOverrides(request models.SyncupRequest[models.RowOverrides]) (rows []models.RowOverrides) {
 	now := Now()
-	for i := range recordCount {
-		var row models.RowOverrides
-		var recordStart = (recordSize * i) + syncupHeaderSize
-
-		row.UserID = userAuth.UserID
-		row.ItemID = BytesToBigint(requestBody[recordStart : recordStart+8])
-		row.LastModified = BytesToBigint(requestBody[recordStart+8 : recordStart+16])
-		row.LastUpdated = now
-		row.LinkedItemID = BytesToBigint(requestBody[recordStart+16 : recordStart+24])
-		row.EncryptedData = requestBody[recordStart+24 : recordStart+recordSize]
-
-		rows = append(rows, row)
+	for i := range request.Records {
+		request.Records[i].UserID = request.Auth.UserID
+		request.Records[i].LastUpdated = now
 	}
-	return rows
+	return request.Records
 }
 
-func UnpackFolders(requestBody []byte, recordSize uint32) (rows []models.RowFolders) {
-	userAuth, recordCount := UnpackSyncupHeader(requestBody)
-	const syncupHeaderSize = 44
+func StampFolders(request models.SyncupRequest[models.RowFolders]) (rows []models.RowFolders) {
 	now := Now()
-	for i := range recordCount {
-		var row models.RowFolders
-		var recordStart = (recordSize * i) + syncupHeaderSize
-
-		row.UserID = userAuth.UserID
-		row.FolderID = BytesToBigint(requestBody[recordStart : recordStart+8])
-		row.LastModified = BytesToBigint(requestBody[recordStart+8 : recordStart+16])
-		row.LastUpdated = now
-		row.EncryptedData = requestBody[recordStart+16 : recordStart+recordSize]
-
-		rows = append(rows, row)
+	for i := range request.Records {
+		request.Records[i].UserID = request.Auth.UserID
+		request.Records[i].LastUpdated = now
 	}
-	return rows
+	return request.Records
 }
 
-func UnpackDeleted(requestBody []byte, recordSize uint32) (rows []models.RowDeleted) {
-	userAuth, recordCount := UnpackSyncupHeader(requestBody)
-	const syncupHeaderSize = 44
+func StampDeleted(request models.SyncupRequest[models.RowDeleted]) (rows []models.RowDeleted) {
 	now := Now()
-	for i := range recordCount {
-		var row models.RowDeleted
-		var recordStart = (recordSize * i) + syncupHeaderSize
-
-		row.UserID = userAuth.UserID
-		row.ItemID = BytesToBigint(requestBody[recordStart : recordStart+8])
-		row.LastModified = BytesToBigint(requestBody[recordStart+8 : recordStart+16])
-		row.LastUpdated = now
-		row.ItemTable = BytesToSmallint(requestBody[recordStart+16 : recordStart+recordSize])
-
-		rows = append(rows, row)
+	for i := range request.Records {
+		request.Records[i].UserID = request.Auth.UserID
+		request.Records[i].LastUpdated = now
 	}
-	return rows
-}
-
-func UnpackSyncdownHeader(requestBody []byte) (userAuth models.UserAuth, startTime int64, endTime int64) {
-	userAuth = UnpackUserAuth(requestBody)
-	startTime = int64(binary.LittleEndian.Uint64(requestBody[40:48]))
-	endTime = int64(binary.LittleEndian.Uint64(requestBody[48:56]))
-	return userAuth, startTime, endTime
-}
-
-// pack turns memory struct(s) into buffer to send
-
-func PackAuth(userAuth models.UserAuth) (responseBody []byte) {
-	responseBody = append(responseBody, BigintToBytes(userAuth.UserID)...)
-	responseBody = append(responseBody, userAuth.AuthToken...)
-	return responseBody
+	return request.Records
 }
 
-func PackLastUpdated(row models.RowLastUpdated) (responseBody []byte) {
-	responseBody = append(responseBody, BigintToBytes(row.LastUpNotes)...)
-	responseBody = append(responseBody, BigintToBytes(row.LastUpReminders)...)
-	responseBody = append(responseBody, BigintToBytes(row.LastUpDaily)...)
-	responseBody = append(responseBody, BigintToBytes(row.LastUpWeekly)...)
-	responseBody = append(responseBody, BigintToBytes(row.LastUpMonthly)...)
-	responseBody = append(responseBody, BigintToBytes(row.LastUpYearly)...)
-	responseBody = append(responseBody, BigintToBytes(row.LastUpExtensions)...)
-	responseBody = append(responseBody, BigintToBytes(row.LastUpOverrides)...)
-	responseBody = append(responseBody, BigintToBytes(row.LastUpFolders)...)
-	responseBody = append(responseBody, BigintToBytes(row.LastUpDeleted)...)
-	return responseBody
-}
+// syncup responses are one fail bit per record, which the schema has no type for
 
 func boolsToByte(eightBools []bool) (comp byte) {
 	for _, b := range eightBools {
@@ -227,81 +116,11 @@ func PackFails(fails []bool) (failsCompressed []byte) {
 	return failsCompressed
 }
 
-func PackItems(rows []models.RowItems, encrDataLength int) (responseBody []byte, err error) {
-	var recordCount uint32 = 0
-	responseBody = append(responseBody, []byte("\x00\x00\x00\x00")...)
-	for _, row := range rows {
-		recordCount++
-		responseBody = append(responseBody, BigintToBytes(row.ItemID)...)
-		responseBody = append(responseBody, BigintToBytes(row.LastModified)...)
-		if len(row.EncryptedData) != encrDataLength {
-			return nil, errors.New("data is not of expected length")
-		}
-		responseBody = append(responseBody, row.EncryptedData...)
-	}
-	copy(responseBody[0:4], IntToBytes(int32(recordCount)))
-	return responseBody, nil
-}
-
-func PackExtensions(rows []models.RowExtensions, encrDataLength int) (responseBody []byte, err error) {
-	var recordCount uint32 = 0
-	responseBody = append(responseBody, []byte("\x00\x00\x00\x00")...)
-	for _, row := range rows {
-		recordCount++
-		responseBody = append(responseBody, BigintToBytes(row.ItemID)...)
-		responseBody = append(responseBody, BigintToBytes(row.LastModified)...)
-		responseBody = append(responseBody, IntToBytes(row.SequenceNum)...)
-		if len(row.EncryptedData) != encrDataLength {
-			return nil, errors.New("data is not of expected length")
-		}
-		responseBody = append(responseBody, row.EncryptedData...)
-	}
-	copy(responseBody[0:4], IntToBytes(int32(recordCount)))
-	return responseBody, nil
-}
-
-func PackOverrides(rows []models.RowOverrides, encrDataLength int) (responseBody []byte, err error) {
-	var recordCount uint32 = 0
-	responseBody = append(responseBody, []byte("\x00\x00\x00\x00")...)
-	for _, row := range rows {
-		recordCount++
-		responseBody = append(responseBody, BigintToBytes(row.ItemID)...)
-		responseBody = append(responseBody, BigintToBytes(row.LastModified)...)
-		responseBody = append(responseBody, BigintToBytes(row.LinkedItemID)...)
-		if len(row.EncryptedData) != encrDataLength {
-			return nil, errors.New("data is not of expected length")
-		}
-		responseBody = append(responseBody, row.EncryptedData...)
-	}
-	copy(responseBody[0:4], IntToBytes(int32(recordCount)))
-	return responseBody, nil
-}
-
-func PackFolders(rows []models.RowFolders, encrDataLength int) (responseBody []byte, err error) {
-	var recordCount uint32 = 0
-	responseBody = append(responseBody, []byte("\x00\x00\x00\x00")...)
-	for _, row := range rows {
-		recordCount++
-		responseBody = append(responseBody, BigintToBytes(row.FolderID)...)
-		responseBody = append(responseBody, BigintToBytes(row.LastModified)...)
-		if len(row.EncryptedData) != encrDataLength {
-			return nil, errors.New("data is not of expected length")
-		}
-		responseBody = append(responseBody, row.EncryptedData...)
-	}
-	copy(responseBody[0:4], IntToBytes(int32(recordCount)))
-	return responseBody, nil
-}
-
-func PackDeleted(rows []models.RowDeleted) (responseBody []byte) {
-	var recordCount uint32 = 0
-	responseBody = append(responseBody, []byte("\x00\x00\x00\x00")...)
-	for _, row := range rows {
-		recordCount++
-		responseBody = append(responseBody, BigintToBytes(row.ItemID)...)
-		responseBody = append(responseBody, BigintToBytes(row.LastModified)...)
-		responseBody = append(responseBody, SmallintToBytes(row.ItemTable)...)
+// expand the compressed fails of recordCount records, dropping the padding bits of the last byte
+func UnpackFails(failsCompressed []byte, recordCount uint32) (fails []bool) {
+	fails = make([]bool, recordCount)
+	for i := range recordCount {
+		fails[i] = failsCompressed[i/8]&(0x80>>(i%8)) != 0
 	}
-	copy(responseBody[0:4], IntToBytes(int32(recordCount)))
-	return responseBody
+	return fails
 }
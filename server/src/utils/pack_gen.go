@@ -0,0 +1,1025 @@
+// Code generated by src/gen from schema/protocol.json. DO NOT EDIT.
+
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"openorganizer/src/models"
+)
+
+// sizes in bytes of the fixed size layouts
+
+const (
+	UserLoginSize          = 64
+	UserDataSize           = 64
+	UserAuthSize           = 40
+	RegisterRequestSize    = 128
+	ChangeLoginRequestSize = 192
+	LoginResponseSize      = 104
+	LastUpdatedSize        = 80
+	LastUpdatedWaitSize    = 124
+	RootResponseSize       = 4
+	SyncupHeaderSize       = 44
+	SyncdownRequestSize    = 56
+	NoteSize               = 144
+	ReminderSize           = 112
+	ExtensionSize          = 84
+	OverrideSize           = 88
+	FolderSize             = 80
+	DeletedSize            = 18
+)
+
+// UserLogin
+
+func PackUserLogin(value models.UserLogin) ([]byte, error) {
+	return packUserLogin(nil, value)
+}
+
+func packUserLogin(buffer []byte, value models.UserLogin) (_ []byte, err error) {
+	if err = checkSize(value.Username, 32, "username"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.Username...)
+	if err = checkSize(value.PasswordHash, 32, "passwordHash"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.PasswordHash...)
+	return buffer, err
+}
+
+func UnpackUserLogin(buffer []byte) (value models.UserLogin) {
+	value, _ = unpackUserLogin(buffer)
+	return value
+}
+
+func unpackUserLogin(buffer []byte) (value models.UserLogin, rest []byte) {
+	value.Username = buffer[0:32]
+	value.PasswordHash = buffer[32:64]
+	return value, buffer[64:]
+}
+
+// UserData
+
+func PackUserData(value models.UserData) ([]byte, error) {
+	return packUserData(nil, value)
+}
+
+func packUserData(buffer []byte, value models.UserData) (_ []byte, err error) {
+	if err = checkSize(value.EncrPrivateKey, 32, "encrPrivateKey"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.EncrPrivateKey...)
+	if err = checkSize(value.EncrPrivateKey2, 32, "encrPrivateKey2"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.EncrPrivateKey2...)
+	return buffer, err
+}
+
+func UnpackUserData(buffer []byte) (value models.UserData) {
+	value, _ = unpackUserData(buffer)
+	return value
+}
+
+func unpackUserData(buffer []byte) (value models.UserData, rest []byte) {
+	value.EncrPrivateKey = buffer[0:32]
+	value.EncrPrivateKey2 = buffer[32:64]
+	return value, buffer[64:]
+}
+
+// UserAuth
+
+func PackUserAuth(value models.UserAuth) ([]byte, error) {
+	return packUserAuth(nil, value)
+}
+
+func packUserAuth(buffer []byte, value models.UserAuth) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.UserID))
+	if err = checkSize(value.AuthToken, 32, "authToken"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.AuthToken...)
+	return buffer, err
+}
+
+func UnpackUserAuth(buffer []byte) (value models.UserAuth) {
+	value, _ = unpackUserAuth(buffer)
+	return value
+}
+
+func unpackUserAuth(buffer []byte) (value models.UserAuth, rest []byte) {
+	value.UserID = int64(binary.LittleEndian.Uint64(buffer[0:8]))
+	value.AuthToken = buffer[8:40]
+	return value, buffer[40:]
+}
+
+// RegisterRequest
+
+func PackRegisterRequest(value models.RegisterRequest) ([]byte, error) {
+	return packRegisterRequest(nil, value)
+}
+
+func packRegisterRequest(buffer []byte, value models.RegisterRequest) (_ []byte, err error) {
+	if buffer, err = packUserLogin(buffer, value.Login); err != nil {
+		return nil, err
+	}
+	if buffer, err = packUserData(buffer, value.Data); err != nil {
+		return nil, err
+	}
+	return buffer, err
+}
+
+func UnpackRegisterRequest(buffer []byte) (value models.RegisterRequest) {
+	value, _ = unpackRegisterRequest(buffer)
+	return value
+}
+
+func unpackRegisterRequest(buffer []byte) (value models.RegisterRequest, rest []byte) {
+	value.Login, _ = unpackUserLogin(buffer[0:64])
+	value.Data, _ = unpackUserData(buffer[64:128])
+	return value, buffer[128:]
+}
+
+// ChangeLoginRequest
+
+func PackChangeLoginRequest(value models.ChangeLoginRequest) ([]byte, error) {
+	return packChangeLoginRequest(nil, value)
+}
+
+func packChangeLoginRequest(buffer []byte, value models.ChangeLoginRequest) (_ []byte, err error) {
+	if buffer, err = packUserLogin(buffer, value.Login); err != nil {
+		return nil, err
+	}
+	if buffer, err = packUserLogin(buffer, value.LoginNew); err != nil {
+		return nil, err
+	}
+	if buffer, err = packUserData(buffer, value.Data); err != nil {
+		return nil, err
+	}
+	return buffer, err
+}
+
+func UnpackChangeLoginRequest(buffer []byte) (value models.ChangeLoginRequest) {
+	value, _ = unpackChangeLoginRequest(buffer)
+	return value
+}
+
+func unpackChangeLoginRequest(buffer []byte) (value models.ChangeLoginRequest, rest []byte) {
+	value.Login, _ = unpackUserLogin(buffer[0:64])
+	value.LoginNew, _ = unpackUserLogin(buffer[64:128])
+	value.Data, _ = unpackUserData(buffer[128:192])
+	return value, buffer[192:]
+}
+
+// LoginResponse
+
+func PackLoginResponse(value models.LoginResponse) ([]byte, error) {
+	return packLoginResponse(nil, value)
+}
+
+func packLoginResponse(buffer []byte, value models.LoginResponse) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	if buffer, err = packUserData(buffer, value.Data); err != nil {
+		return nil, err
+	}
+	return buffer, err
+}
+
+func UnpackLoginResponse(buffer []byte) (value models.LoginResponse) {
+	value, _ = unpackLoginResponse(buffer)
+	return value
+}
+
+func unpackLoginResponse(buffer []byte) (value models.LoginResponse, rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	value.Data, _ = unpackUserData(buffer[40:104])
+	return value, buffer[104:]
+}
+
+// LastUpdated
+
+func PackLastUpdated(value models.RowLastUpdated) []byte {
+	return packLastUpdated(nil, value)
+}
+
+func packLastUpdated(buffer []byte, value models.RowLastUpdated) []byte {
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpNotes))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpReminders))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpDaily))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpWeekly))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpMonthly))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpYearly))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpExtensions))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpOverrides))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpFolders))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastUpDeleted))
+	return buffer
+}
+
+func UnpackLastUpdated(buffer []byte) (value models.RowLastUpdated) {
+	value, _ = unpackLastUpdated(buffer)
+	return value
+}
+
+func unpackLastUpdated(buffer []byte) (value models.RowLastUpdated, rest []byte) {
+	value.LastUpNotes = int64(binary.LittleEndian.Uint64(buffer[0:8]))
+	value.LastUpReminders = int64(binary.LittleEndian.Uint64(buffer[8:16]))
+	value.LastUpDaily = int64(binary.LittleEndian.Uint64(buffer[16:24]))
+	value.LastUpWeekly = int64(binary.LittleEndian.Uint64(buffer[24:32]))
+	value.LastUpMonthly = int64(binary.LittleEndian.Uint64(buffer[32:40]))
+	value.LastUpYearly = int64(binary.LittleEndian.Uint64(buffer[40:48]))
+	value.LastUpExtensions = int64(binary.LittleEndian.Uint64(buffer[48:56]))
+	value.LastUpOverrides = int64(binary.LittleEndian.Uint64(buffer[56:64]))
+	value.LastUpFolders = int64(binary.LittleEndian.Uint64(buffer[64:72]))
+	value.LastUpDeleted = int64(binary.LittleEndian.Uint64(buffer[72:80]))
+	return value, buffer[80:]
+}
+
+// LastUpdatedWait
+
+func PackLastUpdatedWait(value models.LastUpdatedRequest) ([]byte, error) {
+	return packLastUpdatedWait(nil, value)
+}
+
+func packLastUpdatedWait(buffer []byte, value models.LastUpdatedRequest) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	if value.Known == nil {
+		return nil, errors.New("known is required")
+	}
+	buffer = packLastUpdated(buffer, *value.Known)
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(value.MaxWait))
+	return buffer, err
+}
+
+func UnpackLastUpdatedWait(buffer []byte) (value models.LastUpdatedRequest) {
+	value, _ = unpackLastUpdatedWait(buffer)
+	return value
+}
+
+func unpackLastUpdatedWait(buffer []byte) (value models.LastUpdatedRequest, rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	value.Known = new(models.RowLastUpdated)
+	*value.Known, _ = unpackLastUpdated(buffer[40:120])
+	value.MaxWait = binary.LittleEndian.Uint32(buffer[120:124])
+	return value, buffer[124:]
+}
+
+// RootResponse
+
+func PackRootResponse(value models.RootResponse) []byte {
+	return packRootResponse(nil, value)
+}
+
+func packRootResponse(buffer []byte, value models.RootResponse) []byte {
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(value.MaxRecordCount))
+	return buffer
+}
+
+func UnpackRootResponse(buffer []byte) (value models.RootResponse) {
+	value, _ = unpackRootResponse(buffer)
+	return value
+}
+
+func unpackRootResponse(buffer []byte) (value models.RootResponse, rest []byte) {
+	value.MaxRecordCount = binary.LittleEndian.Uint32(buffer[0:4])
+	return value, buffer[4:]
+}
+
+// ErrorResponse
+
+func PackErrorResponse(value models.ErrorResponse) ([]byte, error) {
+	return packErrorResponse(nil, value)
+}
+
+func packErrorResponse(buffer []byte, value models.ErrorResponse) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(value.Code))
+	if len(value.RequestID) > math.MaxUint8 {
+		return nil, errors.New("requestID is longer than 255 bytes")
+	}
+	buffer = append(buffer, byte(len(value.RequestID)))
+	buffer = append(buffer, value.RequestID...)
+	if len(value.Message) > math.MaxUint16 {
+		return nil, errors.New("message is longer than 65535 bytes")
+	}
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(len(value.Message)))
+	buffer = append(buffer, value.Message...)
+	return buffer, err
+}
+
+func UnpackErrorResponse(buffer []byte) (value models.ErrorResponse) {
+	value, _ = unpackErrorResponse(buffer)
+	return value
+}
+
+func unpackErrorResponse(buffer []byte) (value models.ErrorResponse, rest []byte) {
+	value.Code = models.ErrorCode(binary.LittleEndian.Uint16(buffer[0:2]))
+	buffer = buffer[2:]
+	value.RequestID = string(buffer[1 : 1+int(buffer[0])])
+	buffer = buffer[1+int(buffer[0]):]
+	value.Message = string(buffer[2 : 2+int(binary.LittleEndian.Uint16(buffer))])
+	buffer = buffer[2+int(binary.LittleEndian.Uint16(buffer)):]
+	return value, buffer
+}
+
+// TableLayout
+
+func PackTableLayout(value models.TableLayout) ([]byte, error) {
+	return packTableLayout(nil, value)
+}
+
+func packTableLayout(buffer []byte, value models.TableLayout) (_ []byte, err error) {
+	if len(value.Name) > math.MaxUint8 {
+		return nil, errors.New("name is longer than 255 bytes")
+	}
+	buffer = append(buffer, byte(len(value.Name)))
+	buffer = append(buffer, value.Name...)
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(value.RecordSize))
+	return buffer, err
+}
+
+func UnpackTableLayout(buffer []byte) (value models.TableLayout) {
+	value, _ = unpackTableLayout(buffer)
+	return value
+}
+
+func unpackTableLayout(buffer []byte) (value models.TableLayout, rest []byte) {
+	value.Name = string(buffer[1 : 1+int(buffer[0])])
+	buffer = buffer[1+int(buffer[0]):]
+	value.RecordSize = binary.LittleEndian.Uint32(buffer[0:4])
+	return value, buffer[4:]
+}
+
+// Capabilities
+
+func PackCapabilities(value models.Capabilities) ([]byte, error) {
+	return packCapabilities(nil, value)
+}
+
+func packCapabilities(buffer []byte, value models.Capabilities) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(value.ProtocolVersionMin))
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(value.ProtocolVersionMax))
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(value.MaxRecordCount))
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(value.ClockMaxDrift))
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(value.IdempotencyWindow))
+	if len(value.Tables) > math.MaxUint8 {
+		return nil, errors.New("tables has more than 255 elements")
+	}
+	buffer = append(buffer, byte(len(value.Tables)))
+	for _, element := range value.Tables {
+		if buffer, err = packTableLayout(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	if len(value.Features) > math.MaxUint8 {
+		return nil, errors.New("features has more than 255 elements")
+	}
+	buffer = append(buffer, byte(len(value.Features)))
+	for _, element := range value.Features {
+		if len(element) > math.MaxUint8 {
+			return nil, errors.New("features is longer than 255 bytes")
+		}
+		buffer = append(buffer, byte(len(element)))
+		buffer = append(buffer, element...)
+	}
+	return buffer, err
+}
+
+func UnpackCapabilities(buffer []byte) (value models.Capabilities) {
+	value, _ = unpackCapabilities(buffer)
+	return value
+}
+
+func unpackCapabilities(buffer []byte) (value models.Capabilities, rest []byte) {
+	value.ProtocolVersionMin = binary.LittleEndian.Uint16(buffer[0:2])
+	value.ProtocolVersionMax = binary.LittleEndian.Uint16(buffer[2:4])
+	value.MaxRecordCount = binary.LittleEndian.Uint32(buffer[4:8])
+	value.ClockMaxDrift = binary.LittleEndian.Uint32(buffer[8:12])
+	value.IdempotencyWindow = binary.LittleEndian.Uint32(buffer[12:16])
+	buffer = buffer[16:]
+	value.Tables = make([]models.TableLayout, buffer[0])
+	buffer = buffer[1:]
+	for i := range value.Tables {
+		value.Tables[i], buffer = unpackTableLayout(buffer)
+	}
+	value.Features = make([]string, buffer[0])
+	buffer = buffer[1:]
+	for i := range value.Features {
+		value.Features[i] = string(buffer[1 : 1+int(buffer[0])])
+		buffer = buffer[1+int(buffer[0]):]
+	}
+	return value, buffer
+}
+
+// SyncupHeader
+
+func PackSyncupHeader(value models.SyncupHeader) ([]byte, error) {
+	return packSyncupHeader(nil, value)
+}
+
+func packSyncupHeader(buffer []byte, value models.SyncupHeader) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(value.RecordCount))
+	return buffer, err
+}
+
+func UnpackSyncupHeader(buffer []byte) (value models.SyncupHeader) {
+	value, _ = unpackSyncupHeader(buffer)
+	return value
+}
+
+func unpackSyncupHeader(buffer []byte) (value models.SyncupHeader, rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	value.RecordCount = binary.LittleEndian.Uint32(buffer[40:44])
+	return value, buffer[44:]
+}
+
+// SyncdownRequest
+
+func PackSyncdownRequest(value models.SyncdownRequest) ([]byte, error) {
+	return packSyncdownRequest(nil, value)
+}
+
+func packSyncdownRequest(buffer []byte, value models.SyncdownRequest) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.StartTime))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.EndTime))
+	return buffer, err
+}
+
+func UnpackSyncdownRequest(buffer []byte) (value models.SyncdownRequest) {
+	value, _ = unpackSyncdownRequest(buffer)
+	return value
+}
+
+func unpackSyncdownRequest(buffer []byte) (value models.SyncdownRequest, rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	value.StartTime = int64(binary.LittleEndian.Uint64(buffer[40:48]))
+	value.EndTime = int64(binary.LittleEndian.Uint64(buffer[48:56]))
+	return value, buffer[56:]
+}
+
+// Note
+
+func PackNote(value models.RowItems) ([]byte, error) {
+	return packNote(nil, value)
+}
+
+func packNote(buffer []byte, value models.RowItems) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.ItemID))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastModified))
+	if err = checkSize(value.EncryptedData, 128, "encryptedData"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.EncryptedData...)
+	return buffer, err
+}
+
+func UnpackNote(buffer []byte) (value models.RowItems) {
+	value, _ = unpackNote(buffer)
+	return value
+}
+
+func unpackNote(buffer []byte) (value models.RowItems, rest []byte) {
+	value.ItemID = int64(binary.LittleEndian.Uint64(buffer[0:8]))
+	value.LastModified = int64(binary.LittleEndian.Uint64(buffer[8:16]))
+	value.EncryptedData = buffer[16:144]
+	return value, buffer[144:]
+}
+
+// Reminder
+
+func PackReminder(value models.RowItems) ([]byte, error) {
+	return packReminder(nil, value)
+}
+
+func packReminder(buffer []byte, value models.RowItems) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.ItemID))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastModified))
+	if err = checkSize(value.EncryptedData, 96, "encryptedData"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.EncryptedData...)
+	return buffer, err
+}
+
+func UnpackReminder(buffer []byte) (value models.RowItems) {
+	value, _ = unpackReminder(buffer)
+	return value
+}
+
+func unpackReminder(buffer []byte) (value models.RowItems, rest []byte) {
+	value.ItemID = int64(binary.LittleEndian.Uint64(buffer[0:8]))
+	value.LastModified = int64(binary.LittleEndian.Uint64(buffer[8:16]))
+	value.EncryptedData = buffer[16:112]
+	return value, buffer[112:]
+}
+
+// Extension
+
+func PackExtension(value models.RowExtensions) ([]byte, error) {
+	return packExtension(nil, value)
+}
+
+func packExtension(buffer []byte, value models.RowExtensions) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.ItemID))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastModified))
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(value.SequenceNum))
+	if err = checkSize(value.EncryptedData, 64, "encryptedData"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.EncryptedData...)
+	return buffer, err
+}
+
+func UnpackExtension(buffer []byte) (value models.RowExtensions) {
+	value, _ = unpackExtension(buffer)
+	return value
+}
+
+func unpackExtension(buffer []byte) (value models.RowExtensions, rest []byte) {
+	value.ItemID = int64(binary.LittleEndian.Uint64(buffer[0:8]))
+	value.LastModified = int64(binary.LittleEndian.Uint64(buffer[8:16]))
+	value.SequenceNum = int32(binary.LittleEndian.Uint32(buffer[16:20]))
+	value.EncryptedData = buffer[20:84]
+	return value, buffer[84:]
+}
+
+// Override
+
+func PackOverride(value models.RowOverrides) ([]byte, error) {
+	return packOverride(nil, value)
+}
+
+func packOverride(buffer []byte, value models.RowOverrides) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.ItemID))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastModified))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LinkedItemID))
+	if err = checkSize(value.EncryptedData, 64, "encryptedData"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.EncryptedData...)
+	return buffer, err
+}
+
+func UnpackOverride(buffer []byte) (value models.RowOverrides) {
+	value, _ = unpackOverride(buffer)
+	return value
+}
+
+func unpackOverride(buffer []byte) (value models.RowOverrides, rest []byte) {
+	value.ItemID = int64(binary.LittleEndian.Uint64(buffer[0:8]))
+	value.LastModified = int64(binary.LittleEndian.Uint64(buffer[8:16]))
+	value.LinkedItemID = int64(binary.LittleEndian.Uint64(buffer[16:24]))
+	value.EncryptedData = buffer[24:88]
+	return value, buffer[88:]
+}
+
+// Folder
+
+func PackFolder(value models.RowFolders) ([]byte, error) {
+	return packFolder(nil, value)
+}
+
+func packFolder(buffer []byte, value models.RowFolders) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.FolderID))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastModified))
+	if err = checkSize(value.EncryptedData, 64, "encryptedData"); err != nil {
+		return nil, err
+	}
+	buffer = append(buffer, value.EncryptedData...)
+	return buffer, err
+}
+
+func UnpackFolder(buffer []byte) (value models.RowFolders) {
+	value, _ = unpackFolder(buffer)
+	return value
+}
+
+func unpackFolder(buffer []byte) (value models.RowFolders, rest []byte) {
+	value.FolderID = int64(binary.LittleEndian.Uint64(buffer[0:8]))
+	value.LastModified = int64(binary.LittleEndian.Uint64(buffer[8:16]))
+	value.EncryptedData = buffer[16:80]
+	return value, buffer[80:]
+}
+
+// Deleted
+
+func PackDeleted(value models.RowDeleted) []byte {
+	return packDeleted(nil, value)
+}
+
+func packDeleted(buffer []byte, value models.RowDeleted) []byte {
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.ItemID))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(value.LastModified))
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(value.ItemTable))
+	return buffer
+}
+
+func UnpackDeleted(buffer []byte) (value models.RowDeleted) {
+	value, _ = unpackDeleted(buffer)
+	return value
+}
+
+func unpackDeleted(buffer []byte) (value models.RowDeleted, rest []byte) {
+	value.ItemID = int64(binary.LittleEndian.Uint64(buffer[0:8]))
+	value.LastModified = int64(binary.LittleEndian.Uint64(buffer[8:16]))
+	value.ItemTable = int16(binary.LittleEndian.Uint16(buffer[16:18]))
+	return value, buffer[18:]
+}
+
+// NotesSyncup
+
+func PackNotesSyncup(value models.SyncupRequest[models.RowItems]) ([]byte, error) {
+	return packNotesSyncup(nil, value)
+}
+
+func packNotesSyncup(buffer []byte, value models.SyncupRequest[models.RowItems]) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packNote(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackNotesSyncup(buffer []byte) (value models.SyncupRequest[models.RowItems]) {
+	value, _ = unpackNotesSyncup(buffer)
+	return value
+}
+
+func unpackNotesSyncup(buffer []byte) (value models.SyncupRequest[models.RowItems], rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	buffer = buffer[40:]
+	value.Records = make([]models.RowItems, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackNote(buffer)
+	}
+	return value, buffer
+}
+
+// RemindersSyncup
+
+func PackRemindersSyncup(value models.SyncupRequest[models.RowItems]) ([]byte, error) {
+	return packRemindersSyncup(nil, value)
+}
+
+func packRemindersSyncup(buffer []byte, value models.SyncupRequest[models.RowItems]) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packReminder(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackRemindersSyncup(buffer []byte) (value models.SyncupRequest[models.RowItems]) {
+	value, _ = unpackRemindersSyncup(buffer)
+	return value
+}
+
+func unpackRemindersSyncup(buffer []byte) (value models.SyncupRequest[models.RowItems], rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	buffer = buffer[40:]
+	value.Records = make([]models.RowItems, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackReminder(buffer)
+	}
+	return value, buffer
+}
+
+// ExtensionsSyncup
+
+func PackExtensionsSyncup(value models.SyncupRequest[models.RowExtensions]) ([]byte, error) {
+	return packExtensionsSyncup(nil, value)
+}
+
+func packExtensionsSyncup(buffer []byte, value models.SyncupRequest[models.RowExtensions]) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packExtension(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackExtensionsSyncup(buffer []byte) (value models.SyncupRequest[models.RowExtensions]) {
+	value, _ = unpackExtensionsSyncup(buffer)
+	return value
+}
+
+func unpackExtensionsSyncup(buffer []byte) (value models.SyncupRequest[models.RowExtensions], rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	buffer = buffer[40:]
+	value.Records = make([]models.RowExtensions, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackExtension(buffer)
+	}
+	return value, buffer
+}
+
+// OverridesSyncup
+
+func PackOverridesSyncup(value models.SyncupRequest[models.RowOverrides]) ([]byte, error) {
+	return packOverridesSyncup(nil, value)
+}
+
+func packOverridesSyncup(buffer []byte, value models.SyncupRequest[models.RowOverrides]) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packOverride(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackOverridesSyncup(buffer []byte) (value models.SyncupRequest[models.RowOverrides]) {
+	value, _ = unpackOverridesSyncup(buffer)
+	return value
+}
+
+func unpackOverridesSyncup(buffer []byte) (value models.SyncupRequest[models.RowOverrides], rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	buffer = buffer[40:]
+	value.Records = make([]models.RowOverrides, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackOverride(buffer)
+	}
+	return value, buffer
+}
+
+// FoldersSyncup
+
+func PackFoldersSyncup(value models.SyncupRequest[models.RowFolders]) ([]byte, error) {
+	return packFoldersSyncup(nil, value)
+}
+
+func packFoldersSyncup(buffer []byte, value models.SyncupRequest[models.RowFolders]) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packFolder(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackFoldersSyncup(buffer []byte) (value models.SyncupRequest[models.RowFolders]) {
+	value, _ = unpackFoldersSyncup(buffer)
+	return value
+}
+
+func unpackFoldersSyncup(buffer []byte) (value models.SyncupRequest[models.RowFolders], rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	buffer = buffer[40:]
+	value.Records = make([]models.RowFolders, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackFolder(buffer)
+	}
+	return value, buffer
+}
+
+// DeletedSyncup
+
+func PackDeletedSyncup(value models.SyncupRequest[models.RowDeleted]) ([]byte, error) {
+	return packDeletedSyncup(nil, value)
+}
+
+func packDeletedSyncup(buffer []byte, value models.SyncupRequest[models.RowDeleted]) (_ []byte, err error) {
+	if buffer, err = packUserAuth(buffer, value.Auth); err != nil {
+		return nil, err
+	}
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		buffer = packDeleted(buffer, element)
+	}
+	return buffer, err
+}
+
+func UnpackDeletedSyncup(buffer []byte) (value models.SyncupRequest[models.RowDeleted]) {
+	value, _ = unpackDeletedSyncup(buffer)
+	return value
+}
+
+func unpackDeletedSyncup(buffer []byte) (value models.SyncupRequest[models.RowDeleted], rest []byte) {
+	value.Auth, _ = unpackUserAuth(buffer[0:40])
+	buffer = buffer[40:]
+	value.Records = make([]models.RowDeleted, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackDeleted(buffer)
+	}
+	return value, buffer
+}
+
+// NotesSyncdown
+
+func PackNotesSyncdown(value models.SyncdownResponse[models.RowItems]) ([]byte, error) {
+	return packNotesSyncdown(nil, value)
+}
+
+func packNotesSyncdown(buffer []byte, value models.SyncdownResponse[models.RowItems]) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packNote(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackNotesSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowItems]) {
+	value, _ = unpackNotesSyncdown(buffer)
+	return value
+}
+
+func unpackNotesSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowItems], rest []byte) {
+	value.Records = make([]models.RowItems, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackNote(buffer)
+	}
+	return value, buffer
+}
+
+// RemindersSyncdown
+
+func PackRemindersSyncdown(value models.SyncdownResponse[models.RowItems]) ([]byte, error) {
+	return packRemindersSyncdown(nil, value)
+}
+
+func packRemindersSyncdown(buffer []byte, value models.SyncdownResponse[models.RowItems]) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packReminder(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackRemindersSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowItems]) {
+	value, _ = unpackRemindersSyncdown(buffer)
+	return value
+}
+
+func unpackRemindersSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowItems], rest []byte) {
+	value.Records = make([]models.RowItems, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackReminder(buffer)
+	}
+	return value, buffer
+}
+
+// ExtensionsSyncdown
+
+func PackExtensionsSyncdown(value models.SyncdownResponse[models.RowExtensions]) ([]byte, error) {
+	return packExtensionsSyncdown(nil, value)
+}
+
+func packExtensionsSyncdown(buffer []byte, value models.SyncdownResponse[models.RowExtensions]) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packExtension(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackExtensionsSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowExtensions]) {
+	value, _ = unpackExtensionsSyncdown(buffer)
+	return value
+}
+
+func unpackExtensionsSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowExtensions], rest []byte) {
+	value.Records = make([]models.RowExtensions, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackExtension(buffer)
+	}
+	return value, buffer
+}
+
+// OverridesSyncdown
+
+func PackOverridesSyncdown(value models.SyncdownResponse[models.RowOverrides]) ([]byte, error) {
+	return packOverridesSyncdown(nil, value)
+}
+
+func packOverridesSyncdown(buffer []byte, value models.SyncdownResponse[models.RowOverrides]) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packOverride(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackOverridesSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowOverrides]) {
+	value, _ = unpackOverridesSyncdown(buffer)
+	return value
+}
+
+func unpackOverridesSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowOverrides], rest []byte) {
+	value.Records = make([]models.RowOverrides, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackOverride(buffer)
+	}
+	return value, buffer
+}
+
+// FoldersSyncdown
+
+func PackFoldersSyncdown(value models.SyncdownResponse[models.RowFolders]) ([]byte, error) {
+	return packFoldersSyncdown(nil, value)
+}
+
+func packFoldersSyncdown(buffer []byte, value models.SyncdownResponse[models.RowFolders]) (_ []byte, err error) {
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		if buffer, err = packFolder(buffer, element); err != nil {
+			return nil, err
+		}
+	}
+	return buffer, err
+}
+
+func UnpackFoldersSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowFolders]) {
+	value, _ = unpackFoldersSyncdown(buffer)
+	return value
+}
+
+func unpackFoldersSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowFolders], rest []byte) {
+	value.Records = make([]models.RowFolders, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackFolder(buffer)
+	}
+	return value, buffer
+}
+
+// DeletedSyncdown
+
+func PackDeletedSyncdown(value models.SyncdownResponse[models.RowDeleted]) []byte {
+	return packDeletedSyncdown(nil, value)
+}
+
+func packDeletedSyncdown(buffer []byte, value models.SyncdownResponse[models.RowDeleted]) []byte {
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value.Records)))
+	for _, element := range value.Records {
+		buffer = packDeleted(buffer, element)
+	}
+	return buffer
+}
+
+func UnpackDeletedSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowDeleted]) {
+	value, _ = unpackDeletedSyncdown(buffer)
+	return value
+}
+
+func unpackDeletedSyncdown(buffer []byte) (value models.SyncdownResponse[models.RowDeleted], rest []byte) {
+	value.Records = make([]models.RowDeleted, binary.LittleEndian.Uint32(buffer[0:4]))
+	buffer = buffer[4:]
+	for i := range value.Records {
+		value.Records[i], buffer = unpackDeleted(buffer)
+	}
+	return value, buffer
+}
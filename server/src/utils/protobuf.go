@@ -0,0 +1,287 @@
+/*
+ * Authors: Michael Jagiello
+ * Created: 2026-10-19
+ * Updated: 2026-10-19
+ *
+ * This file defines functions for encoding structs as Protobuf messages and decoding them back, using the proto tags on each field as its field number.
+ * Only the field types used by the models package are supported: integers, bools, strings, byte slices, structs, struct pointers, and slices of bools, strings, or structs.
+ *
+ * This file is a part of OpenOrganizer.
+ * This file and all source code within it are governed by the copyright and license terms outlined in the LICENSE file located in the top-level directory of this distribution.
+ * No part of OpenOrganizer, including this file, may be reproduced, modified, distributed, or otherwise used except in accordance with the terms specified in the LICENSE file.
+ */
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// field numbers of a struct type's tagged fields, mapped to the field index
+func protoFields(structType reflect.Type) (fields map[protowire.Number]int, err error) {
+	fields = map[protowire.Number]int{}
+	for i := range structType.NumField() {
+		tag := structType.Field(i).Tag.Get("proto")
+		if tag == "" {
+			continue
+		}
+		number, err := strconv.Atoi(tag)
+		if err != nil || !protowire.Number(number).IsValid() {
+			return nil, fmt.Errorf("invalid proto tag on %s.%s", structType.Name(), structType.Field(i).Name)
+		}
+		fields[protowire.Number(number)] = i
+	}
+	return fields, nil
+}
+
+// encode
+
+func MarshalProtobuf(message any) ([]byte, error) {
+	value := reflect.ValueOf(message)
+	if value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, errors.New("protobuf message must be a struct")
+	}
+	return appendProtoMessage(nil, value)
+}
+
+func appendProtoMessage(data []byte, value reflect.Value) ([]byte, error) {
+	fields, err := protoFields(value.Type())
+	if err != nil {
+		return nil, err
+	}
+	// in field number order so that encoding is deterministic
+	for _, number := range slices.Sorted(maps.Keys(fields)) {
+		data, err = appendProtoField(data, number, value.Field(fields[number]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func appendProtoField(data []byte, number protowire.Number, value reflect.Value) ([]byte, error) {
+	switch value.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.Int() != 0 {
+			data = protowire.AppendTag(data, number, protowire.VarintType)
+			data = protowire.AppendVarint(data, uint64(value.Int()))
+		}
+	case reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value.Uint() != 0 {
+			data = protowire.AppendTag(data, number, protowire.VarintType)
+			data = protowire.AppendVarint(data, value.Uint())
+		}
+	case reflect.Bool:
+		if value.Bool() {
+			data = protowire.AppendTag(data, number, protowire.VarintType)
+			data = protowire.AppendVarint(data, 1)
+		}
+	case reflect.String:
+		if value.Len() > 0 {
+			data = protowire.AppendTag(data, number, protowire.BytesType)
+			data = protowire.AppendString(data, value.String())
+		}
+	case reflect.Struct:
+		embedded, err := appendProtoMessage(nil, value)
+		if err != nil {
+			return nil, err
+		}
+		data = protowire.AppendTag(data, number, protowire.BytesType)
+		data = protowire.AppendBytes(data, embedded)
+	case reflect.Pointer:
+		if !value.IsNil() {
+			return appendProtoField(data, number, value.Elem())
+		}
+	case reflect.Slice:
+		return appendProtoSlice(data, number, value)
+	default:
+		return nil, fmt.Errorf("unsupported protobuf field type %s", value.Type())
+	}
+	return data, nil
+}
+
+func appendProtoSlice(data []byte, number protowire.Number, value reflect.Value) ([]byte, error) {
+	if value.Len() == 0 {
+		return data, nil
+	}
+	switch value.Type().Elem().Kind() {
+	case reflect.Uint8:
+		data = protowire.AppendTag(data, number, protowire.BytesType)
+		data = protowire.AppendBytes(data, value.Bytes())
+	case reflect.Bool:
+		// repeated scalars are packed
+		var packed []byte
+		for i := range value.Len() {
+			packed = protowire.AppendVarint(packed, protowire.EncodeBool(value.Index(i).Bool()))
+		}
+		data = protowire.AppendTag(data, number, protowire.BytesType)
+		data = protowire.AppendBytes(data, packed)
+	case reflect.String:
+		// empty strings are still sent, since they take up an element
+		for i := range value.Len() {
+			data = protowire.AppendTag(data, number, protowire.BytesType)
+			data = protowire.AppendString(data, value.Index(i).String())
+		}
+	case reflect.Struct:
+		for i := range value.Len() {
+			var err error
+			data, err = appendProtoField(data, number, value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported protobuf field type %s", value.Type())
+	}
+	return data, nil
+}
+
+// decode
+
+func UnmarshalProtobuf(data []byte, message any) error {
+	value := reflect.ValueOf(message)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return errors.New("protobuf message must be a pointer to a struct")
+	}
+	return consumeProtoMessage(data, value.Elem())
+}
+
+func consumeProtoMessage(data []byte, value reflect.Value) error {
+	fields, err := protoFields(value.Type())
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		index, found := fields[number]
+		if !found {
+			// unknown fields are skipped so that newer clients can add fields
+			n = protowire.ConsumeFieldValue(number, wireType, data)
+		} else {
+			n, err = consumeProtoField(data, wireType, value.Field(index))
+			if err != nil {
+				return fmt.Errorf("field %v: %w", number, err)
+			}
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+var errProtoWireType = errors.New("wrong wire type")
+
+func consumeProtoField(data []byte, wireType protowire.Type, value reflect.Value) (n int, err error) {
+	switch value.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if wireType != protowire.VarintType {
+			return 0, errProtoWireType
+		}
+		varint, n := protowire.ConsumeVarint(data)
+		if n >= 0 {
+			if value.OverflowInt(int64(varint)) {
+				return 0, errors.New("value out of range")
+			}
+			value.SetInt(int64(varint))
+		}
+		return n, nil
+	case reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if wireType != protowire.VarintType {
+			return 0, errProtoWireType
+		}
+		varint, n := protowire.ConsumeVarint(data)
+		if n >= 0 {
+			if value.OverflowUint(varint) {
+				return 0, errors.New("value out of range")
+			}
+			value.SetUint(varint)
+		}
+		return n, nil
+	case reflect.Bool:
+		if wireType != protowire.VarintType {
+			return 0, errProtoWireType
+		}
+		varint, n := protowire.ConsumeVarint(data)
+		value.SetBool(protowire.DecodeBool(varint))
+		return n, nil
+	case reflect.Pointer:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return consumeProtoField(data, wireType, value.Elem())
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Bool {
+			return consumeProtoBools(data, wireType, value)
+		}
+	}
+
+	// everything else is length delimited
+	if wireType != protowire.BytesType {
+		return 0, errProtoWireType
+	}
+	bytes, n := protowire.ConsumeBytes(data)
+	if n < 0 {
+		return n, nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(string(bytes))
+	case reflect.Struct:
+		err = consumeProtoMessage(bytes, value)
+	case reflect.Slice:
+		switch value.Type().Elem().Kind() {
+		case reflect.Uint8:
+			value.SetBytes(append([]byte{}, bytes...))
+		case reflect.String:
+			value.Set(reflect.Append(value, reflect.ValueOf(string(bytes))))
+		case reflect.Struct:
+			element := reflect.New(value.Type().Elem()).Elem()
+			err = consumeProtoMessage(bytes, element)
+			value.Set(reflect.Append(value, element))
+		default:
+			err = fmt.Errorf("unsupported protobuf field type %s", value.Type())
+		}
+	default:
+		err = fmt.Errorf("unsupported protobuf field type %s", value.Type())
+	}
+	return n, err
+}
+
+// repeated bools may be packed or sent one per tag
+func consumeProtoBools(data []byte, wireType protowire.Type, value reflect.Value) (n int, err error) {
+	switch wireType {
+	case protowire.VarintType:
+		varint, n := protowire.ConsumeVarint(data)
+		value.Set(reflect.Append(value, reflect.ValueOf(protowire.DecodeBool(varint))))
+		return n, nil
+	case protowire.BytesType:
+		packed, n := protowire.ConsumeBytes(data)
+		for len(packed) > 0 {
+			varint, m := protowire.ConsumeVarint(packed)
+			if m < 0 {
+				return m, nil
+			}
+			value.Set(reflect.Append(value, reflect.ValueOf(protowire.DecodeBool(varint))))
+			packed = packed[m:]
+		}
+		return n, nil
+	}
+	return 0, errProtoWireType
+}